@@ -0,0 +1,477 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/slimslenderslacks/mcp-logseq/graphdb"
+	"github.com/slimslenderslacks/mcp-logseq/logseqapi"
+)
+
+var uuidPattern = regexp.MustCompile(`^(?i)[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// isUUID reports whether s is a block UUID rather than a page name. Hex
+// digits may be in either case.
+func isUUID(s string) bool {
+	return uuidPattern.MatchString(s)
+}
+
+// apiUnavailableError is returned by write operations when the Logseq HTTP
+// API server cannot be reached.
+type apiUnavailableError struct {
+	addr string
+	err  error
+}
+
+func (e *apiUnavailableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *apiUnavailableError) Unwrap() error {
+	return e.err
+}
+
+// apiWriter implements the write half of Backend against the Logseq HTTP
+// API. The script and native backends share it. The API writes to
+// whichever graph is open in the Logseq app, so every write first checks
+// that graph with targetGraph.
+type apiWriter struct {
+	api *logseqapi.Client
+	// readOnly reports whether writes to a graph are refused.
+	readOnly func(graph string) bool
+}
+
+func (w *apiWriter) wrap(err error) error {
+	if logseqapi.IsUnavailable(err) {
+		return &apiUnavailableError{addr: w.api.Addr(), err: err}
+	}
+	return err
+}
+
+// insertContent creates a block on a page, or as the last child of a block
+// when pageOrBlockID is a UUID.
+func (w *apiWriter) insertContent(ctx context.Context, pageOrBlockID, content string) (*logseqapi.BlockEntity, error) {
+	if isUUID(pageOrBlockID) {
+		return w.api.InsertBlock(ctx, pageOrBlockID, content, logseqapi.InsertBlockOptions{Sibling: false})
+	}
+	return w.api.AppendBlockInPage(ctx, pageOrBlockID, content)
+}
+
+func (w *apiWriter) CreateTask(ctx context.Context, args CreateTaskArgs) (*logseqapi.BlockEntity, error) {
+	if _, err := w.targetGraph(ctx, args.Graph); err != nil {
+		return nil, err
+	}
+	// Create the block without #Task in its content, then tag it so the
+	// title stays clean.
+	block, err := w.insertContent(ctx, args.PageOrBlockID, args.Content)
+	if err != nil {
+		return nil, w.wrap(err)
+	}
+	if err := w.api.AddBlockTag(ctx, block.UUID, "Task"); err != nil {
+		return nil, w.wrap(err)
+	}
+	if err := w.api.UpsertBlockProperty(ctx, block.UUID, "logseq.property/status", args.Status); err != nil {
+		return nil, w.wrap(err)
+	}
+	if err := w.api.UpsertBlockProperty(ctx, block.UUID, "logseq.property/priority", args.Priority); err != nil {
+		return nil, w.wrap(err)
+	}
+	if err := w.schedule(ctx, block.UUID, args.Deadline, args.Scheduled, args.Repeat); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+// schedule sets or removes a task's deadline, scheduled date and
+// recurrence.
+func (w *apiWriter) schedule(ctx context.Context, uuid, deadline, scheduled, repeat string) error {
+	c, err := taskSchedule(deadline, scheduled, repeat)
+	if err != nil {
+		return err
+	}
+	for _, key := range slices.Sorted(maps.Keys(c.set)) {
+		if err := w.api.UpsertBlockProperty(ctx, uuid, key, c.set[key]); err != nil {
+			return w.wrap(err)
+		}
+	}
+	for _, key := range c.remove {
+		if err := w.api.RemoveBlockProperty(ctx, uuid, key); err != nil {
+			return w.wrap(err)
+		}
+	}
+	return nil
+}
+
+// completeTask marks a task done, or rolls a repeating one forward, going
+// by the task as db has it. A task too new to be in db.sqlite yet has no
+// recurrence and is marked done.
+func (w *apiWriter) completeTask(ctx context.Context, db *graphdb.DB, args CompleteTaskArgs) (*TaskUpdate, error) {
+	update := &TaskUpdate{UUID: args.UUID, Status: "Done"}
+	if task := db.ByUUID(args.UUID); task != nil {
+		update = completion(task, time.Now())
+	}
+	if update.Deadline != nil {
+		if err := w.api.UpsertBlockProperty(ctx, args.UUID, graphdb.PropertyDeadline, update.Deadline.UnixMilli()); err != nil {
+			return nil, w.wrap(err)
+		}
+	}
+	if update.Scheduled != nil {
+		if err := w.api.UpsertBlockProperty(ctx, args.UUID, graphdb.PropertyScheduled, update.Scheduled.UnixMilli()); err != nil {
+			return nil, w.wrap(err)
+		}
+	}
+	if err := w.api.UpsertBlockProperty(ctx, args.UUID, graphdb.PropertyStatus, update.Status); err != nil {
+		return nil, w.wrap(err)
+	}
+	return update, nil
+}
+
+func (w *apiWriter) UpdateTask(ctx context.Context, args UpdateTaskArgs) error {
+	if _, err := w.targetGraph(ctx, args.Graph); err != nil {
+		return err
+	}
+	if args.Status != "" {
+		if err := w.api.UpsertBlockProperty(ctx, args.UUID, "logseq.property/status", args.Status); err != nil {
+			return w.wrap(err)
+		}
+	}
+	if args.Content != "" {
+		if err := w.api.UpdateBlock(ctx, args.UUID, args.Content); err != nil {
+			return w.wrap(err)
+		}
+	}
+	return w.schedule(ctx, args.UUID, args.Deadline, args.Scheduled, args.Repeat)
+}
+
+func (w *apiWriter) AddContent(ctx context.Context, args AddContentArgs) (*logseqapi.BlockEntity, error) {
+	if _, err := w.targetGraph(ctx, args.Graph); err != nil {
+		return nil, err
+	}
+	block, err := w.insertContent(ctx, args.PageOrBlockID, args.Content)
+	return block, w.wrap(err)
+}
+
+// blockPositions are the places move_block can put a block relative to
+// its target.
+var blockPositions = []string{"last-child", "first-child", "before", "after"}
+
+func (w *apiWriter) MoveBlock(ctx context.Context, args MoveBlockArgs) error {
+	if _, err := w.targetGraph(ctx, args.Graph); err != nil {
+		return err
+	}
+	return w.wrap(w.moveBlock(ctx, args.UUID, args.Target, args.Position))
+}
+
+// moveBlock maps a position onto moveBlock calls. Logseq only moves a
+// block next to another or into an empty parent, so first-child and
+// last-child go before the first or after the last existing child.
+func (w *apiWriter) moveBlock(ctx context.Context, src, target, position string) error {
+	if position == "before" || position == "after" {
+		return w.api.MoveBlock(ctx, src, target, logseqapi.MoveBlockOptions{Before: position == "before"})
+	}
+
+	var parent string
+	var children []logseqapi.BlockEntity
+	if isUUID(target) {
+		block, err := w.api.GetBlock(ctx, target, true)
+		if err != nil {
+			return err
+		}
+		if block == nil {
+			return &BackendError{Code: errCodeBlockNotFound, Message: "Block not found: " + target}
+		}
+		parent, children = block.UUID, block.Children
+	} else {
+		page, err := w.api.GetPage(ctx, target)
+		if err != nil {
+			return err
+		}
+		if page == nil {
+			return &BackendError{Code: errCodePageNotFound, Message: "Page not found: " + target}
+		}
+		if children, err = w.api.GetPageBlocksTree(ctx, target); err != nil {
+			return err
+		}
+		parent = page.UUID
+	}
+
+	children = slices.DeleteFunc(children, func(b logseqapi.BlockEntity) bool { return b.UUID == src })
+	switch {
+	case len(children) == 0:
+		return w.api.MoveBlock(ctx, src, parent, logseqapi.MoveBlockOptions{Children: true})
+	case position == "first-child":
+		return w.api.MoveBlock(ctx, src, children[0].UUID, logseqapi.MoveBlockOptions{Before: true})
+	}
+	return w.api.MoveBlock(ctx, src, children[len(children)-1].UUID, logseqapi.MoveBlockOptions{})
+}
+
+func (w *apiWriter) DeleteBlock(ctx context.Context, args DeleteBlockArgs) error {
+	if _, err := w.targetGraph(ctx, args.Graph); err != nil {
+		return err
+	}
+	if !args.Recursive {
+		block, err := w.api.GetBlock(ctx, args.UUID, true)
+		if err != nil {
+			return w.wrap(err)
+		}
+		if block == nil {
+			return &BackendError{Code: errCodeBlockNotFound, Message: "Block not found: " + args.UUID}
+		}
+		for _, child := range block.Children {
+			if err := w.api.MoveBlock(ctx, child.UUID, args.UUID, logseqapi.MoveBlockOptions{Before: true}); err != nil {
+				return w.wrap(err)
+			}
+		}
+	}
+	return w.wrap(w.api.RemoveBlock(ctx, args.UUID))
+}
+
+func (w *apiWriter) IndentBlock(ctx context.Context, args IndentBlockArgs, outdent bool) error {
+	if _, err := w.targetGraph(ctx, args.Graph); err != nil {
+		return err
+	}
+	if !outdent {
+		prev, err := w.api.GetPreviousSiblingBlock(ctx, args.UUID)
+		if err != nil {
+			return w.wrap(err)
+		}
+		if prev == nil {
+			return &BackendError{Code: errCodeInvalidArgument, Message: "Cannot indent the first block among its siblings: " + args.UUID}
+		}
+		return w.wrap(w.moveBlock(ctx, args.UUID, prev.UUID, "last-child"))
+	}
+
+	block, err := w.api.GetBlock(ctx, args.UUID, false)
+	if err != nil {
+		return w.wrap(err)
+	}
+	if block == nil {
+		return &BackendError{Code: errCodeBlockNotFound, Message: "Block not found: " + args.UUID}
+	}
+	if block.Parent == nil || block.Page == nil || block.Parent.ID == block.Page.ID {
+		return &BackendError{Code: errCodeInvalidArgument, Message: "Cannot outdent a top-level block: " + args.UUID}
+	}
+	parent, err := w.api.GetBlock(ctx, block.Parent.ID, false)
+	if err != nil {
+		return w.wrap(err)
+	}
+	if parent == nil {
+		return &BackendError{Code: errCodeBlockNotFound, Message: fmt.Sprintf("Parent block %d not found", block.Parent.ID)}
+	}
+	return w.wrap(w.api.MoveBlock(ctx, args.UUID, parent.UUID, logseqapi.MoveBlockOptions{}))
+}
+
+// getPage returns a page by name or UUID, or a page-not-found error.
+func (w *apiWriter) getPage(ctx context.Context, name string) (*logseqapi.BlockEntity, error) {
+	page, err := w.api.GetPage(ctx, name)
+	if err != nil {
+		return nil, w.wrap(err)
+	}
+	if page == nil {
+		return nil, &BackendError{Code: errCodePageNotFound, Message: "Page not found: " + name}
+	}
+	return page, nil
+}
+
+// createPage checks args.Properties against db, the graph the page is
+// created in, then creates the page and sets them as setBlockProperty
+// does.
+func (w *apiWriter) createPage(ctx context.Context, db *graphdb.DB, args CreatePageArgs) (*logseqapi.BlockEntity, int, error) {
+	existing, err := w.api.GetPage(ctx, args.Name)
+	if err != nil {
+		return nil, 0, w.wrap(err)
+	}
+	if existing != nil {
+		return nil, 0, &BackendError{Code: errCodeInvalidArgument, Message: "Page already exists: " + args.Name}
+	}
+	// Every value is checked before anything is written.
+	var updates []*propertyUpdate
+	for _, key := range slices.Sorted(maps.Keys(args.Properties)) {
+		u, err := resolvePropertyValue(db, key, args.Properties[key])
+		if err != nil {
+			return nil, 0, err
+		}
+		updates = append(updates, u)
+	}
+
+	page, err := w.api.CreatePage(ctx, args.Name, nil, logseqapi.CreatePageOptions{})
+	if err != nil {
+		return nil, 0, w.wrap(err)
+	}
+	for _, u := range updates {
+		if err := w.api.UpsertBlockProperty(ctx, page.UUID, u.key, u.value()); err != nil {
+			return nil, 0, w.wrap(err)
+		}
+	}
+	for _, tag := range args.Tags {
+		if err := w.api.AddBlockTag(ctx, page.UUID, tag); err != nil {
+			return nil, 0, w.wrap(err)
+		}
+	}
+	n, err := w.insertBlocks(ctx, args.Name, args.Blocks)
+	return page, n, w.wrap(err)
+}
+
+// insertBlocks adds blocks and their children, in order, under a page or
+// block, and returns how many it created.
+func (w *apiWriter) insertBlocks(ctx context.Context, pageOrBlockID string, blocks []BlockInput) (int, error) {
+	n := 0
+	for _, b := range blocks {
+		block, err := w.insertContent(ctx, pageOrBlockID, b.Content)
+		if err != nil {
+			return n, err
+		}
+		children, err := w.insertBlocks(ctx, block.UUID, b.Children)
+		n += 1 + children
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func (w *apiWriter) RenamePage(ctx context.Context, args RenamePageArgs) error {
+	if _, err := w.targetGraph(ctx, args.Graph); err != nil {
+		return err
+	}
+	if _, err := w.getPage(ctx, args.Name); err != nil {
+		return err
+	}
+	existing, err := w.api.GetPage(ctx, args.NewName)
+	if err != nil {
+		return w.wrap(err)
+	}
+	if existing != nil && !strings.EqualFold(args.Name, args.NewName) {
+		return &BackendError{Code: errCodeInvalidArgument, Message: "Page already exists: " + args.NewName}
+	}
+	return w.wrap(w.api.RenamePage(ctx, args.Name, args.NewName))
+}
+
+func (w *apiWriter) DeletePage(ctx context.Context, args DeletePageArgs) error {
+	if _, err := w.targetGraph(ctx, args.Graph); err != nil {
+		return err
+	}
+	page, err := w.getPage(ctx, args.Name)
+	if err != nil {
+		return err
+	}
+	return w.wrap(w.api.DeletePage(ctx, page.Text()))
+}
+
+// setPageProperty checks args.Value against db, the graph the page is in,
+// and writes the checked value.
+func (w *apiWriter) setPageProperty(ctx context.Context, db *graphdb.DB, args SetPagePropertyArgs) error {
+	page, err := w.getPage(ctx, args.Name)
+	if err != nil {
+		return err
+	}
+	u, err := resolvePropertyValue(db, args.Key, args.Value)
+	if err != nil {
+		return err
+	}
+	return w.wrap(w.api.UpsertBlockProperty(ctx, page.UUID, u.key, u.value()))
+}
+
+// targetGraph returns the graph open in Logseq, which receives the write,
+// after checking that it is graph, if given, and not read-only. Writes
+// whose db.sqlite checks are run against the graph it returns.
+func (w *apiWriter) targetGraph(ctx context.Context, graph string) (string, error) {
+	current, err := w.api.GetCurrentGraph(ctx)
+	if err != nil {
+		return "", w.wrap(err)
+	}
+	if current == nil {
+		return "", &BackendError{Code: errCodeGraphNotFound, Message: "No graph is open in Logseq"}
+	}
+	if graph != "" && current.Name != graph {
+		return "", &BackendError{Code: errCodeInvalidArgument, Message: fmt.Sprintf("Graph %s is not open in Logseq (%s is), and writes go to the open graph", graph, current.Name)}
+	}
+	if w.readOnly != nil && w.readOnly(current.Name) {
+		return "", readOnlyError(current.Name)
+	}
+	return current.Name, nil
+}
+
+func (w *apiWriter) CurrentGraph(ctx context.Context) (string, error) {
+	return w.targetGraph(ctx, "")
+}
+
+// setBlockProperty checks args.Value against db, the graph the block is
+// in, and writes the checked value.
+func (w *apiWriter) setBlockProperty(ctx context.Context, db *graphdb.DB, args SetBlockPropertyArgs) (*PropertyChange, error) {
+	if db.ByUUID(args.UUID) == nil {
+		return nil, &BackendError{Code: errCodeBlockNotFound, Message: "Block not found: " + args.UUID}
+	}
+	u, err := resolvePropertyValue(db, args.Key, args.Value)
+	if err != nil {
+		return nil, err
+	}
+	if err := w.api.UpsertBlockProperty(ctx, args.UUID, u.key, u.value()); err != nil {
+		return nil, w.wrap(err)
+	}
+	return u.change(args.UUID), nil
+}
+
+func (w *apiWriter) removeBlockProperty(ctx context.Context, db *graphdb.DB, args RemoveBlockPropertyArgs) (*PropertyChange, error) {
+	block := db.ByUUID(args.UUID)
+	if block == nil {
+		return nil, &BackendError{Code: errCodeBlockNotFound, Message: "Block not found: " + args.UUID}
+	}
+	prop, err := removableProperty(db, args.Key)
+	if err != nil {
+		return nil, err
+	}
+	change := &PropertyChange{UUID: args.UUID, Property: prop.Ident(), Title: prop.Title(), Action: "unchanged"}
+	if block.Has(prop.Ident()) {
+		if err := w.api.RemoveBlockProperty(ctx, args.UUID, prop.Ident()); err != nil {
+			return nil, w.wrap(err)
+		}
+		change.Action = "removed"
+	}
+	return change, nil
+}
+
+// appendToJournal appends a block to the journal page of args.Date,
+// creating it as a journal titled in db's date format if neither db nor
+// Logseq has it.
+func (w *apiWriter) appendToJournal(ctx context.Context, db *graphdb.DB, args AppendToJournalArgs) (*JournalEntry, error) {
+	day, err := time.ParseInLocation(time.DateOnly, args.Date, time.Local)
+	if err != nil {
+		return nil, &BackendError{Code: errCodeInvalidArgument, Message: "Invalid journal date: " + args.Date}
+	}
+	entry := &JournalEntry{Date: args.Date, Content: args.Content}
+	if page := findJournal(db, day); page != nil {
+		entry.Page = page.Title()
+	} else {
+		entry.Page = formatJournalTitle(journalTitleFormat(db), day)
+		page, err := w.api.GetPage(ctx, entry.Page)
+		if err != nil {
+			return nil, w.wrap(err)
+		}
+		if page == nil {
+			if _, err := w.api.CreatePage(ctx, entry.Page, map[string]any{}, logseqapi.CreatePageOptions{Journal: true}); err != nil {
+				return nil, w.wrap(err)
+			}
+			entry.PageCreated = true
+		}
+	}
+	block, err := w.api.AppendBlockInPage(ctx, entry.Page, args.Content)
+	if err != nil {
+		return nil, w.wrap(err)
+	}
+	entry.ID, entry.UUID = block.ID, block.UUID
+	return entry, nil
+}
+
+// unavailableHint explains how to enable the HTTP API server.
+func unavailableHint(addr string) string {
+	return "Logseq API appears to be unavailable. Please ensure:\n" +
+		"  1. Logseq is running on your host\n" +
+		"  2. HTTP API is enabled (Settings > Features > Developer Mode > HTTP APIs)\n" +
+		fmt.Sprintf("  3. The API is accessible at %s", addr)
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/slimslenderslacks/mcp-logseq/graphdb"
+	"github.com/slimslenderslacks/mcp-logseq/logseqapi"
+)
+
+// fakeAPI answers Logseq HTTP API calls from a map of results by method
+// and records the calls it receives.
+type fakeAPI struct {
+	mu      sync.Mutex
+	results map[string]any
+	calls   []apiCall
+}
+
+type apiCall struct {
+	Method string `json:"method"`
+	Args   []any  `json:"args"`
+}
+
+func newFakeAPI(t *testing.T, results map[string]any) (*fakeAPI, *logseqapi.Client) {
+	t.Helper()
+	f := &fakeAPI{results: results}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var call apiCall
+		if err := json.NewDecoder(r.Body).Decode(&call); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		f.calls = append(f.calls, call)
+		result := f.results[call.Method]
+		f.mu.Unlock()
+		json.NewEncoder(w).Encode(result)
+	}))
+	t.Cleanup(srv.Close)
+	host, port, err := net.SplitHostPort(strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f, logseqapi.New(host, port, "")
+}
+
+// called returns the calls of method.
+func (f *fakeAPI) called(method string) []apiCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []apiCall
+	for _, c := range f.calls {
+		if c.Method == method {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// memoryDB returns a snapshot of a seeded memory graph, for checking
+// values the way a db.sqlite would.
+func memoryDB(t *testing.T) *graphdb.DB {
+	t.Helper()
+	db, err := newMemoryBackend().open(context.Background(), defaultGraphName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestAPIWriterCreatePageChecksProperties(t *testing.T) {
+	ctx := context.Background()
+	db := memoryDB(t)
+
+	rejected := []map[string]string{
+		{"logseq.property.repeat/recur-frequency": "3"},
+		{"Priority": "Someday"},
+		{"type": "project", "priority": "Whenever"},
+	}
+	for _, properties := range rejected {
+		api, client := newFakeAPI(t, nil)
+		w := &apiWriter{api: client}
+		if _, _, err := w.createPage(ctx, db, CreatePageArgs{Name: "Projects", Properties: properties}); err == nil {
+			t.Errorf("createPage with %v succeeded", properties)
+		}
+		if calls := api.called("logseq.Editor.createPage"); len(calls) != 0 {
+			t.Errorf("createPage with %v created the page", properties)
+		}
+	}
+
+	api, client := newFakeAPI(t, map[string]any{
+		"logseq.Editor.createPage": map[string]any{"id": 100, "uuid": "6790c2a4-1c2b-4f3e-9d2a-0123456789ab"},
+	})
+	w := &apiWriter{api: client}
+	_, _, err := w.createPage(ctx, db, CreatePageArgs{Name: "Projects", Properties: map[string]string{"priority": "high", "type": "project"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	high := db.Ident(graphdb.PropertyPriority + ".high")
+	var got []string
+	for _, c := range api.called("logseq.Editor.upsertBlockProperty") {
+		got = append(got, c.Args[1].(string))
+		if c.Args[1] == graphdb.PropertyPriority && c.Args[2] != float64(high.ID) {
+			t.Errorf("priority set to %v, want the closed value %d", c.Args[2], high.ID)
+		}
+	}
+	if want := []string{graphdb.PropertyPriority, "type"}; !slices.Equal(got, want) {
+		t.Errorf("set properties %q, want %q", got, want)
+	}
+}
+
+func TestAPIWriterSetPagePropertyChecksValue(t *testing.T) {
+	ctx := context.Background()
+	db := memoryDB(t)
+	api, client := newFakeAPI(t, map[string]any{
+		"logseq.Editor.getPage": map[string]any{"id": 100, "uuid": "6790c2a4-1c2b-4f3e-9d2a-0123456789ab"},
+	})
+	w := &apiWriter{api: client}
+
+	for _, args := range []SetPagePropertyArgs{
+		{Name: "Projects", Key: "logseq.property.repeat/recur-frequency", Value: "3"},
+		{Name: "Projects", Key: "status", Value: "Someday"},
+		{Name: "Projects", Key: " ", Value: "x"},
+	} {
+		if err := w.setPageProperty(ctx, db, args); err == nil {
+			t.Errorf("setPageProperty(%s=%s) succeeded", args.Key, args.Value)
+		}
+	}
+	if calls := api.called("logseq.Editor.upsertBlockProperty"); len(calls) != 0 {
+		t.Fatalf("rejected values were written: %v", calls)
+	}
+
+	if err := w.setPageProperty(ctx, db, SetPagePropertyArgs{Name: "Projects", Key: "Status", Value: "doing"}); err != nil {
+		t.Fatal(err)
+	}
+	calls := api.called("logseq.Editor.upsertBlockProperty")
+	doing := db.Ident(graphdb.PropertyStatus + ".doing")
+	if len(calls) != 1 || calls[0].Args[1] != graphdb.PropertyStatus || calls[0].Args[2] != float64(doing.ID) {
+		t.Errorf("upsertBlockProperty calls = %v, want status set to %d", calls, doing.ID)
+	}
+}
+
+func TestReadOnlyGraphErrorCode(t *testing.T) {
+	ctx := context.Background()
+	readOnly := func(graph string) bool { return graph == defaultGraphName }
+	_, client := newFakeAPI(t, map[string]any{
+		"logseq.App.getCurrentGraph": map[string]any{"name": "logseq_db_" + defaultGraphName},
+	})
+	memory := newMemoryBackend()
+	memory.readOnly = readOnly
+
+	_, apiErr := (&apiWriter{api: client, readOnly: readOnly}).targetGraph(ctx, "")
+	memoryErr := memory.DeleteBlock(ctx, DeleteBlockArgs{Graph: defaultGraphName, UUID: "6790c2a4-1c2b-4f3e-9d2a-0123456789ab"})
+	for name, err := range map[string]error{"api": apiErr, "memory": memoryErr} {
+		var backendErr *BackendError
+		if !errors.As(err, &backendErr) || backendErr.Code != errCodeReadOnly {
+			t.Errorf("%s: got %v, want a %s BackendError", name, err, errCodeReadOnly)
+		}
+	}
+}
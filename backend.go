@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+
+	"github.com/slimslenderslacks/mcp-logseq/graphdb"
+	"github.com/slimslenderslacks/mcp-logseq/logseqapi"
+)
+
+// Backend is where tool calls are answered. Reads are per graph. Writes go
+// to whichever graph the Logseq app behind the graph's API endpoint
+// currently has open.
+type Backend interface {
+	ListTasks(ctx context.Context, graph string) ([]Task, error)
+	FindTasks(ctx context.Context, graph string, filter TaskFilter) ([]Task, error)
+	ListPages(ctx context.Context, graph string, expand bool) ([]Page, error)
+	GetPage(ctx context.Context, graph, pageName string) (*PageContent, error)
+	// GetBlockTree returns the whole outline under a page (by name or UUID)
+	// or a block (by UUID), with every block's properties.
+	GetBlockTree(ctx context.Context, graph, pageOrBlockID string) (*BlockTree, error)
+	// GetReferences returns what links to, is tagged with or mentions a
+	// page (by name or UUID) or block (by UUID).
+	GetReferences(ctx context.Context, graph, pageOrBlockID string) (*References, error)
+	// Search runs a full-text query over a graph's page and block titles.
+	Search(ctx context.Context, graph string, q SearchQuery) (*SearchResults, error)
+	// ListJournals returns the journal pages from one day to another,
+	// inclusive and as YYYYMMDD numbers, most recent first. A zero bound
+	// is open.
+	ListJournals(ctx context.Context, graph string, from, to int) ([]Page, error)
+	ListTags(ctx context.Context, graph string, expand bool) ([]Tag, error)
+	ListProperties(ctx context.Context, graph string, expand bool) ([]Property, error)
+	// ListGraphs returns the names of the graphs the backend can read,
+	// sorted. It is cheap enough to validate graph arguments with.
+	ListGraphs(ctx context.Context) ([]string, error)
+	GraphInfo(ctx context.Context, graph string) (*Graph, error)
+	// Version identifies the state of a graph. It changes whenever the
+	// graph does, whether through this server or the Logseq app.
+	Version(ctx context.Context, graph string) (string, error)
+	// Snapshot reads a whole graph, for the watcher to diff one state of
+	// it against the next.
+	Snapshot(ctx context.Context, graph string) (*graphdb.DB, error)
+	// CurrentGraph returns the graph that writes without a graph argument
+	// go to.
+	CurrentGraph(ctx context.Context) (string, error)
+
+	CreateTask(ctx context.Context, args CreateTaskArgs) (*logseqapi.BlockEntity, error)
+	// CompleteTask marks a task Done, or puts a repeating task back to
+	// Todo with its deadline or scheduled date moved on.
+	CompleteTask(ctx context.Context, args CompleteTaskArgs) (*TaskUpdate, error)
+	UpdateTask(ctx context.Context, args UpdateTaskArgs) error
+	AddContent(ctx context.Context, args AddContentArgs) (*logseqapi.BlockEntity, error)
+	// AppendToJournal adds a block to the journal page of args.Date, a
+	// YYYY-MM-DD day, creating the page with a title in the graph's date
+	// format if it does not exist.
+	AppendToJournal(ctx context.Context, args AppendToJournalArgs) (*JournalEntry, error)
+	MoveBlock(ctx context.Context, args MoveBlockArgs) error
+	// DeleteBlock deletes a block, moving its children into its place
+	// unless args.Recursive is set.
+	DeleteBlock(ctx context.Context, args DeleteBlockArgs) error
+	// IndentBlock indents a block under its previous sibling, or outdents
+	// it to follow its parent.
+	IndentBlock(ctx context.Context, args IndentBlockArgs, outdent bool) error
+	// CreatePage creates a page with its properties, tags and blocks, and
+	// returns it with the number of blocks created. Properties are checked
+	// as SetBlockProperty checks them, before the page is created.
+	CreatePage(ctx context.Context, args CreatePageArgs) (*logseqapi.BlockEntity, int, error)
+	RenamePage(ctx context.Context, args RenamePageArgs) error
+	DeletePage(ctx context.Context, args DeletePageArgs) error
+	// SetPageProperty checks a value as SetBlockProperty does and sets it
+	// on a page.
+	SetPageProperty(ctx context.Context, args SetPagePropertyArgs) error
+	// SetBlockProperty checks a value against the property's type,
+	// cardinality and closed values, resolving references to pages and
+	// blocks, and sets it on a block.
+	SetBlockProperty(ctx context.Context, args SetBlockPropertyArgs) (*PropertyChange, error)
+	RemoveBlockProperty(ctx context.Context, args RemoveBlockPropertyArgs) (*PropertyChange, error)
+}
+
+// Backend names accepted by LOGSEQ_BACKEND and LOGSEQ_GRAPH_BACKENDS.
+// backendMemory is for tests: its graphs are lost when the server exits.
+const (
+	backendScript = "script"
+	backendNative = "native"
+	backendMemory = "memory"
+)
+
+// newBackendFromConfig builds the backend named by cfg.Backend, routing
+// graphs with their own backend or API endpoint to separate instances, and
+// caches its reads unless cfg.CacheSizeMB is 0.
+func newBackendFromConfig(cfg *Config) Backend {
+	type key struct{ name, addr string }
+	backends := make(map[key]Backend)
+	// Script backends share one pool, whose workers start on first use.
+	var workers *workerPool
+	if cfg.ScriptWorkers > 0 {
+		workers = newWorkerPool(runScriptPath(cfg), cfg.ScriptWorkers, cfg.ScriptTimeout)
+	}
+	get := func(name string, api *logseqapi.Client) Backend {
+		k := key{name, api.Addr()}
+		if b, ok := backends[k]; ok {
+			return b
+		}
+		b := newBackend(name, cfg, api, workers)
+		backends[k] = b
+		return b
+	}
+
+	var backend Backend = get(cfg.Backend, cfg.apiClient(""))
+	if len(cfg.Graphs) > 0 {
+		router := &graphRouter{def: backend, graphs: make(map[string]Backend)}
+		for graph, g := range cfg.Graphs {
+			name := cfg.Backend
+			if g.Backend != "" {
+				name = g.Backend
+			}
+			router.graphs[graph] = get(name, cfg.apiClient(graph))
+		}
+		backend = router
+	}
+	// One cache in front of every graph, so that a write drops what was
+	// read from its graph whichever backend answers it.
+	if cfg.CacheSizeMB > 0 {
+		backend = newCachedBackend(backend, cfg.CacheTTL, int64(cfg.CacheSizeMB)<<20)
+	}
+	return backend
+}
+
+func runScriptPath(cfg *Config) string {
+	return filepath.Join(cfg.ScriptRoot, "run-script.sh")
+}
+
+// newBackend creates a backend by name. name must have been validated.
+func newBackend(name string, cfg *Config, api *logseqapi.Client, workers *workerPool) Backend {
+	switch name {
+	case backendNative:
+		return newNativeBackend(cfg.GraphsDir, api, cfg.isReadOnly)
+	case backendMemory:
+		graphs := []string{defaultGraphName}
+		if cfg.DefaultGraph != "" {
+			graphs = []string{cfg.DefaultGraph}
+		}
+		for graph := range cfg.Graphs {
+			if graph != graphs[0] {
+				graphs = append(graphs, graph)
+			}
+		}
+		b := newMemoryBackend(graphs...)
+		b.readOnly = cfg.isReadOnly
+		return b
+	}
+	return newScriptBackend(runScriptPath(cfg), cfg.GraphsDir, api, cfg.isReadOnly, workers, cfg.ScriptTimeout)
+}
+
+// graphRouter sends calls for a graph to its own backend and everything
+// else to the default backend.
+type graphRouter struct {
+	def    Backend
+	graphs map[string]Backend
+}
+
+func (r *graphRouter) backend(graph string) Backend {
+	if b, ok := r.graphs[graph]; ok {
+		return b
+	}
+	return r.def
+}
+
+func (r *graphRouter) ListTasks(ctx context.Context, graph string) ([]Task, error) {
+	return r.backend(graph).ListTasks(ctx, graph)
+}
+
+func (r *graphRouter) FindTasks(ctx context.Context, graph string, filter TaskFilter) ([]Task, error) {
+	return r.backend(graph).FindTasks(ctx, graph, filter)
+}
+
+func (r *graphRouter) ListPages(ctx context.Context, graph string, expand bool) ([]Page, error) {
+	return r.backend(graph).ListPages(ctx, graph, expand)
+}
+
+func (r *graphRouter) GetPage(ctx context.Context, graph, pageName string) (*PageContent, error) {
+	return r.backend(graph).GetPage(ctx, graph, pageName)
+}
+
+func (r *graphRouter) GetBlockTree(ctx context.Context, graph, pageOrBlockID string) (*BlockTree, error) {
+	return r.backend(graph).GetBlockTree(ctx, graph, pageOrBlockID)
+}
+
+func (r *graphRouter) GetReferences(ctx context.Context, graph, pageOrBlockID string) (*References, error) {
+	return r.backend(graph).GetReferences(ctx, graph, pageOrBlockID)
+}
+
+func (r *graphRouter) Search(ctx context.Context, graph string, q SearchQuery) (*SearchResults, error) {
+	return r.backend(graph).Search(ctx, graph, q)
+}
+
+func (r *graphRouter) ListJournals(ctx context.Context, graph string, from, to int) ([]Page, error) {
+	return r.backend(graph).ListJournals(ctx, graph, from, to)
+}
+
+func (r *graphRouter) ListTags(ctx context.Context, graph string, expand bool) ([]Tag, error) {
+	return r.backend(graph).ListTags(ctx, graph, expand)
+}
+
+func (r *graphRouter) ListProperties(ctx context.Context, graph string, expand bool) ([]Property, error) {
+	return r.backend(graph).ListProperties(ctx, graph, expand)
+}
+
+// ListGraphs returns each graph listed by the backend that the router
+// sends it to.
+func (r *graphRouter) ListGraphs(ctx context.Context) ([]string, error) {
+	backends := []Backend{r.def}
+	for _, b := range r.graphs {
+		if !slices.Contains(backends, b) {
+			backends = append(backends, b)
+		}
+	}
+	var graphs []string
+	for _, b := range backends {
+		names, err := b.ListGraphs(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			if r.backend(name) == b && !slices.Contains(graphs, name) {
+				graphs = append(graphs, name)
+			}
+		}
+	}
+	slices.Sort(graphs)
+	return graphs, nil
+}
+
+func (r *graphRouter) GraphInfo(ctx context.Context, graph string) (*Graph, error) {
+	return r.backend(graph).GraphInfo(ctx, graph)
+}
+
+func (r *graphRouter) Version(ctx context.Context, graph string) (string, error) {
+	return r.backend(graph).Version(ctx, graph)
+}
+
+func (r *graphRouter) Snapshot(ctx context.Context, graph string) (*graphdb.DB, error) {
+	return r.backend(graph).Snapshot(ctx, graph)
+}
+
+func (r *graphRouter) CurrentGraph(ctx context.Context) (string, error) {
+	return r.def.CurrentGraph(ctx)
+}
+
+func (r *graphRouter) CreateTask(ctx context.Context, args CreateTaskArgs) (*logseqapi.BlockEntity, error) {
+	return r.backend(args.Graph).CreateTask(ctx, args)
+}
+
+func (r *graphRouter) CompleteTask(ctx context.Context, args CompleteTaskArgs) (*TaskUpdate, error) {
+	return r.backend(args.Graph).CompleteTask(ctx, args)
+}
+
+func (r *graphRouter) UpdateTask(ctx context.Context, args UpdateTaskArgs) error {
+	return r.backend(args.Graph).UpdateTask(ctx, args)
+}
+
+func (r *graphRouter) AddContent(ctx context.Context, args AddContentArgs) (*logseqapi.BlockEntity, error) {
+	return r.backend(args.Graph).AddContent(ctx, args)
+}
+
+func (r *graphRouter) AppendToJournal(ctx context.Context, args AppendToJournalArgs) (*JournalEntry, error) {
+	return r.backend(args.Graph).AppendToJournal(ctx, args)
+}
+
+func (r *graphRouter) MoveBlock(ctx context.Context, args MoveBlockArgs) error {
+	return r.backend(args.Graph).MoveBlock(ctx, args)
+}
+
+func (r *graphRouter) DeleteBlock(ctx context.Context, args DeleteBlockArgs) error {
+	return r.backend(args.Graph).DeleteBlock(ctx, args)
+}
+
+func (r *graphRouter) IndentBlock(ctx context.Context, args IndentBlockArgs, outdent bool) error {
+	return r.backend(args.Graph).IndentBlock(ctx, args, outdent)
+}
+
+func (r *graphRouter) CreatePage(ctx context.Context, args CreatePageArgs) (*logseqapi.BlockEntity, int, error) {
+	return r.backend(args.Graph).CreatePage(ctx, args)
+}
+
+func (r *graphRouter) RenamePage(ctx context.Context, args RenamePageArgs) error {
+	return r.backend(args.Graph).RenamePage(ctx, args)
+}
+
+func (r *graphRouter) DeletePage(ctx context.Context, args DeletePageArgs) error {
+	return r.backend(args.Graph).DeletePage(ctx, args)
+}
+
+func (r *graphRouter) SetPageProperty(ctx context.Context, args SetPagePropertyArgs) error {
+	return r.backend(args.Graph).SetPageProperty(ctx, args)
+}
+
+func (r *graphRouter) SetBlockProperty(ctx context.Context, args SetBlockPropertyArgs) (*PropertyChange, error) {
+	return r.backend(args.Graph).SetBlockProperty(ctx, args)
+}
+
+func (r *graphRouter) RemoveBlockProperty(ctx context.Context, args RemoveBlockPropertyArgs) (*PropertyChange, error) {
+	return r.backend(args.Graph).RemoveBlockProperty(ctx, args)
+}
@@ -0,0 +1,852 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/slimslenderslacks/mcp-logseq/graphdb"
+	"github.com/slimslenderslacks/mcp-logseq/logseqapi"
+)
+
+const defaultGraphName = "mcp"
+
+// memorySchema is the part of the Logseq DB schema the memory backend
+// writes.
+var memorySchema = map[string]graphdb.Attribute{
+	"db/ident":                          {Unique: true},
+	"block/uuid":                        {Unique: true},
+	"block/name":                        {Unique: true},
+	"block/page":                        {Ref: true},
+	"block/parent":                      {Ref: true},
+	"block/tags":                        {Ref: true, Many: true},
+	"block/refs":                        {Ref: true, Many: true},
+	"block/closed-value-property":       {Ref: true},
+	"logseq.property/status":            {Ref: true},
+	"logseq.property/priority":          {Ref: true},
+	"logseq.property.repeat/recur-unit": {Ref: true},
+	"logseq.property/description":       {Ref: true},
+	"logseq.property/classes":           {Ref: true, Many: true},
+	"logseq.property.class/extends":     {Ref: true, Many: true},
+	"logseq.property.class/properties":  {Ref: true, Many: true},
+
+	// Numbers are stored in value blocks, as in a real graph.
+	"logseq.property.repeat/recur-frequency": {Ref: true},
+	"logseq.property/created-from-property":  {Ref: true},
+}
+
+// memoryBackend keeps graphs in memory. It is a fake for exercising tool
+// handlers without Node, Logseq or a db.sqlite file. Writes without a graph
+// go to the graph named current, standing in for the graph open in the
+// Logseq app.
+type memoryBackend struct {
+	graphReader
+
+	// readOnly, if set, reports whether writes to a graph are refused.
+	readOnly func(graph string) bool
+
+	mu      sync.Mutex
+	graphs  map[string]*memoryGraph
+	current string
+	search  *searchIndexes
+}
+
+type memoryGraph struct {
+	// schema starts as memorySchema and gains the properties set on the
+	// graph's blocks.
+	schema map[string]graphdb.Attribute
+	datoms []graphdb.Datom
+	nextID int64
+	tx     int64
+}
+
+// newMemoryBackend creates a backend holding the named graphs, each seeded
+// with the built-in classes and the task properties: status, priority,
+// deadline, scheduled and recurrence. The first graph receives writes.
+func newMemoryBackend(graphs ...string) *memoryBackend {
+	if len(graphs) == 0 {
+		graphs = []string{defaultGraphName}
+	}
+	b := &memoryBackend{graphs: make(map[string]*memoryGraph), current: graphs[0], search: newSearchIndexes()}
+	b.graphReader = graphReader{load: newGraphSnapshots(b.Version, b.open).load}
+	for _, name := range graphs {
+		g := &memoryGraph{schema: maps.Clone(memorySchema), nextID: 1}
+		g.seed()
+		b.graphs[name] = g
+	}
+	return b
+}
+
+func (b *memoryBackend) open(ctx context.Context, graph string) (*graphdb.DB, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	g, ok := b.graphs[graph]
+	if !ok {
+		return nil, &BackendError{Code: errCodeGraphNotFound, Message: "Database does not exist: " + graph}
+	}
+	return g.db(), nil
+}
+
+// Version is a graph's last transaction.
+func (b *memoryBackend) Version(ctx context.Context, graph string) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	g, ok := b.graphs[graph]
+	if !ok {
+		return "", &BackendError{Code: errCodeGraphNotFound, Message: "Database does not exist: " + graph}
+	}
+	return strconv.FormatInt(g.tx, 10), nil
+}
+
+// Search versions a graph's index by its last transaction.
+func (b *memoryBackend) Search(ctx context.Context, graph string, q SearchQuery) (*SearchResults, error) {
+	version, err := b.Version(ctx, graph)
+	if err != nil {
+		return nil, err
+	}
+	return b.search.search(ctx, graph, version, b.load, q)
+}
+
+func (b *memoryBackend) ListGraphs(ctx context.Context) ([]string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return slices.Sorted(maps.Keys(b.graphs)), nil
+}
+
+// GraphInfo counts a graph. Memory graphs have no file, and the current
+// graph is the one receiving writes without a graph argument.
+func (b *memoryBackend) GraphInfo(ctx context.Context, graph string) (*Graph, error) {
+	g := &Graph{Name: graph, Current: graph == b.current}
+	if err := b.countGraph(ctx, g); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func (b *memoryBackend) CurrentGraph(ctx context.Context) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.current, nil
+}
+
+func (g *memoryGraph) db() *graphdb.DB {
+	return graphdb.New(g.schema, g.datoms)
+}
+
+func newUUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// transact adds an entity with the given attributes and returns its id.
+// Values of cardinality-many attributes may be given as []any.
+func (g *memoryGraph) transact(id int64, attrs map[string]any) int64 {
+	if id == 0 {
+		id = g.nextID
+		g.nextID++
+	}
+	g.tx++
+	for attr, v := range attrs {
+		values, ok := v.([]any)
+		if !ok {
+			values = []any{v}
+		}
+		for _, value := range values {
+			g.datoms = append(g.datoms, graphdb.Datom{E: id, A: attr, V: value, Tx: g.tx, Added: true})
+		}
+	}
+	return id
+}
+
+// memoryConfig is the config.edn of a memory graph.
+const memoryConfig = `{:journal/page-title-format "` + defaultDateFormat + `"}`
+
+func (g *memoryGraph) seed() {
+	now := time.Now().UnixMilli()
+	page := func(title string, attrs map[string]any) int64 {
+		attrs["block/title"] = title
+		attrs["block/name"] = strings.ToLower(title)
+		attrs["block/uuid"] = graphdb.UUID(newUUID())
+		attrs["block/created-at"] = now
+		attrs["block/updated-at"] = now
+		return g.transact(0, attrs)
+	}
+
+	tag := page("Tag", map[string]any{"db/ident": graphdb.Keyword(graphdb.ClassTag)})
+	g.transact(tag, map[string]any{"block/tags": tag})
+	property := page("Property", map[string]any{"db/ident": graphdb.Keyword(graphdb.ClassProperty), "block/tags": tag})
+	page("Task", map[string]any{"db/ident": graphdb.Keyword(graphdb.ClassTask), "block/tags": tag})
+	page("Journal", map[string]any{"db/ident": graphdb.Keyword(graphdb.ClassJournal), "block/tags": tag})
+	g.transact(0, map[string]any{"file/path": graphdb.ConfigFile, "file/content": memoryConfig})
+
+	for _, p := range []struct {
+		ident, title, typ string
+		public            bool
+		values            []string
+	}{
+		{graphdb.PropertyStatus, "Status", "default", true, []string{"Backlog", "Later", "Now", "Todo", "Doing", "Waiting", "In Review", "Done", "Canceled"}},
+		{graphdb.PropertyPriority, "Priority", "default", true, []string{"Low", "Medium", "High", "Urgent"}},
+		{graphdb.PropertyDeadline, "Deadline", "datetime", true, nil},
+		{graphdb.PropertyScheduled, "Scheduled", "datetime", true, nil},
+		{graphdb.PropertyRepeated, "Repeating task?", "checkbox", false, nil},
+		{graphdb.PropertyRecurFrequency, "Repeating recur frequency", "number", false, nil},
+		{graphdb.PropertyRecurUnit, "Repeating recur unit", "default", false, recurUnits},
+	} {
+		prop := page(p.title, map[string]any{
+			"db/ident":                graphdb.Keyword(p.ident),
+			"block/tags":              property,
+			"logseq.property/type":    graphdb.Keyword(p.typ),
+			"db/cardinality":          graphdb.Keyword("db.cardinality/one"),
+			"logseq.property/public?": p.public,
+		})
+		for i, value := range p.values {
+			g.transact(0, map[string]any{
+				"db/ident":                    graphdb.Keyword(p.ident + "." + strings.ToLower(strings.ReplaceAll(value, " ", "-"))),
+				"block/title":                 value,
+				"block/uuid":                  graphdb.UUID(newUUID()),
+				"block/order":                 fmt.Sprintf("a%d", i),
+				"block/closed-value-property": prop,
+			})
+		}
+	}
+}
+
+// closedValue returns the id of the closed value of property whose title
+// is value, or an error listing the valid choices.
+func closedValue(db *graphdb.DB, property, value string) (int64, error) {
+	prop := db.Ident(property)
+	if prop == nil {
+		return 0, &BackendError{Code: errCodeInvalidArgument, Message: "Unknown property " + property}
+	}
+	var choices []string
+	for _, v := range closedValues(prop) {
+		if strings.EqualFold(v.Title(), value) {
+			return v.ID, nil
+		}
+		choices = append(choices, v.Title())
+	}
+	return 0, &BackendError{Code: errCodeInvalidArgument, Message: fmt.Sprintf("Invalid value %q for %s (expected one of %s)", value, property, strings.Join(choices, ", "))}
+}
+
+// insert adds a block to a page, creating the page when needed, or as the
+// last child of a block when pageOrBlockID is a UUID.
+func (g *memoryGraph) insert(pageOrBlockID, content string, attrs map[string]any) (*logseqapi.BlockEntity, error) {
+	db := g.db()
+	var page, parent *graphdb.Entity
+	if isUUID(pageOrBlockID) {
+		parent = db.ByUUID(pageOrBlockID)
+		if parent == nil {
+			return nil, &BackendError{Code: errCodeBlockNotFound, Message: "Block not found: " + pageOrBlockID}
+		}
+		page = parent.Page()
+		if page == nil {
+			page = parent
+		}
+	} else {
+		page = db.FindPage(pageOrBlockID)
+		if page == nil {
+			id := g.newPage(pageOrBlockID, map[string]any{})
+			page = g.db().Entity(id)
+		}
+		parent = page
+	}
+
+	var last string
+	if children := outlineChildren(parent); len(children) > 0 {
+		last = children[len(children)-1].Order()
+	}
+	order, err := graphdb.OrderKeyBetween(last, "")
+	if err != nil {
+		return nil, err
+	}
+	uuid := newUUID()
+	now := time.Now().UnixMilli()
+	attrs["block/title"] = content
+	attrs["block/uuid"] = graphdb.UUID(uuid)
+	attrs["block/page"] = page.ID
+	attrs["block/parent"] = parent.ID
+	attrs["block/order"] = order
+	attrs["block/created-at"] = now
+	attrs["block/updated-at"] = now
+	id := g.transact(0, attrs)
+
+	return &logseqapi.BlockEntity{
+		ID:     int(id),
+		UUID:   uuid,
+		Title:  content,
+		Order:  order,
+		Page:   &logseqapi.EntityRef{ID: int(page.ID)},
+		Parent: &logseqapi.EntityRef{ID: int(parent.ID)},
+	}, nil
+}
+
+// newPage creates a page titled title with attrs and returns its id.
+func (g *memoryGraph) newPage(title string, attrs map[string]any) int64 {
+	now := time.Now().UnixMilli()
+	attrs["block/title"] = title
+	attrs["block/name"] = strings.ToLower(title)
+	attrs["block/uuid"] = graphdb.UUID(newUUID())
+	attrs["block/created-at"] = now
+	attrs["block/updated-at"] = now
+	return g.transact(0, attrs)
+}
+
+func (g *memoryGraph) block(uuid string) (*graphdb.DB, *graphdb.Entity, error) {
+	db := g.db()
+	e := db.ByUUID(uuid)
+	if e == nil {
+		return nil, nil, &BackendError{Code: errCodeBlockNotFound, Message: "Block not found: " + uuid}
+	}
+	return db, e, nil
+}
+
+// writeGraph returns the graph a write goes to. b.mu must be held.
+func (b *memoryBackend) writeGraph(graph string) (*memoryGraph, error) {
+	if graph == "" {
+		graph = b.current
+	}
+	g, ok := b.graphs[graph]
+	if !ok {
+		return nil, &BackendError{Code: errCodeGraphNotFound, Message: "Database does not exist: " + graph}
+	}
+	if b.readOnly != nil && b.readOnly(graph) {
+		return nil, readOnlyError(graph)
+	}
+	return g, nil
+}
+
+func (b *memoryBackend) CreateTask(ctx context.Context, args CreateTaskArgs) (*logseqapi.BlockEntity, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	g, err := b.writeGraph(args.Graph)
+	if err != nil {
+		return nil, err
+	}
+	db := g.db()
+
+	status, err := closedValue(db, graphdb.PropertyStatus, args.Status)
+	if err != nil {
+		return nil, err
+	}
+	priority, err := closedValue(db, graphdb.PropertyPriority, args.Priority)
+	if err != nil {
+		return nil, err
+	}
+	attrs := map[string]any{
+		"block/tags":             db.Ident(graphdb.ClassTask).ID,
+		graphdb.PropertyStatus:   status,
+		graphdb.PropertyPriority: priority,
+	}
+	c, err := taskSchedule(args.Deadline, args.Scheduled, args.Repeat)
+	if err != nil {
+		return nil, err
+	}
+	if err := g.scheduleAttrs(db, c, attrs); err != nil {
+		return nil, err
+	}
+	return g.insert(args.PageOrBlockID, args.Content, attrs)
+}
+
+// scheduleAttrs adds the values c sets to attrs, the recurrence unit as
+// its closed value and the frequency as a number value block, as Logseq
+// stores them.
+func (g *memoryGraph) scheduleAttrs(db *graphdb.DB, c *scheduleChange, attrs map[string]any) error {
+	for k, v := range c.set {
+		switch k {
+		case graphdb.PropertyRecurUnit:
+			id, err := closedValue(db, k, v.(string))
+			if err != nil {
+				return err
+			}
+			v = id
+		case graphdb.PropertyRecurFrequency:
+			v = g.transact(0, map[string]any{
+				"block/uuid":                            graphdb.UUID(newUUID()),
+				"logseq.property/value":                 v,
+				"logseq.property/created-from-property": db.Ident(k).ID,
+			})
+		}
+		attrs[k] = v
+	}
+	return nil
+}
+
+func (b *memoryBackend) CompleteTask(ctx context.Context, args CompleteTaskArgs) (*TaskUpdate, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	g, err := b.writeGraph(args.Graph)
+	if err != nil {
+		return nil, err
+	}
+	db, e, err := g.block(args.UUID)
+	if err != nil {
+		return nil, err
+	}
+
+	update := completion(e, time.Now())
+	status, err := closedValue(db, graphdb.PropertyStatus, update.Status)
+	if err != nil {
+		return nil, err
+	}
+	attrs := map[string]any{graphdb.PropertyStatus: status, "block/updated-at": time.Now().UnixMilli()}
+	if update.Deadline != nil {
+		attrs[graphdb.PropertyDeadline] = update.Deadline.UnixMilli()
+	}
+	if update.Scheduled != nil {
+		attrs[graphdb.PropertyScheduled] = update.Scheduled.UnixMilli()
+	}
+	g.transact(e.ID, attrs)
+	return update, nil
+}
+
+func (b *memoryBackend) UpdateTask(ctx context.Context, args UpdateTaskArgs) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	g, err := b.writeGraph(args.Graph)
+	if err != nil {
+		return err
+	}
+	db, e, err := g.block(args.UUID)
+	if err != nil {
+		return err
+	}
+
+	attrs := map[string]any{"block/updated-at": time.Now().UnixMilli()}
+	if args.Status != "" {
+		status, err := closedValue(db, graphdb.PropertyStatus, args.Status)
+		if err != nil {
+			return err
+		}
+		attrs[graphdb.PropertyStatus] = status
+	}
+	if args.Content != "" {
+		attrs["block/title"] = args.Content
+	}
+	c, err := taskSchedule(args.Deadline, args.Scheduled, args.Repeat)
+	if err != nil {
+		return err
+	}
+	if err := g.scheduleAttrs(db, c, attrs); err != nil {
+		return err
+	}
+	for _, attr := range c.remove {
+		g.retractAttr(e, attr)
+	}
+	g.transact(e.ID, attrs)
+	return nil
+}
+
+func (b *memoryBackend) AddContent(ctx context.Context, args AddContentArgs) (*logseqapi.BlockEntity, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	g, err := b.writeGraph(args.Graph)
+	if err != nil {
+		return nil, err
+	}
+	return g.insert(args.PageOrBlockID, args.Content, map[string]any{})
+}
+
+func (b *memoryBackend) AppendToJournal(ctx context.Context, args AppendToJournalArgs) (*JournalEntry, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	g, err := b.writeGraph(args.Graph)
+	if err != nil {
+		return nil, err
+	}
+	day, err := time.ParseInLocation(time.DateOnly, args.Date, time.Local)
+	if err != nil {
+		return nil, &BackendError{Code: errCodeInvalidArgument, Message: "Invalid journal date: " + args.Date}
+	}
+
+	db := g.db()
+	entry := &JournalEntry{Date: args.Date, Content: args.Content}
+	page := findJournal(db, day)
+	if page == nil {
+		id := g.newPage(formatJournalTitle(journalTitleFormat(db), day), map[string]any{
+			"block/journal-day": journalDay(day),
+			"block/tags":        db.Ident(graphdb.ClassJournal).ID,
+		})
+		page = g.db().Entity(id)
+		entry.PageCreated = true
+	}
+	entry.Page = page.Title()
+	block, err := g.insert(page.UUID(), args.Content, map[string]any{})
+	if err != nil {
+		return nil, err
+	}
+	entry.ID, entry.UUID = block.ID, block.UUID
+	return entry, nil
+}
+
+func (b *memoryBackend) MoveBlock(ctx context.Context, args MoveBlockArgs) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	g, err := b.writeGraph(args.Graph)
+	if err != nil {
+		return err
+	}
+	db, e, err := g.block(args.UUID)
+	if err != nil {
+		return err
+	}
+	return g.move(db, e, args.Target, args.Position)
+}
+
+// move places e, with its children, at position relative to target, with
+// an order key between its new neighbours.
+func (g *memoryGraph) move(db *graphdb.DB, e *graphdb.Entity, target, position string) error {
+	var parent, anchor *graphdb.Entity
+	switch position {
+	case "before", "after":
+		if anchor = db.ByUUID(target); anchor == nil {
+			return &BackendError{Code: errCodeBlockNotFound, Message: "Block not found: " + target}
+		}
+		if parent = anchor.Parent(); parent == nil {
+			return &BackendError{Code: errCodeInvalidArgument, Message: "Cannot move a block before or after a page: " + target}
+		}
+	default:
+		var err error
+		if parent, err = findPageOrBlock(db, target); err != nil {
+			return err
+		}
+	}
+	if parent.ID == e.ID || isDescendant(parent, e.ID) || (anchor != nil && anchor.ID == e.ID) {
+		return &BackendError{Code: errCodeInvalidArgument, Message: "Cannot move a block into or next to itself"}
+	}
+
+	siblings := slices.DeleteFunc(outlineChildren(parent), func(s *graphdb.Entity) bool { return s.ID == e.ID })
+	i := len(siblings)
+	switch position {
+	case "first-child":
+		i = 0
+	case "before", "after":
+		i = slices.IndexFunc(siblings, func(s *graphdb.Entity) bool { return s.ID == anchor.ID })
+		if position == "after" {
+			i++
+		}
+	}
+	var prev, next string
+	if i > 0 {
+		prev = siblings[i-1].Order()
+	}
+	if i < len(siblings) {
+		next = siblings[i].Order()
+	}
+	order, err := graphdb.OrderKeyBetween(prev, next)
+	if err != nil {
+		return err
+	}
+
+	page := parent
+	if !parent.Has("block/name") {
+		page = parent.Page()
+	}
+	g.transact(e.ID, map[string]any{
+		"block/parent":     parent.ID,
+		"block/page":       page.ID,
+		"block/order":      order,
+		"block/updated-at": time.Now().UnixMilli(),
+	})
+	if old := e.Page(); old == nil || old.ID != page.ID {
+		for _, d := range descendants(e) {
+			g.transact(d.ID, map[string]any{"block/page": page.ID})
+		}
+	}
+	return nil
+}
+
+// descendants returns every block below e, depth first.
+func descendants(e *graphdb.Entity) []*graphdb.Entity {
+	var all []*graphdb.Entity
+	for _, child := range outlineChildren(e) {
+		all = append(all, child)
+		all = append(all, descendants(child)...)
+	}
+	return all
+}
+
+// retract removes every attribute of e, and so e itself.
+func (g *memoryGraph) retract(e *graphdb.Entity) {
+	g.tx++
+	for _, attr := range e.Attributes() {
+		for _, v := range e.All(attr) {
+			g.datoms = append(g.datoms, graphdb.Datom{E: e.ID, A: attr, V: v, Tx: g.tx, Added: false})
+		}
+	}
+}
+
+func (b *memoryBackend) DeleteBlock(ctx context.Context, args DeleteBlockArgs) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	g, err := b.writeGraph(args.Graph)
+	if err != nil {
+		return err
+	}
+	db, e, err := g.block(args.UUID)
+	if err != nil {
+		return err
+	}
+	if args.Recursive {
+		for _, d := range descendants(e) {
+			g.retract(d)
+		}
+	} else {
+		for _, child := range outlineChildren(e) {
+			if err := g.move(db, child, args.UUID, "before"); err != nil {
+				return err
+			}
+			db = g.db()
+		}
+	}
+	g.retract(e)
+	return nil
+}
+
+func (b *memoryBackend) IndentBlock(ctx context.Context, args IndentBlockArgs, outdent bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	g, err := b.writeGraph(args.Graph)
+	if err != nil {
+		return err
+	}
+	db, e, err := g.block(args.UUID)
+	if err != nil {
+		return err
+	}
+	parent := e.Parent()
+	if parent == nil {
+		return &BackendError{Code: errCodeInvalidArgument, Message: "Not a block: " + args.UUID}
+	}
+	if outdent {
+		if parent.Has("block/name") {
+			return &BackendError{Code: errCodeInvalidArgument, Message: "Cannot outdent a top-level block: " + args.UUID}
+		}
+		return g.move(db, e, parent.UUID(), "after")
+	}
+	siblings := outlineChildren(parent)
+	i := slices.IndexFunc(siblings, func(s *graphdb.Entity) bool { return s.ID == e.ID })
+	if i <= 0 {
+		return &BackendError{Code: errCodeInvalidArgument, Message: "Cannot indent the first block among its siblings: " + args.UUID}
+	}
+	return g.move(db, e, siblings[i-1].UUID(), "last-child")
+}
+
+func (b *memoryBackend) CreatePage(ctx context.Context, args CreatePageArgs) (*logseqapi.BlockEntity, int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	g, err := b.writeGraph(args.Graph)
+	if err != nil {
+		return nil, 0, err
+	}
+	db := g.db()
+	if db.FindPage(args.Name) != nil {
+		return nil, 0, &BackendError{Code: errCodeInvalidArgument, Message: "Page already exists: " + args.Name}
+	}
+	// Every value is checked before anything is written.
+	for key, value := range args.Properties {
+		if _, err := resolvePropertyValue(db, key, value); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	id := g.newPage(args.Name, map[string]any{})
+	for _, key := range slices.Sorted(maps.Keys(args.Properties)) {
+		db := g.db()
+		if _, err := g.setProperty(db, db.Entity(id), key, args.Properties[key]); err != nil {
+			return nil, 0, err
+		}
+	}
+	for _, tag := range args.Tags {
+		g.transact(id, map[string]any{"block/tags": g.tag(tag)})
+	}
+	n, err := g.insertBlocks(args.Name, args.Blocks)
+	if err != nil {
+		return nil, 0, err
+	}
+	page := g.db().Entity(id)
+	return &logseqapi.BlockEntity{ID: int(id), UUID: page.UUID(), Title: page.Title()}, n, nil
+}
+
+func (g *memoryGraph) insertBlocks(pageOrBlockID string, blocks []BlockInput) (int, error) {
+	n := 0
+	for _, b := range blocks {
+		block, err := g.insert(pageOrBlockID, b.Content, map[string]any{})
+		if err != nil {
+			return n, err
+		}
+		children, err := g.insertBlocks(block.UUID, b.Children)
+		n += 1 + children
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// tag returns the id of the tag titled title, creating it if needed, as
+// Logseq does when a block is tagged with a new tag.
+func (g *memoryGraph) tag(title string) int64 {
+	db := g.db()
+	if t := db.FindTag(title); t != nil {
+		return t.ID
+	}
+	return g.newPage(title, map[string]any{"block/tags": db.Ident(graphdb.ClassTag).ID})
+}
+
+// setProperty checks value against the property named key and sets it
+// on e, creating a text property for a new key.
+func (g *memoryGraph) setProperty(db *graphdb.DB, e *graphdb.Entity, key string, value any) (*propertyUpdate, error) {
+	u, err := resolvePropertyValue(db, key, value)
+	if err != nil {
+		return nil, err
+	}
+	if u.prop == nil {
+		ident := "user.property/" + strings.ToLower(strings.Join(strings.Fields(u.key), "-"))
+		g.newPage(u.key, map[string]any{
+			"db/ident":             graphdb.Keyword(ident),
+			"block/tags":           db.Ident(graphdb.ClassProperty).ID,
+			"logseq.property/type": graphdb.Keyword("default"),
+			"db/cardinality":       graphdb.Keyword("db.cardinality/one"),
+		})
+		u.key = ident
+	}
+	g.define(u.key, graphdb.Attribute{Ref: u.ref, Many: u.many})
+
+	g.retractAttr(e, u.key)
+	g.transact(e.ID, map[string]any{u.key: u.values, "block/updated-at": time.Now().UnixMilli()})
+	return u, nil
+}
+
+// define sets the schema of attr. Snapshots share the schema map, so it
+// is copied rather than changed in place.
+func (g *memoryGraph) define(attr string, a graphdb.Attribute) {
+	if current, ok := g.schema[attr]; ok && current == a {
+		return
+	}
+	g.schema = maps.Clone(g.schema)
+	g.schema[attr] = a
+}
+
+// retractAttr removes every value of attr from e.
+func (g *memoryGraph) retractAttr(e *graphdb.Entity, attr string) {
+	g.tx++
+	for _, v := range e.All(attr) {
+		g.datoms = append(g.datoms, graphdb.Datom{E: e.ID, A: attr, V: v, Tx: g.tx, Added: false})
+	}
+}
+
+// page returns the page named or identified by name.
+func (g *memoryGraph) page(name string) (*graphdb.DB, *graphdb.Entity, error) {
+	db := g.db()
+	page := db.FindPage(name)
+	if page == nil {
+		return nil, nil, &BackendError{Code: errCodePageNotFound, Message: "Page not found: " + name}
+	}
+	return db, page, nil
+}
+
+func (b *memoryBackend) RenamePage(ctx context.Context, args RenamePageArgs) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	g, err := b.writeGraph(args.Graph)
+	if err != nil {
+		return err
+	}
+	db, page, err := g.page(args.Name)
+	if err != nil {
+		return err
+	}
+	if other := db.FindPage(args.NewName); other != nil && other.ID != page.ID {
+		return &BackendError{Code: errCodeInvalidArgument, Message: "Page already exists: " + args.NewName}
+	}
+	g.transact(page.ID, map[string]any{
+		"block/title":      args.NewName,
+		"block/name":       strings.ToLower(args.NewName),
+		"block/updated-at": time.Now().UnixMilli(),
+	})
+	return nil
+}
+
+func (b *memoryBackend) DeletePage(ctx context.Context, args DeletePageArgs) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	g, err := b.writeGraph(args.Graph)
+	if err != nil {
+		return err
+	}
+	db, page, err := g.page(args.Name)
+	if err != nil {
+		return err
+	}
+	for _, block := range db.Referencing(page.ID, "block/page") {
+		g.retract(block)
+	}
+	g.retract(page)
+	return nil
+}
+
+func (b *memoryBackend) SetPageProperty(ctx context.Context, args SetPagePropertyArgs) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	g, err := b.writeGraph(args.Graph)
+	if err != nil {
+		return err
+	}
+	db, page, err := g.page(args.Name)
+	if err != nil {
+		return err
+	}
+	_, err = g.setProperty(db, page, args.Key, args.Value)
+	return err
+}
+
+func (b *memoryBackend) SetBlockProperty(ctx context.Context, args SetBlockPropertyArgs) (*PropertyChange, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	g, err := b.writeGraph(args.Graph)
+	if err != nil {
+		return nil, err
+	}
+	db, e, err := g.block(args.UUID)
+	if err != nil {
+		return nil, err
+	}
+	u, err := g.setProperty(db, e, args.Key, args.Value)
+	if err != nil {
+		return nil, err
+	}
+	return u.change(args.UUID), nil
+}
+
+func (b *memoryBackend) RemoveBlockProperty(ctx context.Context, args RemoveBlockPropertyArgs) (*PropertyChange, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	g, err := b.writeGraph(args.Graph)
+	if err != nil {
+		return nil, err
+	}
+	db, e, err := g.block(args.UUID)
+	if err != nil {
+		return nil, err
+	}
+	prop, err := removableProperty(db, args.Key)
+	if err != nil {
+		return nil, err
+	}
+	change := &PropertyChange{UUID: args.UUID, Property: prop.Ident(), Title: prop.Title(), Action: "unchanged"}
+	if e.Has(prop.Ident()) {
+		g.retractAttr(e, prop.Ident())
+		g.transact(e.ID, map[string]any{"block/updated-at": time.Now().UnixMilli()})
+		change.Action = "removed"
+	}
+	return change, nil
+}
@@ -0,0 +1,685 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/slimslenderslacks/mcp-logseq/graphdb"
+	"github.com/slimslenderslacks/mcp-logseq/logseqapi"
+)
+
+// nativeBackend reads db.sqlite in-process with graphdb and writes through
+// the HTTP API, so it needs neither Node nor a Logseq checkout.
+type nativeBackend struct {
+	graphReader
+	*apiWriter
+	dir    string
+	search *searchIndexes
+}
+
+func newNativeBackend(dir string, api *logseqapi.Client, readOnly func(graph string) bool) *nativeBackend {
+	return &nativeBackend{
+		graphReader: graphReader{load: newFileSnapshots(dir).load},
+		apiWriter:   &apiWriter{api: api, readOnly: readOnly},
+		dir:         dir,
+		search:      newSearchIndexes(),
+	}
+}
+
+func (b *nativeBackend) ListGraphs(ctx context.Context) ([]string, error) {
+	return scanGraphs(b.dir)
+}
+
+func (b *nativeBackend) GraphInfo(ctx context.Context, graph string) (*Graph, error) {
+	g := &Graph{Name: graph}
+	if err := statGraph(b.dir, g); err != nil {
+		return nil, err
+	}
+	if err := b.countGraph(ctx, g); err != nil {
+		return nil, err
+	}
+	g.Current = b.isCurrentGraph(ctx, graph)
+	return g, nil
+}
+
+func (b *nativeBackend) Version(ctx context.Context, graph string) (string, error) {
+	return graphVersion(b.dir, graph)
+}
+
+func (b *nativeBackend) Search(ctx context.Context, graph string, q SearchQuery) (*SearchResults, error) {
+	path, err := resolveGraphPath(b.dir, graph)
+	if err != nil {
+		return nil, err
+	}
+	return b.search.search(ctx, graph, fileVersion(path), b.load, q)
+}
+
+// CompleteTask reads the task from db.sqlite to roll a repeating one
+// forward.
+func (b *nativeBackend) CompleteTask(ctx context.Context, args CompleteTaskArgs) (*TaskUpdate, error) {
+	graph, err := b.targetGraph(ctx, args.Graph)
+	if err != nil {
+		return nil, err
+	}
+	db, err := b.load(ctx, graph)
+	if err != nil {
+		return nil, err
+	}
+	return b.completeTask(ctx, db, args)
+}
+
+// CreatePage checks the page's properties against the graph's db.sqlite,
+// like SetBlockProperty.
+func (b *nativeBackend) CreatePage(ctx context.Context, args CreatePageArgs) (*logseqapi.BlockEntity, int, error) {
+	graph, err := b.targetGraph(ctx, args.Graph)
+	if err != nil {
+		return nil, 0, err
+	}
+	db, err := b.load(ctx, graph)
+	if err != nil {
+		return nil, 0, err
+	}
+	return b.createPage(ctx, db, args)
+}
+
+// SetPageProperty checks the value against the graph's db.sqlite, like
+// SetBlockProperty.
+func (b *nativeBackend) SetPageProperty(ctx context.Context, args SetPagePropertyArgs) error {
+	graph, err := b.targetGraph(ctx, args.Graph)
+	if err != nil {
+		return err
+	}
+	db, err := b.load(ctx, graph)
+	if err != nil {
+		return err
+	}
+	return b.setPageProperty(ctx, db, args)
+}
+
+// SetBlockProperty checks the value against the graph's db.sqlite before
+// writing it through the API.
+func (b *nativeBackend) SetBlockProperty(ctx context.Context, args SetBlockPropertyArgs) (*PropertyChange, error) {
+	graph, err := b.targetGraph(ctx, args.Graph)
+	if err != nil {
+		return nil, err
+	}
+	db, err := b.load(ctx, graph)
+	if err != nil {
+		return nil, err
+	}
+	return b.setBlockProperty(ctx, db, args)
+}
+
+func (b *nativeBackend) RemoveBlockProperty(ctx context.Context, args RemoveBlockPropertyArgs) (*PropertyChange, error) {
+	graph, err := b.targetGraph(ctx, args.Graph)
+	if err != nil {
+		return nil, err
+	}
+	db, err := b.load(ctx, graph)
+	if err != nil {
+		return nil, err
+	}
+	return b.removeBlockProperty(ctx, db, args)
+}
+
+// AppendToJournal looks the journal page up in db.sqlite, and the date
+// format to title a new one in.
+func (b *nativeBackend) AppendToJournal(ctx context.Context, args AppendToJournalArgs) (*JournalEntry, error) {
+	graph, err := b.targetGraph(ctx, args.Graph)
+	if err != nil {
+		return nil, err
+	}
+	db, err := b.load(ctx, graph)
+	if err != nil {
+		return nil, err
+	}
+	return b.appendToJournal(ctx, db, args)
+}
+
+// graphReader implements the read half of Backend over graphdb snapshots.
+type graphReader struct {
+	load func(ctx context.Context, graph string) (*graphdb.DB, error)
+}
+
+// timeAttr returns the time stored in attr, or nil if e has none.
+func timeAttr(e *graphdb.Entity, attr string) *time.Time {
+	if !e.Has(attr) {
+		return nil
+	}
+	t := e.Time(attr)
+	return &t
+}
+
+func taskFromEntity(e *graphdb.Entity) Task {
+	task := Task{
+		ID:        int(e.ID),
+		UUID:      e.UUID(),
+		Title:     e.Title(),
+		Status:    e.RefTitle(graphdb.PropertyStatus),
+		Priority:  e.RefTitle(graphdb.PropertyPriority),
+		Deadline:  timeAttr(e, graphdb.PropertyDeadline),
+		Scheduled: timeAttr(e, graphdb.PropertyScheduled),
+		CreatedAt: timeAttr(e, "block/created-at"),
+		UpdatedAt: timeAttr(e, "block/updated-at"),
+	}
+	if page := e.Page(); page != nil {
+		task.Page = page.Title()
+	}
+	if r, ok := recurrenceOf(e); ok {
+		task.Repeat = r.String()
+	}
+	return task
+}
+
+func (r graphReader) Snapshot(ctx context.Context, graph string) (*graphdb.DB, error) {
+	return r.load(ctx, graph)
+}
+
+func (r graphReader) ListTasks(ctx context.Context, graph string) ([]Task, error) {
+	db, err := r.load(ctx, graph)
+	if err != nil {
+		return nil, err
+	}
+	var tasks []Task
+	for _, e := range db.Tasks() {
+		tasks = append(tasks, taskFromEntity(e))
+	}
+	return tasks, nil
+}
+
+// FindTasks returns the tasks matching f, ordered by id.
+func (r graphReader) FindTasks(ctx context.Context, graph string, f TaskFilter) ([]Task, error) {
+	db, err := r.load(ctx, graph)
+	if err != nil {
+		return nil, err
+	}
+	match, err := taskMatcher(db, f)
+	if err != nil {
+		return nil, err
+	}
+	var tasks []Task
+	for _, e := range db.Tasks() {
+		if match(e) {
+			tasks = append(tasks, taskFromEntity(e))
+		}
+	}
+	return tasks, nil
+}
+
+// taskMatcher resolves the page, tag and parent named in f and returns a
+// predicate over task entities.
+func taskMatcher(db *graphdb.DB, f TaskFilter) (func(*graphdb.Entity) bool, error) {
+	var page, tag, parent *graphdb.Entity
+	if f.Page != "" {
+		if page = db.FindPage(f.Page); page == nil {
+			return nil, &BackendError{Code: errCodePageNotFound, Message: "Page not found: " + f.Page}
+		}
+	}
+	if f.Tag != "" {
+		if tag = db.FindTag(f.Tag); tag == nil {
+			return nil, &BackendError{Code: errCodeInvalidArgument, Message: "Tag not found: " + f.Tag}
+		}
+	}
+	if f.Parent != "" {
+		if parent = db.ByUUID(f.Parent); parent == nil {
+			return nil, &BackendError{Code: errCodeBlockNotFound, Message: "Block not found: " + f.Parent}
+		}
+	}
+	text := strings.ToLower(f.Text)
+
+	inRange := func(e *graphdb.Entity, attr string, r TimeRange) bool {
+		if r.IsZero() {
+			return true
+		}
+		return e.Has(attr) && r.Contains(e.Int(attr))
+	}
+
+	return func(e *graphdb.Entity) bool {
+		if len(f.Statuses) > 0 && !containsFold(f.Statuses, e.RefTitle(graphdb.PropertyStatus)) {
+			return false
+		}
+		if f.Priority != "" && !strings.EqualFold(f.Priority, e.RefTitle(graphdb.PropertyPriority)) {
+			return false
+		}
+		if page != nil && (e.Page() == nil || e.Page().ID != page.ID) {
+			return false
+		}
+		if tag != nil && !hasRef(e, "block/tags", tag.ID) {
+			return false
+		}
+		if text != "" && !strings.Contains(strings.ToLower(e.Title()), text) {
+			return false
+		}
+		if parent != nil && !isDescendant(e, parent.ID) {
+			return false
+		}
+		return inRange(e, "block/created-at", f.Created) &&
+			inRange(e, "block/updated-at", f.Updated) &&
+			inRange(e, graphdb.PropertyDeadline, f.Deadline) &&
+			inRange(e, graphdb.PropertyScheduled, f.Scheduled)
+	}, nil
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasRef(e *graphdb.Entity, attr string, id int64) bool {
+	for _, ref := range e.Refs(attr) {
+		if ref.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// isDescendant reports whether ancestor is above e in the outline. It
+// stops at a block seen before, should a corrupt graph have a parent cycle.
+func isDescendant(e *graphdb.Entity, ancestor int64) bool {
+	seen := map[int64]bool{e.ID: true}
+	for p := e.Parent(); p != nil && !seen[p.ID]; p = p.Parent() {
+		if p.ID == ancestor {
+			return true
+		}
+		seen[p.ID] = true
+	}
+	return false
+}
+
+func pageFromEntity(e *graphdb.Entity) Page {
+	return Page{
+		ID:         int(e.ID),
+		UUID:       e.UUID(),
+		Title:      e.Title(),
+		Name:       e.Name(),
+		Journal:    e.HasTag(graphdb.ClassJournal) || e.Bool("block/journal?"),
+		JournalDay: int(e.Int("block/journal-day")),
+		CreatedAt:  timeAttr(e, "block/created-at"),
+		UpdatedAt:  timeAttr(e, "block/updated-at"),
+	}
+}
+
+func (r graphReader) ListPages(ctx context.Context, graph string, expand bool) ([]Page, error) {
+	db, err := r.load(ctx, graph)
+	if err != nil {
+		return nil, err
+	}
+	var pages []Page
+	for _, e := range db.Pages() {
+		if expand {
+			pages = append(pages, pageFromEntity(e))
+		} else {
+			pages = append(pages, Page{UUID: e.UUID(), Title: e.Title()})
+		}
+	}
+	return pages, nil
+}
+
+func (r graphReader) ListJournals(ctx context.Context, graph string, from, to int) ([]Page, error) {
+	db, err := r.load(ctx, graph)
+	if err != nil {
+		return nil, err
+	}
+	var journals []Page
+	for _, e := range db.Journals(int64(from), int64(to)) {
+		journals = append(journals, pageFromEntity(e))
+	}
+	return journals, nil
+}
+
+func (r graphReader) GetPage(ctx context.Context, graph, pageName string) (*PageContent, error) {
+	if pageName == "" {
+		return nil, &BackendError{Code: errCodeInvalidArgument, Message: "page name or UUID is required"}
+	}
+	db, err := r.load(ctx, graph)
+	if err != nil {
+		return nil, err
+	}
+	page := db.FindPage(pageName)
+	if page == nil {
+		return nil, &BackendError{Code: errCodePageNotFound, Message: "Page not found: " + pageName}
+	}
+
+	content := &PageContent{Page: pageFromEntity(page)}
+	for _, e := range db.PageBlocks(page) {
+		block := Block{
+			ID:    int(e.ID),
+			UUID:  e.UUID(),
+			Title: e.Title(),
+			Order: e.Order(),
+		}
+		if parent := e.Parent(); parent != nil && parent.ID != page.ID {
+			block.Parent = parent.UUID()
+		}
+		content.Blocks = append(content.Blocks, block)
+	}
+	return content, nil
+}
+
+// GetBlockTree follows :block/parent down from a page or block.
+func (r graphReader) GetBlockTree(ctx context.Context, graph, pageOrBlockID string) (*BlockTree, error) {
+	if pageOrBlockID == "" {
+		return nil, &BackendError{Code: errCodeInvalidArgument, Message: "page name or block UUID is required"}
+	}
+	db, err := r.load(ctx, graph)
+	if err != nil {
+		return nil, err
+	}
+
+	var page, root *graphdb.Entity
+	e, err := findPageOrBlock(db, pageOrBlockID)
+	if err != nil {
+		return nil, err
+	}
+	if e.Has("block/name") {
+		page = e
+	} else {
+		page, root = e.Page(), e
+	}
+
+	tree := &BlockTree{}
+	if page != nil {
+		tree.Page = pageFromEntity(page)
+	}
+	visited := make(map[int64]bool)
+	if root != nil {
+		tree.Blocks = []BlockNode{blockNode(root, visited)}
+	} else {
+		tree.Blocks = childNodes(page, visited)
+	}
+	return tree, nil
+}
+
+// findPageOrBlock looks up a page by name or UUID, or a block by UUID.
+func findPageOrBlock(db *graphdb.DB, pageOrBlockID string) (*graphdb.Entity, error) {
+	if isUUID(pageOrBlockID) {
+		if e := db.ByUUID(pageOrBlockID); e != nil {
+			return e, nil
+		}
+		return nil, &BackendError{Code: errCodeBlockNotFound, Message: "Block not found: " + pageOrBlockID}
+	}
+	if page := db.FindPage(pageOrBlockID); page != nil {
+		return page, nil
+	}
+	return nil, &BackendError{Code: errCodePageNotFound, Message: "Page not found: " + pageOrBlockID}
+}
+
+// outlineChildren returns the blocks directly below e in outline order.
+// Property value blocks, which also have e as their parent, are left out.
+func outlineChildren(e *graphdb.Entity) []*graphdb.Entity {
+	var children []*graphdb.Entity
+	for _, child := range e.Referencing("block/parent") {
+		if child.Has("block/title") && !child.Has("logseq.property/created-from-property") {
+			children = append(children, child)
+		}
+	}
+	graphdb.SortByOrder(children)
+	return children
+}
+
+// childNodes returns the outline below e.
+func childNodes(e *graphdb.Entity, visited map[int64]bool) []BlockNode {
+	var nodes []BlockNode
+	for _, child := range outlineChildren(e) {
+		if !visited[child.ID] {
+			nodes = append(nodes, blockNode(child, visited))
+		}
+	}
+	return nodes
+}
+
+func blockNode(e *graphdb.Entity, visited map[int64]bool) BlockNode {
+	visited[e.ID] = true
+	return BlockNode{
+		ID:         int(e.ID),
+		UUID:       e.UUID(),
+		Title:      e.Title(),
+		Order:      e.Order(),
+		Collapsed:  e.Bool("block/collapsed?"),
+		Properties: blockProperties(e),
+		Children:   childNodes(e, visited),
+	}
+}
+
+// blockProperties returns the user properties of a block and the built-in
+// ones Logseq shows, keyed by title.
+func blockProperties(e *graphdb.Entity) map[string]string {
+	var props map[string]string
+	for _, attr := range e.Attributes() {
+		prop := e.DB().Ident(attr)
+		if prop == nil {
+			continue
+		}
+		if !strings.HasPrefix(attr, "user.property/") && !(strings.HasPrefix(attr, "logseq.property/") && prop.Bool("logseq.property/public?")) {
+			continue
+		}
+		var values []string
+		for _, v := range e.All(attr) {
+			values = append(values, propertyValue(e.DB(), prop, v))
+		}
+		if props == nil {
+			props = make(map[string]string)
+		}
+		title := prop.Title()
+		if title == "" {
+			title = attr
+		}
+		props[title] = strings.Join(values, ", ")
+	}
+	return props
+}
+
+// propertyValue renders one value of prop: the title of a referenced
+// value block or page, a datetime as RFC 3339, anything else as is.
+func propertyValue(db *graphdb.DB, prop *graphdb.Entity, v any) string {
+	var ms int64
+	switch n := v.(type) {
+	case int64:
+		ms = n
+	case float64:
+		ms = int64(n)
+	default:
+		return fmt.Sprint(v)
+	}
+	if attribute, _ := db.Attribute(prop.Ident()); attribute.Ref {
+		if ref := db.Entity(ms); ref != nil {
+			return ref.Title()
+		}
+	}
+	if propertyType(prop) == "datetime" {
+		t := time.UnixMilli(ms)
+		return formatTime(&t)
+	}
+	return fmt.Sprint(v)
+}
+
+// GetReferences collects the entities whose :block/refs or :block/tags
+// point at the target and, for pages, the blocks on other pages whose
+// title contains the page's title.
+func (r graphReader) GetReferences(ctx context.Context, graph, pageOrBlockID string) (*References, error) {
+	if pageOrBlockID == "" {
+		return nil, &BackendError{Code: errCodeInvalidArgument, Message: "page name or block UUID is required"}
+	}
+	db, err := r.load(ctx, graph)
+	if err != nil {
+		return nil, err
+	}
+	target, err := findPageOrBlock(db, pageOrBlockID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Logseq adds a block's tags to its :block/refs, so tag usages are
+	// collected first and left out of the linked references.
+	refs := &References{Title: target.Title(), UUID: target.UUID()}
+	linked := make(map[int64]bool)
+	var sources []*graphdb.Entity
+	for _, e := range target.Referencing("block/tags") {
+		linked[e.ID] = true
+		sources = append(sources, e)
+	}
+	refs.Tagged = groupReferences(sources)
+
+	sources = nil
+	for _, e := range target.Referencing("block/refs") {
+		if !linked[e.ID] && e.ID != target.ID && !e.Has("logseq.property/created-from-property") {
+			linked[e.ID] = true
+			sources = append(sources, e)
+		}
+	}
+	refs.Linked = groupReferences(sources)
+
+	if target.Has("block/name") && target.Title() != "" {
+		title := strings.ToLower(target.Title())
+		sources = nil
+		for _, e := range db.With("block/page") {
+			// A block's page may not resolve, e.g. mid-write.
+			if p := e.Page(); linked[e.ID] || (p != nil && p.ID == target.ID) {
+				continue
+			}
+			if strings.Contains(strings.ToLower(e.Title()), title) {
+				sources = append(sources, e)
+			}
+		}
+		refs.Unlinked = groupReferences(sources)
+	}
+	return refs, nil
+}
+
+// groupReferences groups sources by the page they are on, pages by title
+// and the references on each page by id. A source that is itself a page
+// forms its own group.
+func groupReferences(sources []*graphdb.Entity) []ReferenceGroup {
+	byPage := make(map[int64]int)
+	var groups []ReferenceGroup
+	for _, e := range sources {
+		page := e.Page()
+		if page == nil {
+			page = e
+		}
+		i, ok := byPage[page.ID]
+		if !ok {
+			i = len(groups)
+			byPage[page.ID] = i
+			groups = append(groups, ReferenceGroup{Page: page.Title(), PageUUID: page.UUID()})
+		}
+		groups[i].References = append(groups[i].References, Reference{
+			ID:    int(e.ID),
+			UUID:  e.UUID(),
+			Title: e.Title(),
+			Path:  breadcrumb(e),
+		})
+	}
+	for _, g := range groups {
+		slices.SortFunc(g.References, func(a, b Reference) int { return cmp.Compare(a.ID, b.ID) })
+	}
+	slices.SortStableFunc(groups, func(a, b ReferenceGroup) int { return cmp.Compare(a.Page, b.Page) })
+	return groups
+}
+
+// breadcrumb returns the titles of the blocks above e on its page,
+// outermost first.
+func breadcrumb(e *graphdb.Entity) []string {
+	var path []string
+	seen := map[int64]bool{e.ID: true}
+	for p := e.Parent(); p != nil && !p.Has("block/name") && !seen[p.ID]; p = p.Parent() {
+		seen[p.ID] = true
+		path = append(path, p.Title())
+	}
+	slices.Reverse(path)
+	return path
+}
+
+// identList returns the :db/ident of every entity attr points at.
+func identList(e *graphdb.Entity, attr string) []string {
+	var idents []string
+	for _, ref := range e.Refs(attr) {
+		idents = append(idents, ref.Ident())
+	}
+	return idents
+}
+
+// propertyValueText returns the text of a property value, which is either
+// stored inline or as a reference to a value block.
+func propertyValueText(e *graphdb.Entity, attr string) string {
+	if !e.Has(attr) {
+		return ""
+	}
+	if attribute, _ := e.DB().Attribute(attr); attribute.Ref {
+		return e.RefTitle(attr)
+	}
+	return fmt.Sprint(e.Get(attr))
+}
+
+func (r graphReader) ListTags(ctx context.Context, graph string, expand bool) ([]Tag, error) {
+	db, err := r.load(ctx, graph)
+	if err != nil {
+		return nil, err
+	}
+	var tags []Tag
+	for _, e := range db.Tags() {
+		tag := Tag{UUID: e.UUID(), Title: e.Title()}
+		if expand {
+			tag.Ident = e.Ident()
+			tag.Extends = identList(e, "logseq.property.class/extends")
+			tag.Properties = identList(e, "logseq.property.class/properties")
+			tag.Description = propertyValueText(e, "logseq.property/description")
+			tag.CreatedAt = timeAttr(e, "block/created-at")
+			tag.UpdatedAt = timeAttr(e, "block/updated-at")
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+// propertyType returns a property's :logseq.property/type, which is a
+// keyword such as "default" or "node".
+func propertyType(prop *graphdb.Entity) string {
+	if ref := prop.Ref("logseq.property/type"); ref != nil {
+		return ref.Ident()
+	}
+	return prop.String("logseq.property/type")
+}
+
+// closedValues returns the choices of a property with a fixed set of
+// values, such as status or priority, in display order.
+func closedValues(prop *graphdb.Entity) []*graphdb.Entity {
+	values := prop.Referencing("block/closed-value-property")
+	graphdb.SortByOrder(values)
+	return values
+}
+
+func (r graphReader) ListProperties(ctx context.Context, graph string, expand bool) ([]Property, error) {
+	db, err := r.load(ctx, graph)
+	if err != nil {
+		return nil, err
+	}
+	var props []Property
+	for _, e := range db.Properties() {
+		prop := Property{UUID: e.UUID(), Title: e.Title()}
+		if expand {
+			prop.Ident = e.Ident()
+			prop.Type = propertyType(e)
+			prop.Cardinality = e.String("db/cardinality")
+			prop.Classes = identList(e, "logseq.property/classes")
+			prop.Description = propertyValueText(e, "logseq.property/description")
+			prop.Public = e.Bool("logseq.property/public?")
+			for _, v := range closedValues(e) {
+				prop.ClosedValues = append(prop.ClosedValues, v.Title())
+			}
+			prop.CreatedAt = timeAttr(e, "block/created-at")
+			prop.UpdatedAt = timeAttr(e, "block/updated-at")
+		}
+		props = append(props, prop)
+	}
+	return props, nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/slimslenderslacks/mcp-logseq/graphdb"
+)
+
+// snapshotReader reads db for every graph.
+func snapshotReader(db *graphdb.DB) graphReader {
+	return graphReader{load: func(ctx context.Context, graph string) (*graphdb.DB, error) {
+		return db, nil
+	}}
+}
+
+func TestGetReferencesUnresolvedPage(t *testing.T) {
+	schema := map[string]graphdb.Attribute{
+		"block/uuid": {Unique: true},
+		"block/name": {Unique: true},
+		"block/page": {Ref: true},
+	}
+	db := graphdb.New(schema, []graphdb.Datom{
+		{E: 1, A: "block/name", V: "project", Tx: 1, Added: true},
+		{E: 1, A: "block/title", V: "Project", Tx: 1, Added: true},
+		{E: 1, A: "block/uuid", V: graphdb.UUID("00000000-0000-0000-0000-000000000001"), Tx: 1, Added: true},
+		// Block 2's page, 9, is not in the snapshot.
+		{E: 2, A: "block/title", V: "The project plan", Tx: 1, Added: true},
+		{E: 2, A: "block/page", V: int64(9), Tx: 1, Added: true},
+		{E: 2, A: "block/uuid", V: graphdb.UUID("00000000-0000-0000-0000-000000000002"), Tx: 1, Added: true},
+	})
+
+	refs, err := snapshotReader(db).GetReferences(context.Background(), "mcp", "project")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refs.Unlinked) != 1 || len(refs.Unlinked[0].References) != 1 || refs.Unlinked[0].References[0].ID != 2 {
+		t.Errorf("unlinked references = %+v, want block 2", refs.Unlinked)
+	}
+}
+
+func TestPropertyValueDatetime(t *testing.T) {
+	schema := map[string]graphdb.Attribute{
+		"db/ident":              {Unique: true},
+		"logseq.property/type":  {Ref: true},
+		"user.property/due":     {},
+		"user.property/started": {},
+	}
+	db := graphdb.New(schema, []graphdb.Datom{
+		{E: 1, A: "db/ident", V: graphdb.Keyword("datetime"), Tx: 1, Added: true},
+		// The type as a ref to its ident, and as a keyword.
+		{E: 2, A: "db/ident", V: graphdb.Keyword("user.property/due"), Tx: 1, Added: true},
+		{E: 2, A: "logseq.property/type", V: int64(1), Tx: 1, Added: true},
+		{E: 3, A: "db/ident", V: graphdb.Keyword("user.property/started"), Tx: 1, Added: true},
+		{E: 3, A: "logseq.property/type", V: graphdb.Keyword("datetime"), Tx: 1, Added: true},
+	})
+	for _, ident := range []string{"user.property/due", "user.property/started"} {
+		prop := db.Ident(ident)
+		if got, want := propertyValue(db, prop, int64(1700000000000)), "2023-11-14T22:13:20Z"; got != want {
+			t.Errorf("%s value = %q, want %q", ident, got, want)
+		}
+	}
+}
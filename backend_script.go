@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/slimslenderslacks/mcp-logseq/graphdb"
+	"github.com/slimslenderslacks/mcp-logseq/logseqapi"
+)
+
+// scriptError is returned when an nbb-logseq script exits unsuccessfully.
+type scriptError struct {
+	err    error
+	output string
+}
+
+func (e *scriptError) Error() string {
+	if e.output == "" {
+		return fmt.Sprintf("Script execution failed: %v", e.err)
+	}
+	return fmt.Sprintf("Script execution failed: %v\nOutput: %s", e.err, e.output)
+}
+
+func (e *scriptError) Unwrap() error {
+	return e.err
+}
+
+// scriptBackend answers reads by running the ClojureScript scripts through
+// run-script.sh and nbb-logseq, in a pool of worker processes or in a new
+// process per call. Writes go to the HTTP API.
+type scriptBackend struct {
+	*apiWriter
+	runScript string
+	graphsDir string
+	workers   *workerPool   // nil to run each script in a new process
+	timeout   time.Duration // per script run without workers
+	search    *searchIndexes
+	snapshots *graphSnapshots
+}
+
+func newScriptBackend(runScript, graphsDir string, api *logseqapi.Client, readOnly func(graph string) bool, workers *workerPool, timeout time.Duration) *scriptBackend {
+	return &scriptBackend{
+		apiWriter: &apiWriter{api: api, readOnly: readOnly},
+		runScript: runScript,
+		graphsDir: graphsDir,
+		workers:   workers,
+		timeout:   timeout,
+		search:    newSearchIndexes(),
+		snapshots: newFileSnapshots(graphsDir),
+	}
+}
+
+// scriptResult is the single JSON document a script prints given --json.
+type scriptResult struct {
+	Result json.RawMessage `json:"result"`
+	Error  *BackendError   `json:"error"`
+}
+
+// run runs scriptName against graph and decodes its result into result,
+// in a worker when the backend has a pool and in a new process otherwise.
+// graph must name a database in the graphs directory. An error object
+// reported by the script is returned as a *BackendError.
+func (b *scriptBackend) run(ctx context.Context, scriptName, graph string, result any, extraArgs ...string) error {
+	dbPath, err := resolveGraphPath(b.graphsDir, graph)
+	if err != nil {
+		return err
+	}
+	args := append([]string{graph}, extraArgs...)
+
+	var doc *scriptResult
+	if b.workers != nil {
+		doc, err = b.workers.call(ctx, workerRequest{Script: scriptName, DBPath: dbPath, Args: args})
+		if err != nil {
+			return &scriptError{err: err}
+		}
+	} else if doc, err = b.spawn(ctx, scriptName, dbPath, args); err != nil {
+		return err
+	}
+	if doc.Error != nil {
+		return doc.Error
+	}
+	if err := json.Unmarshal(doc.Result, result); err != nil {
+		return &scriptError{err: fmt.Errorf("decoding %s result: %w", scriptName, err), output: string(doc.Result)}
+	}
+	return nil
+}
+
+// spawn runs scriptName in a new nbb-logseq process in JSON mode.
+func (b *scriptBackend) spawn(ctx context.Context, scriptName, dbPath string, args []string) (*scriptResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, b.timeout)
+	defer cancel()
+
+	// Build command arguments: script name, graph, then any extra args
+	cmdArgs := append([]string{scriptName}, args...)
+	cmdArgs = append(cmdArgs, "--json")
+
+	// The scripts open the database at LOGSEQ_DB_PATH rather than building
+	// a path from the graph argument.
+	cmd := exec.CommandContext(ctx, b.runScript, cmdArgs...)
+	cmd.Env = append(os.Environ(),
+		"LOGSEQ_DB_PATH="+dbPath,
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	stdout, runErr := cmd.Output()
+	doc, decodeErr := decodeScriptOutput(stdout)
+	switch {
+	case decodeErr == nil && doc.Error != nil:
+		return doc, nil
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return nil, &scriptError{err: fmt.Errorf("%s timed out after %s", scriptName, b.timeout), output: string(stdout) + stderr.String()}
+	case runErr != nil:
+		return nil, &scriptError{err: runErr, output: string(stdout) + stderr.String()}
+	case decodeErr != nil:
+		return nil, &scriptError{err: decodeErr, output: string(stdout) + stderr.String()}
+	}
+	return doc, nil
+}
+
+// decodeScriptOutput finds the JSON document in a script's stdout. It is
+// the last line, since nbb-logseq and the Logseq libraries may print
+// warnings before it.
+func decodeScriptOutput(stdout []byte) (*scriptResult, error) {
+	lines := bytes.Split(bytes.TrimSpace(stdout), []byte("\n"))
+	last := lines[len(lines)-1]
+	if !bytes.HasPrefix(last, []byte("{")) {
+		return nil, errors.New("script printed no JSON result")
+	}
+	var doc scriptResult
+	if err := json.Unmarshal(last, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Error == nil && doc.Result == nil {
+		return nil, errors.New("script printed neither a result nor an error")
+	}
+	return &doc, nil
+}
+
+func (b *scriptBackend) ListTasks(ctx context.Context, graph string) ([]Task, error) {
+	var tasks []Task
+	err := b.run(ctx, "list_all_tasks.cljs", graph, &tasks)
+	return tasks, err
+}
+
+func (b *scriptBackend) FindTasks(ctx context.Context, graph string, filter TaskFilter) ([]Task, error) {
+	criteria, err := json.Marshal(filter)
+	if err != nil {
+		return nil, err
+	}
+	var tasks []Task
+	err = b.run(ctx, "find_tasks.cljs", graph, &tasks, string(criteria))
+	return tasks, err
+}
+
+func (b *scriptBackend) ListPages(ctx context.Context, graph string, expand bool) ([]Page, error) {
+	var pages []Page
+	err := b.run(ctx, "list_pages.cljs", graph, &pages, fmt.Sprint(expand))
+	return pages, err
+}
+
+func (b *scriptBackend) GetPage(ctx context.Context, graph, pageName string) (*PageContent, error) {
+	var content PageContent
+	if err := b.run(ctx, "get_page.cljs", graph, &content, pageName); err != nil {
+		return nil, err
+	}
+	return &content, nil
+}
+
+func (b *scriptBackend) GetBlockTree(ctx context.Context, graph, pageOrBlockID string) (*BlockTree, error) {
+	var tree BlockTree
+	if err := b.run(ctx, "get_block_tree.cljs", graph, &tree, pageOrBlockID); err != nil {
+		return nil, err
+	}
+	return &tree, nil
+}
+
+func (b *scriptBackend) GetReferences(ctx context.Context, graph, pageOrBlockID string) (*References, error) {
+	var refs References
+	if err := b.run(ctx, "get_references.cljs", graph, &refs, pageOrBlockID); err != nil {
+		return nil, err
+	}
+	return &refs, nil
+}
+
+// open reads graph with graphdb, for the work that is done in the server
+// rather than in a script. Calls share a snapshot until the graph changes.
+func (b *scriptBackend) open(ctx context.Context, graph string) (*graphdb.DB, error) {
+	return b.snapshots.load(ctx, graph)
+}
+
+func (b *scriptBackend) Version(ctx context.Context, graph string) (string, error) {
+	return graphVersion(b.graphsDir, graph)
+}
+
+// Snapshot reads the database with graphdb, as the scripts return tool
+// output rather than datoms.
+func (b *scriptBackend) Snapshot(ctx context.Context, graph string) (*graphdb.DB, error) {
+	return b.open(ctx, graph)
+}
+
+// Search reads the database with graphdb rather than a script, so that
+// the index lives in the server between queries.
+func (b *scriptBackend) Search(ctx context.Context, graph string, q SearchQuery) (*SearchResults, error) {
+	path, err := resolveGraphPath(b.graphsDir, graph)
+	if err != nil {
+		return nil, err
+	}
+	return b.search.search(ctx, graph, fileVersion(path), b.open, q)
+}
+
+// CompleteTask reads the task from db.sqlite to roll a repeating one
+// forward.
+func (b *scriptBackend) CompleteTask(ctx context.Context, args CompleteTaskArgs) (*TaskUpdate, error) {
+	graph, err := b.targetGraph(ctx, args.Graph)
+	if err != nil {
+		return nil, err
+	}
+	db, err := b.open(ctx, graph)
+	if err != nil {
+		return nil, err
+	}
+	return b.completeTask(ctx, db, args)
+}
+
+// CreatePage checks the page's properties with graphdb, like
+// SetBlockProperty.
+func (b *scriptBackend) CreatePage(ctx context.Context, args CreatePageArgs) (*logseqapi.BlockEntity, int, error) {
+	graph, err := b.targetGraph(ctx, args.Graph)
+	if err != nil {
+		return nil, 0, err
+	}
+	db, err := b.open(ctx, graph)
+	if err != nil {
+		return nil, 0, err
+	}
+	return b.createPage(ctx, db, args)
+}
+
+// SetPageProperty checks the value with graphdb, like SetBlockProperty.
+func (b *scriptBackend) SetPageProperty(ctx context.Context, args SetPagePropertyArgs) error {
+	graph, err := b.targetGraph(ctx, args.Graph)
+	if err != nil {
+		return err
+	}
+	db, err := b.open(ctx, graph)
+	if err != nil {
+		return err
+	}
+	return b.setPageProperty(ctx, db, args)
+}
+
+// SetBlockProperty checks the value with graphdb, like Search, before
+// writing it through the API.
+func (b *scriptBackend) SetBlockProperty(ctx context.Context, args SetBlockPropertyArgs) (*PropertyChange, error) {
+	graph, err := b.targetGraph(ctx, args.Graph)
+	if err != nil {
+		return nil, err
+	}
+	db, err := b.open(ctx, graph)
+	if err != nil {
+		return nil, err
+	}
+	return b.setBlockProperty(ctx, db, args)
+}
+
+func (b *scriptBackend) RemoveBlockProperty(ctx context.Context, args RemoveBlockPropertyArgs) (*PropertyChange, error) {
+	graph, err := b.targetGraph(ctx, args.Graph)
+	if err != nil {
+		return nil, err
+	}
+	db, err := b.open(ctx, graph)
+	if err != nil {
+		return nil, err
+	}
+	return b.removeBlockProperty(ctx, db, args)
+}
+
+// AppendToJournal reads the journal page and date format with graphdb,
+// like SetBlockProperty.
+func (b *scriptBackend) AppendToJournal(ctx context.Context, args AppendToJournalArgs) (*JournalEntry, error) {
+	graph, err := b.targetGraph(ctx, args.Graph)
+	if err != nil {
+		return nil, err
+	}
+	db, err := b.open(ctx, graph)
+	if err != nil {
+		return nil, err
+	}
+	return b.appendToJournal(ctx, db, args)
+}
+
+func (b *scriptBackend) ListJournals(ctx context.Context, graph string, from, to int) ([]Page, error) {
+	var journals []Page
+	err := b.run(ctx, "list_journals.cljs", graph, &journals, strconv.Itoa(from), strconv.Itoa(to))
+	return journals, err
+}
+
+func (b *scriptBackend) ListTags(ctx context.Context, graph string, expand bool) ([]Tag, error) {
+	var tags []Tag
+	err := b.run(ctx, "list_tags.cljs", graph, &tags, fmt.Sprint(expand))
+	return tags, err
+}
+
+func (b *scriptBackend) ListProperties(ctx context.Context, graph string, expand bool) ([]Property, error) {
+	var props []Property
+	err := b.run(ctx, "list_properties.cljs", graph, &props, fmt.Sprint(expand))
+	return props, err
+}
+
+func (b *scriptBackend) ListGraphs(ctx context.Context) ([]string, error) {
+	return scanGraphs(b.graphsDir)
+}
+
+func (b *scriptBackend) GraphInfo(ctx context.Context, graph string) (*Graph, error) {
+	g := &Graph{Name: graph}
+	if err := statGraph(b.graphsDir, g); err != nil {
+		return nil, err
+	}
+	if err := b.run(ctx, "graph_stats.cljs", graph, g); err != nil {
+		return nil, err
+	}
+	g.Current = b.isCurrentGraph(ctx, graph)
+	return g, nil
+}
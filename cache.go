@@ -0,0 +1,375 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"github.com/slimslenderslacks/mcp-logseq/graphdb"
+	"github.com/slimslenderslacks/mcp-logseq/logseqapi"
+)
+
+// Graph data is cached at two levels. Backends that read graphs with
+// graphdb keep the latest snapshot of each graph, so that every read of a
+// graph in one state, and the watcher, completions and search, share one
+// decoding of db.sqlite. In front of the backend, the results of reads of
+// tasks, pages, journals, tags, properties and page trees are cached per
+// graph and query.
+//
+// Both are keyed by the version of the graph they were read from, so that
+// they are dropped once db.sqlite or its write-ahead log changes, whoever
+// changed it. Writes through this server drop their graph's results
+// straight away, and results expire after a TTL and are evicted least
+// recently used first to keep the cache under a size limit. Concurrent
+// identical reads share one call to the backend.
+
+// cacheKey identifies a read: the graph, what is read and its arguments.
+type cacheKey struct {
+	graph, kind, arg string
+}
+
+type cacheEntry struct {
+	key     cacheKey
+	version string
+	value   any
+	size    int64
+	expires time.Time // zero if it does not expire
+}
+
+// graphCache holds the results of reads. Cached values are shared by
+// every caller, which must not modify them.
+type graphCache struct {
+	ttl      time.Duration
+	maxBytes int64
+	reads    singleflight.Group
+
+	mu      sync.Mutex
+	entries map[cacheKey]*list.Element
+	lru     *list.List // of *cacheEntry, most recently used first
+	size    int64
+	// epoch counts invalidations of every graph, generations those of
+	// one graph. A read only caches its result if neither moved while it
+	// ran, so that a read racing a write does not cache what it read.
+	epoch       uint64
+	generations map[string]uint64
+}
+
+func newGraphCache(ttl time.Duration, maxBytes int64) *graphCache {
+	return &graphCache{
+		ttl:         ttl,
+		maxBytes:    maxBytes,
+		entries:     make(map[cacheKey]*list.Element),
+		lru:         list.New(),
+		generations: make(map[string]uint64),
+	}
+}
+
+// generation identifies the invalidations of graph so far. c.mu must be
+// held.
+func (c *graphCache) generation(graph string) uint64 {
+	return c.epoch + c.generations[graph]
+}
+
+// lookup returns the value cached for key at version, and the generation
+// to store a freshly read value at otherwise.
+func (c *graphCache) lookup(key cacheKey, version string) (any, bool, uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		e := elem.Value.(*cacheEntry)
+		if e.version == version && (e.expires.IsZero() || time.Now().Before(e.expires)) {
+			c.lru.MoveToFront(elem)
+			return e.value, true, 0
+		}
+		c.remove(elem)
+	}
+	return nil, false, c.generation(key.graph)
+}
+
+// store caches value for key at version unless the graph was invalidated
+// since generation, evicting the least recently used entries to make room.
+// A value too big for the whole cache is not stored.
+func (c *graphCache) store(key cacheKey, version string, generation uint64, value any) {
+	data, err := json.Marshal(value)
+	if err != nil || int64(len(data)) > c.maxBytes {
+		return
+	}
+	e := &cacheEntry{key: key, version: version, value: value, size: int64(len(data))}
+	if c.ttl > 0 {
+		e.expires = time.Now().Add(c.ttl)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.generation(key.graph) != generation {
+		return
+	}
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+	c.entries[key] = c.lru.PushFront(e)
+	c.size += e.size
+	for c.size > c.maxBytes {
+		c.remove(c.lru.Back())
+	}
+}
+
+// remove drops an entry. c.mu must be held.
+func (c *graphCache) remove(elem *list.Element) {
+	e := c.lru.Remove(elem).(*cacheEntry)
+	delete(c.entries, e.key)
+	c.size -= e.size
+}
+
+// invalidate drops the entries of graph, or of every graph if graph is "".
+func (c *graphCache) invalidate(graph string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if graph == "" {
+		c.epoch++
+	} else {
+		c.generations[graph]++
+	}
+	for elem := c.lru.Front(); elem != nil; {
+		next := elem.Next()
+		if graph == "" || elem.Value.(*cacheEntry).key.graph == graph {
+			c.remove(elem)
+		}
+		elem = next
+	}
+}
+
+// cachedRead returns the cached result of the read key of b's graph, or
+// runs read and caches its result. A graph whose version cannot be told is
+// read without the cache.
+func cachedRead[T any](ctx context.Context, b *cachedBackend, key cacheKey, read func(ctx context.Context) (T, error)) (T, error) {
+	version, err := b.Backend.Version(ctx, key.graph)
+	if err != nil {
+		return read(ctx)
+	}
+	if value, ok, _ := b.cache.lookup(key, version); ok {
+		return value.(T), nil
+	}
+	return shared(ctx, &b.cache.reads, strings.Join([]string{key.graph, key.kind, key.arg, version}, "\x00"), func(ctx context.Context) (T, error) {
+		// Another read may have filled the entry while this one waited.
+		cached, ok, generation := b.cache.lookup(key, version)
+		if ok {
+			return cached.(T), nil
+		}
+		value, err := read(ctx)
+		if err == nil {
+			b.cache.store(key, version, generation, value)
+		}
+		return value, err
+	})
+}
+
+// shared runs fn once for all the concurrent calls with the same key. fn
+// runs under ctx without its cancellation, as the callers share it: a
+// caller whose ctx is done returns straight away, leaving fn to the rest.
+func shared[T any](ctx context.Context, group *singleflight.Group, key string, fn func(ctx context.Context) (T, error)) (T, error) {
+	results := group.DoChan(key, func() (any, error) {
+		return fn(context.WithoutCancel(ctx))
+	})
+	select {
+	case r := <-results:
+		if r.Err != nil {
+			var zero T
+			return zero, r.Err
+		}
+		return r.Val.(T), nil
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// graphSnapshots keeps the latest snapshot of each graph with the version
+// it was read at, and reads a graph again once its version moves on.
+type graphSnapshots struct {
+	version func(ctx context.Context, graph string) (string, error)
+	open    func(ctx context.Context, graph string) (*graphdb.DB, error)
+	opens   singleflight.Group
+
+	mu      sync.Mutex
+	byGraph map[string]*graphSnapshot
+}
+
+type graphSnapshot struct {
+	version string
+	db      *graphdb.DB
+}
+
+func newGraphSnapshots(version func(ctx context.Context, graph string) (string, error), open func(ctx context.Context, graph string) (*graphdb.DB, error)) *graphSnapshots {
+	return &graphSnapshots{version: version, open: open, byGraph: make(map[string]*graphSnapshot)}
+}
+
+// newFileSnapshots reads the graphs in dir from their db.sqlite files.
+func newFileSnapshots(dir string) *graphSnapshots {
+	return newGraphSnapshots(func(ctx context.Context, graph string) (string, error) {
+		return graphVersion(dir, graph)
+	}, func(ctx context.Context, graph string) (*graphdb.DB, error) {
+		path, err := resolveGraphPath(dir, graph)
+		if err != nil {
+			return nil, err
+		}
+		return graphdb.Open(ctx, path)
+	})
+}
+
+// load returns the snapshot of graph at its current version. Snapshots
+// are immutable, so callers share them.
+func (s *graphSnapshots) load(ctx context.Context, graph string) (*graphdb.DB, error) {
+	version, err := s.version(ctx, graph)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	snap := s.byGraph[graph]
+	s.mu.Unlock()
+	if snap != nil && snap.version == version {
+		return snap.db, nil
+	}
+	return shared(ctx, &s.opens, graph+"\x00"+version, func(ctx context.Context) (*graphdb.DB, error) {
+		db, err := s.open(ctx, graph)
+		if err != nil {
+			return nil, err
+		}
+		s.mu.Lock()
+		s.byGraph[graph] = &graphSnapshot{version: version, db: db}
+		s.mu.Unlock()
+		return db, nil
+	})
+}
+
+// cachedBackend answers reads from a graphCache in front of another
+// backend, and drops a graph's entries when it is written to through it.
+type cachedBackend struct {
+	Backend
+	cache *graphCache
+}
+
+func newCachedBackend(backend Backend, ttl time.Duration, maxBytes int64) *cachedBackend {
+	return &cachedBackend{Backend: backend, cache: newGraphCache(ttl, maxBytes)}
+}
+
+func (b *cachedBackend) ListTasks(ctx context.Context, graph string) ([]Task, error) {
+	return cachedRead(ctx, b, cacheKey{graph, "tasks", ""}, func(ctx context.Context) ([]Task, error) {
+		return b.Backend.ListTasks(ctx, graph)
+	})
+}
+
+func (b *cachedBackend) ListPages(ctx context.Context, graph string, expand bool) ([]Page, error) {
+	return cachedRead(ctx, b, cacheKey{graph, "pages", strconv.FormatBool(expand)}, func(ctx context.Context) ([]Page, error) {
+		return b.Backend.ListPages(ctx, graph, expand)
+	})
+}
+
+func (b *cachedBackend) GetPage(ctx context.Context, graph, pageName string) (*PageContent, error) {
+	return cachedRead(ctx, b, cacheKey{graph, "page", strings.ToLower(pageName)}, func(ctx context.Context) (*PageContent, error) {
+		return b.Backend.GetPage(ctx, graph, pageName)
+	})
+}
+
+func (b *cachedBackend) GetBlockTree(ctx context.Context, graph, pageOrBlockID string) (*BlockTree, error) {
+	return cachedRead(ctx, b, cacheKey{graph, "tree", strings.ToLower(pageOrBlockID)}, func(ctx context.Context) (*BlockTree, error) {
+		return b.Backend.GetBlockTree(ctx, graph, pageOrBlockID)
+	})
+}
+
+func (b *cachedBackend) ListJournals(ctx context.Context, graph string, from, to int) ([]Page, error) {
+	return cachedRead(ctx, b, cacheKey{graph, "journals", strconv.Itoa(from) + "-" + strconv.Itoa(to)}, func(ctx context.Context) ([]Page, error) {
+		return b.Backend.ListJournals(ctx, graph, from, to)
+	})
+}
+
+func (b *cachedBackend) ListTags(ctx context.Context, graph string, expand bool) ([]Tag, error) {
+	return cachedRead(ctx, b, cacheKey{graph, "tags", strconv.FormatBool(expand)}, func(ctx context.Context) ([]Tag, error) {
+		return b.Backend.ListTags(ctx, graph, expand)
+	})
+}
+
+func (b *cachedBackend) ListProperties(ctx context.Context, graph string, expand bool) ([]Property, error) {
+	return cachedRead(ctx, b, cacheKey{graph, "properties", strconv.FormatBool(expand)}, func(ctx context.Context) ([]Property, error) {
+		return b.Backend.ListProperties(ctx, graph, expand)
+	})
+}
+
+// Writes drop the entries of their graph, or of every graph when the
+// write goes to whichever graph the Logseq app has open. They do so even
+// when they fail, as a write may have got part of the way.
+
+func (b *cachedBackend) CreateTask(ctx context.Context, args CreateTaskArgs) (*logseqapi.BlockEntity, error) {
+	defer b.cache.invalidate(args.Graph)
+	return b.Backend.CreateTask(ctx, args)
+}
+
+func (b *cachedBackend) CompleteTask(ctx context.Context, args CompleteTaskArgs) (*TaskUpdate, error) {
+	defer b.cache.invalidate(args.Graph)
+	return b.Backend.CompleteTask(ctx, args)
+}
+
+func (b *cachedBackend) UpdateTask(ctx context.Context, args UpdateTaskArgs) error {
+	defer b.cache.invalidate(args.Graph)
+	return b.Backend.UpdateTask(ctx, args)
+}
+
+func (b *cachedBackend) AddContent(ctx context.Context, args AddContentArgs) (*logseqapi.BlockEntity, error) {
+	defer b.cache.invalidate(args.Graph)
+	return b.Backend.AddContent(ctx, args)
+}
+
+func (b *cachedBackend) AppendToJournal(ctx context.Context, args AppendToJournalArgs) (*JournalEntry, error) {
+	defer b.cache.invalidate(args.Graph)
+	return b.Backend.AppendToJournal(ctx, args)
+}
+
+func (b *cachedBackend) MoveBlock(ctx context.Context, args MoveBlockArgs) error {
+	defer b.cache.invalidate(args.Graph)
+	return b.Backend.MoveBlock(ctx, args)
+}
+
+func (b *cachedBackend) DeleteBlock(ctx context.Context, args DeleteBlockArgs) error {
+	defer b.cache.invalidate(args.Graph)
+	return b.Backend.DeleteBlock(ctx, args)
+}
+
+func (b *cachedBackend) IndentBlock(ctx context.Context, args IndentBlockArgs, outdent bool) error {
+	defer b.cache.invalidate(args.Graph)
+	return b.Backend.IndentBlock(ctx, args, outdent)
+}
+
+func (b *cachedBackend) CreatePage(ctx context.Context, args CreatePageArgs) (*logseqapi.BlockEntity, int, error) {
+	defer b.cache.invalidate(args.Graph)
+	return b.Backend.CreatePage(ctx, args)
+}
+
+func (b *cachedBackend) RenamePage(ctx context.Context, args RenamePageArgs) error {
+	defer b.cache.invalidate(args.Graph)
+	return b.Backend.RenamePage(ctx, args)
+}
+
+func (b *cachedBackend) DeletePage(ctx context.Context, args DeletePageArgs) error {
+	defer b.cache.invalidate(args.Graph)
+	return b.Backend.DeletePage(ctx, args)
+}
+
+func (b *cachedBackend) SetPageProperty(ctx context.Context, args SetPagePropertyArgs) error {
+	defer b.cache.invalidate(args.Graph)
+	return b.Backend.SetPageProperty(ctx, args)
+}
+
+func (b *cachedBackend) SetBlockProperty(ctx context.Context, args SetBlockPropertyArgs) (*PropertyChange, error) {
+	defer b.cache.invalidate(args.Graph)
+	return b.Backend.SetBlockProperty(ctx, args)
+}
+
+func (b *cachedBackend) RemoveBlockProperty(ctx context.Context, args RemoveBlockPropertyArgs) (*PropertyChange, error) {
+	defer b.cache.invalidate(args.Graph)
+	return b.Backend.RemoveBlockProperty(ctx, args)
+}
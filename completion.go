@@ -0,0 +1,240 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/slimslenderslacks/mcp-logseq/graphdb"
+)
+
+// completion/complete suggests values for prompt and resource template
+// arguments by the argument's name: graph names, page titles, tags,
+// properties, journal dates and the values of status and priority. All but
+// the graph names come from an index of the graph given in the request's
+// context, or the default graph, which is rebuilt when the graph changes.
+
+// maxCompletions is the most values a completion can return.
+const maxCompletions = 100
+
+// Arguments completed with the values of each kind. "name" is a page
+// unless the reference is the tag resource template.
+var (
+	pageArguments     = []string{"name", "page", "pageName", "pageOrBlockId", "parent", "target"}
+	tagArguments      = []string{"tag", "tags"}
+	propertyArguments = []string{"property", "key"}
+	dateArguments     = []string{"date", "from", "to"}
+)
+
+// completionIndex holds what completions are drawn from in one state of a
+// graph.
+type completionIndex struct {
+	version    string
+	pages      []string
+	tags       []string
+	properties []string
+	// journals holds the days of the journal pages as YYYY-MM-DD, most
+	// recent first.
+	journals   []string
+	statuses   []string
+	priorities []string
+}
+
+func newCompletionIndex(version string, db *graphdb.DB) *completionIndex {
+	idx := &completionIndex{version: version}
+	for _, e := range db.Pages() {
+		idx.pages = append(idx.pages, e.Title())
+	}
+	for _, e := range db.Tags() {
+		idx.tags = append(idx.tags, e.Title())
+	}
+	for _, e := range db.Properties() {
+		// Built-in properties the Logseq app hides are not offered.
+		if !e.Has("logseq.property/public?") || e.Bool("logseq.property/public?") {
+			idx.properties = append(idx.properties, e.Title())
+		}
+	}
+	for _, e := range db.Journals(0, 0) {
+		idx.journals = append(idx.journals, dayOfJournal(int(e.Int("block/journal-day"))).Format(time.DateOnly))
+	}
+	for _, p := range []struct {
+		ident  string
+		values *[]string
+	}{{graphdb.PropertyStatus, &idx.statuses}, {graphdb.PropertyPriority, &idx.priorities}} {
+		if prop := db.Ident(p.ident); prop != nil {
+			for _, v := range closedValues(prop) {
+				*p.values = append(*p.values, v.Title())
+			}
+		}
+	}
+	return idx
+}
+
+// completionIndexes caches a completion index per graph.
+type completionIndexes struct {
+	backend Backend
+
+	mu      sync.Mutex
+	indexes map[string]*completionIndex
+}
+
+func newCompletionIndexes(backend Backend) *completionIndexes {
+	return &completionIndexes{backend: backend, indexes: make(map[string]*completionIndex)}
+}
+
+// get returns the index of graph, rebuilding it if the graph has changed
+// since it was built. The graph is read without holding c.mu, so that a
+// slow graph does not hold up completions for the others.
+func (c *completionIndexes) get(ctx context.Context, graph string) (*completionIndex, error) {
+	version, err := c.backend.Version(ctx, graph)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	idx := c.indexes[graph]
+	c.mu.Unlock()
+	if idx != nil && idx.version == version {
+		return idx, nil
+	}
+	db, err := c.backend.Snapshot(ctx, graph)
+	if err != nil {
+		return nil, err
+	}
+	idx = newCompletionIndex(version, db)
+	c.mu.Lock()
+	c.indexes[graph] = idx
+	c.mu.Unlock()
+	return idx, nil
+}
+
+// complete answers completion/complete. An argument it has nothing to
+// suggest for, or a graph it cannot read, gets no values rather than an
+// error, as the client is only asking for hints.
+func (m *MCPServer) complete(ctx context.Context, req *mcp.CompleteRequest) (*mcp.CompleteResult, error) {
+	arg := req.Params.Argument
+	candidates, err := m.completionCandidates(ctx, req.Params)
+	if err != nil {
+		log.Printf("Completing %s: %v", arg.Name, err)
+	}
+	values := completeValue(candidates, arg.Value)
+	result := &mcp.CompleteResult{Completion: mcp.CompletionResultDetails{Values: values, Total: len(values)}}
+	if len(values) > maxCompletions {
+		result.Completion.Values = values[:maxCompletions]
+		result.Completion.HasMore = true
+	}
+	return result, nil
+}
+
+// completionCandidates returns the values an argument can take.
+func (m *MCPServer) completionCandidates(ctx context.Context, params *mcp.CompleteParams) ([]string, error) {
+	name := params.Argument.Name
+	if name == "graph" {
+		return m.graphNames(ctx)
+	}
+	var graph string
+	if params.Context != nil {
+		graph = params.Context.Arguments["graph"]
+	}
+	graph, err := m.cfg.resolveGraph(graph)
+	if err != nil {
+		return nil, nil
+	}
+	idx, err := m.completions.get(ctx, graph)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case slices.Contains(tagArguments, name),
+		name == "name" && params.Ref != nil && params.Ref.URI == tagResourceTemplate:
+		return idx.tags, nil
+	case slices.Contains(pageArguments, name):
+		return idx.pages, nil
+	case slices.Contains(propertyArguments, name):
+		return idx.properties, nil
+	case slices.Contains(dateArguments, name):
+		return slices.Concat([]string{"today", "yesterday"}, idx.journals), nil
+	case name == "status":
+		return idx.statuses, nil
+	case name == "priority":
+		return idx.priorities, nil
+	}
+	return nil, nil
+}
+
+// graphNames returns the graphs the backend can read and their aliases.
+func (m *MCPServer) graphNames(ctx context.Context) ([]string, error) {
+	names, err := m.backend.ListGraphs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range m.cfg.Graphs {
+		if g != nil {
+			names = append(names, g.Aliases...)
+		}
+	}
+	return names, nil
+}
+
+// completeValue returns the candidates that complete value, best first:
+// those that start with it, then those with a word that starts with it,
+// then those that hold its characters in order. Case is ignored, and
+// candidates that match as well keep their order: pages by title, journals
+// most recent first and closed values in the order the Logseq app shows.
+func completeValue(candidates []string, value string) []string {
+	type match struct {
+		value string
+		rank  int
+	}
+	value = strings.ToLower(value)
+	seen := make(map[string]bool)
+	var matches []match
+	for _, c := range candidates {
+		if seen[c] {
+			continue
+		}
+		seen[c] = true
+		if rank := matchRank(strings.ToLower(c), value); rank >= 0 {
+			matches = append(matches, match{c, rank})
+		}
+	}
+	slices.SortStableFunc(matches, func(a, b match) int {
+		return cmp.Compare(a.rank, b.rank)
+	})
+	values := make([]string, len(matches))
+	for i, m := range matches {
+		values[i] = m.value
+	}
+	return values
+}
+
+// matchRank ranks how candidate completes value, both lower-cased, or
+// returns -1 if it does not.
+func matchRank(candidate, value string) int {
+	if strings.HasPrefix(candidate, value) {
+		return 0
+	}
+	words := strings.FieldsFunc(candidate, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, w := range words {
+		if strings.HasPrefix(w, value) {
+			return 1
+		}
+	}
+	rest := candidate
+	for _, r := range value {
+		i := strings.IndexRune(rest, r)
+		if i < 0 {
+			return -1
+		}
+		rest = rest[i+len(string(r)):]
+	}
+	return 2
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/slimslenderslacks/mcp-logseq/logseqapi"
+)
+
+const (
+	defaultScriptRoot    = "/app/mcp-logseq"
+	defaultScriptWorkers = 2
+	defaultScriptTimeout = 60 * time.Second
+	defaultWatchInterval = 2 * time.Second
+	defaultCacheTTL      = 5 * time.Minute
+	defaultCacheSizeMB   = 64
+)
+
+// Config is the server configuration. It is read from the YAML file named
+// by --config or LOGSEQ_CONFIG, and environment variables override it:
+//
+//	graphsDir: /root/logseq/graphs   # LOGSEQ_GRAPHS_DIR
+//	defaultGraph: mcp                # LOGSEQ_DEFAULT_GRAPH
+//	backend: script                  # LOGSEQ_BACKEND
+//	scriptRoot: /app/mcp-logseq      # LOGSEQ_SCRIPT_ROOT
+//	scriptWorkers: 2                 # LOGSEQ_SCRIPT_WORKERS, 0 for a process per call
+//	scriptTimeout: 60s               # LOGSEQ_SCRIPT_TIMEOUT
+//	watchInterval: 2s                # LOGSEQ_WATCH_INTERVAL, how often subscribed graphs are checked for changes
+//	cacheTTL: 5m                     # LOGSEQ_CACHE_TTL, 0 to keep reads until their graph changes
+//	cacheSizeMB: 64                  # LOGSEQ_CACHE_SIZE_MB, 0 to disable the read cache
+//	readOnly: false                  # LOGSEQ_READ_ONLY
+//	tools: [list_all_tasks, find_tasks]  # LOGSEQ_TOOLS, empty for all
+//	denyTools: [add_content]         # LOGSEQ_DENY_TOOLS
+//	api:
+//	  host: host.docker.internal     # LOGSEQ_API_HOST
+//	  port: 12315                    # LOGSEQ_API_PORT
+//	  token: secret                  # LOGSEQ_API_AUTHORIZATION_TOKEN
+//	graphs:
+//	  mcp:
+//	    aliases: [work]
+//	    backend: native              # LOGSEQ_GRAPH_BACKENDS=mcp=native
+//	    readOnly: true
+//	    api: {port: 12316}
+type Config struct {
+	GraphsDir     string                  `yaml:"graphsDir"`
+	DefaultGraph  string                  `yaml:"defaultGraph"`
+	Backend       string                  `yaml:"backend"`
+	ScriptRoot    string                  `yaml:"scriptRoot"`
+	ScriptWorkers int                     `yaml:"scriptWorkers"`
+	ScriptTimeout time.Duration           `yaml:"scriptTimeout"`
+	WatchInterval time.Duration           `yaml:"watchInterval"`
+	CacheTTL      time.Duration           `yaml:"cacheTTL"`
+	CacheSizeMB   int                     `yaml:"cacheSizeMB"`
+	ReadOnly      bool                    `yaml:"readOnly"`
+	Tools         []string                `yaml:"tools"`
+	DenyTools     []string                `yaml:"denyTools"`
+	API           APIConfig               `yaml:"api"`
+	Graphs        map[string]*GraphConfig `yaml:"graphs"`
+}
+
+// APIConfig locates a Logseq HTTP API server. Empty fields fall back to
+// the global api section, then to the logseqapi defaults.
+type APIConfig struct {
+	Host  string `yaml:"host"`
+	Port  string `yaml:"port"`
+	Token string `yaml:"token"`
+}
+
+// GraphConfig holds the settings of one graph.
+type GraphConfig struct {
+	Aliases  []string   `yaml:"aliases"`
+	Backend  string     `yaml:"backend"`
+	ReadOnly bool       `yaml:"readOnly"`
+	API      *APIConfig `yaml:"api"`
+}
+
+// loadConfig reads the config file at path, if any, and applies the
+// environment on top.
+func loadConfig(path string) (*Config, error) {
+	// Defaults that a zero value may override are set before decoding.
+	cfg := &Config{
+		ScriptWorkers: defaultScriptWorkers,
+		CacheTTL:      defaultCacheTTL,
+		CacheSizeMB:   defaultCacheSizeMB,
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading config: %w", err)
+		}
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("parsing config %s: %w", path, err)
+		}
+	}
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+	cfg.applyDefaults()
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+	return cfg, nil
+}
+
+func (c *Config) applyEnv() error {
+	envString := func(name string, dst *string) {
+		if v := os.Getenv(name); v != "" {
+			*dst = v
+		}
+	}
+	envString("LOGSEQ_GRAPHS_DIR", &c.GraphsDir)
+	envString("LOGSEQ_DEFAULT_GRAPH", &c.DefaultGraph)
+	envString("LOGSEQ_BACKEND", &c.Backend)
+	envString("LOGSEQ_SCRIPT_ROOT", &c.ScriptRoot)
+	envString("LOGSEQ_API_HOST", &c.API.Host)
+	envString("LOGSEQ_API_PORT", &c.API.Port)
+	envString("LOGSEQ_API_AUTHORIZATION_TOKEN", &c.API.Token)
+
+	if v := os.Getenv("LOGSEQ_SCRIPT_WORKERS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("LOGSEQ_SCRIPT_WORKERS: %w", err)
+		}
+		c.ScriptWorkers = n
+	}
+	if v := os.Getenv("LOGSEQ_SCRIPT_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("LOGSEQ_SCRIPT_TIMEOUT: %w", err)
+		}
+		c.ScriptTimeout = d
+	}
+	if v := os.Getenv("LOGSEQ_WATCH_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("LOGSEQ_WATCH_INTERVAL: %w", err)
+		}
+		c.WatchInterval = d
+	}
+	if v := os.Getenv("LOGSEQ_CACHE_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("LOGSEQ_CACHE_TTL: %w", err)
+		}
+		c.CacheTTL = d
+	}
+	if v := os.Getenv("LOGSEQ_CACHE_SIZE_MB"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("LOGSEQ_CACHE_SIZE_MB: %w", err)
+		}
+		c.CacheSizeMB = n
+	}
+	if v := os.Getenv("LOGSEQ_READ_ONLY"); v != "" {
+		c.ReadOnly = v == "1" || strings.EqualFold(v, "true")
+	}
+	if v := os.Getenv("LOGSEQ_TOOLS"); v != "" {
+		c.Tools = splitList(v)
+	}
+	if v := os.Getenv("LOGSEQ_DENY_TOOLS"); v != "" {
+		c.DenyTools = splitList(v)
+	}
+
+	// LOGSEQ_GRAPH_BACKENDS overrides the backend of individual graphs,
+	// e.g. "mcp=native,Demo=script".
+	if v := os.Getenv("LOGSEQ_GRAPH_BACKENDS"); v != "" {
+		for _, entry := range splitList(v) {
+			graph, backend, ok := strings.Cut(entry, "=")
+			if !ok || graph == "" {
+				return fmt.Errorf("LOGSEQ_GRAPH_BACKENDS: expected graph=backend, got %q", entry)
+			}
+			c.graph(graph).Backend = backend
+		}
+	}
+	return nil
+}
+
+func (c *Config) applyDefaults() {
+	if c.GraphsDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			home = "/root"
+		}
+		c.GraphsDir = filepath.Join(home, "logseq", "graphs")
+	}
+	if c.Backend == "" {
+		c.Backend = backendScript
+	}
+	if c.ScriptRoot == "" {
+		c.ScriptRoot = defaultScriptRoot
+	}
+	if c.ScriptTimeout == 0 {
+		c.ScriptTimeout = defaultScriptTimeout
+	}
+	if c.WatchInterval == 0 {
+		c.WatchInterval = defaultWatchInterval
+	}
+	for name, g := range c.Graphs {
+		// A graph listed without settings, e.g. "mcp:", decodes as nil.
+		if g == nil {
+			c.Graphs[name] = &GraphConfig{}
+		}
+	}
+}
+
+func (c *Config) validate() error {
+	backends := []string{backendScript, backendNative, backendMemory}
+	if !slices.Contains(backends, c.Backend) {
+		return fmt.Errorf("unknown backend %q (expected %s)", c.Backend, strings.Join(backends, ", "))
+	}
+	if c.ScriptWorkers < 0 {
+		return fmt.Errorf("scriptWorkers must not be negative")
+	}
+	if c.ScriptTimeout < 0 {
+		return fmt.Errorf("scriptTimeout must not be negative")
+	}
+	if c.WatchInterval < 0 {
+		return fmt.Errorf("watchInterval must not be negative")
+	}
+	if c.CacheTTL < 0 {
+		return fmt.Errorf("cacheTTL must not be negative")
+	}
+	if c.CacheSizeMB < 0 {
+		return fmt.Errorf("cacheSizeMB must not be negative")
+	}
+	if c.DefaultGraph != "" {
+		if err := checkGraphName(c.DefaultGraph); err != nil {
+			return fmt.Errorf("defaultGraph: %w", err)
+		}
+	}
+	names := make(map[string]string)
+	for name, g := range c.Graphs {
+		if err := checkGraphName(name); err != nil {
+			return fmt.Errorf("graphs: %w", err)
+		}
+		if g.Backend != "" && !slices.Contains(backends, g.Backend) {
+			return fmt.Errorf("graph %s: unknown backend %q (expected %s)", name, g.Backend, strings.Join(backends, ", "))
+		}
+		for _, alias := range g.Aliases {
+			if other, ok := names[alias]; ok {
+				return fmt.Errorf("alias %q is used by both %s and %s", alias, other, name)
+			}
+			if _, ok := c.Graphs[alias]; ok {
+				return fmt.Errorf("alias %q of %s is also a graph name", alias, name)
+			}
+			names[alias] = name
+		}
+	}
+	return nil
+}
+
+// graph returns the settings of a graph, adding an empty entry if there is
+// none.
+func (c *Config) graph(name string) *GraphConfig {
+	if c.Graphs == nil {
+		c.Graphs = make(map[string]*GraphConfig)
+	}
+	g, ok := c.Graphs[name]
+	if !ok || g == nil {
+		g = &GraphConfig{}
+		c.Graphs[name] = g
+	}
+	return g
+}
+
+// resolveGraph maps a graph argument to a graph name: aliases are replaced
+// by the graph they name and an empty argument by the default graph. Names
+// that could escape the graphs directory are rejected.
+func (c *Config) resolveGraph(graph string) (string, error) {
+	graph = strings.TrimSpace(graph)
+	if graph == "" {
+		if c.DefaultGraph == "" {
+			return "", fmt.Errorf("graph parameter is required")
+		}
+		graph = c.DefaultGraph
+	}
+	for name, g := range c.Graphs {
+		if slices.Contains(g.Aliases, graph) {
+			return name, nil
+		}
+	}
+	if err := checkGraphName(graph); err != nil {
+		return "", err
+	}
+	return graph, nil
+}
+
+// isReadOnly reports whether writes to graph are refused.
+func (c *Config) isReadOnly(graph string) bool {
+	if c.ReadOnly {
+		return true
+	}
+	g, ok := c.Graphs[graph]
+	return ok && g != nil && g.ReadOnly
+}
+
+// readOnlyGraphs returns the configured graphs that refuse writes, sorted.
+func (c *Config) readOnlyGraphs() []string {
+	var graphs []string
+	for name, g := range c.Graphs {
+		if g != nil && g.ReadOnly {
+			graphs = append(graphs, name)
+		}
+	}
+	slices.Sort(graphs)
+	return graphs
+}
+
+// usesBackend reports whether the default backend or a graph's backend is
+// name.
+func (c *Config) usesBackend(name string) bool {
+	if c.Backend == name {
+		return true
+	}
+	for _, g := range c.Graphs {
+		if g != nil && g.Backend == name {
+			return true
+		}
+	}
+	return false
+}
+
+// apiClient returns a client for the Logseq HTTP API of graph, or the
+// global one when graph has no api section.
+func (c *Config) apiClient(graph string) *logseqapi.Client {
+	api := c.API
+	if g, ok := c.Graphs[graph]; ok && g != nil && g.API != nil {
+		if g.API.Host != "" {
+			api.Host = g.API.Host
+		}
+		if g.API.Port != "" {
+			api.Port = g.API.Port
+		}
+		if g.API.Token != "" {
+			api.Token = g.API.Token
+		}
+	}
+	return logseqapi.New(api.Host, api.Port, api.Token)
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
@@ -0,0 +1,229 @@
+// Package graphdb reads Logseq DB graphs (db.sqlite) without Logseq.
+//
+// A graph is loaded into an in-memory snapshot of its DataScript datoms,
+// indexed by entity, attribute, :db/ident, :block/uuid and reverse
+// reference so that the queries the scripts run with datascript can be
+// answered in Go.
+package graphdb
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Datom is a single [entity attribute value tx] fact. Attributes are
+// keyword names without the leading colon, e.g. "block/title".
+type Datom struct {
+	E     int64
+	A     string
+	V     any
+	Tx    int64
+	Added bool
+}
+
+// Attribute is the subset of an attribute's schema the index needs.
+type Attribute struct {
+	Ref    bool
+	Many   bool
+	Unique bool
+}
+
+// DB is an immutable snapshot of a graph.
+type DB struct {
+	schema   map[string]Attribute
+	entities map[int64]*Entity
+	idents   map[string]int64
+	uuids    map[UUID]int64
+	byAttr   map[string][]int64
+	// reverse maps a referenced entity to the entities pointing at it,
+	// by attribute.
+	reverse map[int64]map[string][]int64
+	maxTx   int64
+}
+
+// New builds a snapshot from datoms applied in order. It is used by Open
+// and lets callers construct graphs in memory.
+func New(schema map[string]Attribute, datoms []Datom) *DB {
+	if schema == nil {
+		schema = make(map[string]Attribute)
+	}
+	db := &DB{
+		schema:   schema,
+		entities: make(map[int64]*Entity),
+		idents:   make(map[string]int64),
+		uuids:    make(map[UUID]int64),
+		byAttr:   make(map[string][]int64),
+		reverse:  make(map[int64]map[string][]int64),
+	}
+
+	for _, d := range datoms {
+		if d.Tx > db.maxTx {
+			db.maxTx = d.Tx
+		}
+		e := db.entities[d.E]
+		if e == nil {
+			if !d.Added {
+				continue
+			}
+			e = &Entity{ID: d.E, db: db, attrs: make(map[string][]any)}
+			db.entities[d.E] = e
+		}
+		if d.Added {
+			if db.schema[d.A].Many {
+				if !containsValue(e.attrs[d.A], d.V) {
+					e.attrs[d.A] = append(e.attrs[d.A], d.V)
+				}
+			} else {
+				e.attrs[d.A] = []any{d.V}
+			}
+			continue
+		}
+		e.attrs[d.A] = removeValue(e.attrs[d.A], d.V)
+		if len(e.attrs[d.A]) == 0 {
+			delete(e.attrs, d.A)
+		}
+		if len(e.attrs) == 0 {
+			delete(db.entities, d.E)
+		}
+	}
+
+	for id, e := range db.entities {
+		for attr, values := range e.attrs {
+			db.byAttr[attr] = append(db.byAttr[attr], id)
+			switch attr {
+			case "db/ident":
+				if k, ok := values[0].(Keyword); ok {
+					db.idents[string(k)] = id
+				}
+			case "block/uuid":
+				if u, ok := values[0].(UUID); ok {
+					db.uuids[u] = id
+				}
+			}
+			if !db.schema[attr].Ref {
+				continue
+			}
+			for _, v := range values {
+				target, ok := toInt64(v)
+				if !ok {
+					continue
+				}
+				if db.reverse[target] == nil {
+					db.reverse[target] = make(map[string][]int64)
+				}
+				db.reverse[target][attr] = append(db.reverse[target][attr], id)
+			}
+		}
+	}
+	for _, ids := range db.byAttr {
+		sortIDs(ids)
+	}
+	for _, byAttr := range db.reverse {
+		for _, ids := range byAttr {
+			sortIDs(ids)
+		}
+	}
+	return db
+}
+
+// Len returns the number of entities in the snapshot.
+func (db *DB) Len() int {
+	return len(db.entities)
+}
+
+// MaxTx returns the id of the newest transaction in the snapshot.
+func (db *DB) MaxTx() int64 {
+	return db.maxTx
+}
+
+// Attribute returns the schema of attr.
+func (db *DB) Attribute(attr string) (Attribute, bool) {
+	a, ok := db.schema[attr]
+	return a, ok
+}
+
+// Entity returns the entity with the given id, or nil.
+func (db *DB) Entity(id int64) *Entity {
+	return db.entities[id]
+}
+
+// Ident returns the entity whose :db/ident is ident, e.g.
+// "logseq.class/Task", or nil.
+func (db *DB) Ident(ident string) *Entity {
+	if id, ok := db.idents[ident]; ok {
+		return db.entities[id]
+	}
+	return nil
+}
+
+// ByUUID returns the entity whose :block/uuid is uuid, or nil. Case is
+// ignored.
+func (db *DB) ByUUID(uuid string) *Entity {
+	if id, ok := db.uuids[UUID(strings.ToLower(uuid))]; ok {
+		return db.entities[id]
+	}
+	return nil
+}
+
+// With returns every entity that has attr, ordered by id.
+func (db *DB) With(attr string) []*Entity {
+	return db.resolve(db.byAttr[attr])
+}
+
+// Referencing returns the entities whose ref attribute attr points at id,
+// ordered by id.
+func (db *DB) Referencing(id int64, attr string) []*Entity {
+	return db.resolve(db.reverse[id][attr])
+}
+
+func (db *DB) resolve(ids []int64) []*Entity {
+	out := make([]*Entity, 0, len(ids))
+	for _, id := range ids {
+		if e := db.entities[id]; e != nil {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+func sortIDs(ids []int64) {
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+}
+
+func containsValue(values []any, v any) bool {
+	for _, existing := range values {
+		if valueEqual(existing, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func removeValue(values []any, v any) []any {
+	out := values[:0]
+	for _, existing := range values {
+		if !valueEqual(existing, v) {
+			out = append(out, existing)
+		}
+	}
+	return out
+}
+
+// valueEqual reports whether two datom values are equal. A Tagged value is
+// comparable as a type but can hold a slice or map, which == panics on, so
+// structs are compared deeply.
+func valueEqual(a, b any) bool {
+	ta, tb := reflect.TypeOf(a), reflect.TypeOf(b)
+	if ta == nil || tb == nil {
+		return ta == tb
+	}
+	if ta == tb {
+		if ta.Kind() != reflect.Struct && ta.Comparable() {
+			return a == b
+		}
+		return reflect.DeepEqual(a, b)
+	}
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
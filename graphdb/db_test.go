@@ -0,0 +1,112 @@
+package graphdb
+
+import (
+	"slices"
+	"testing"
+)
+
+func decode(t *testing.T, doc string) any {
+	t.Helper()
+	v, err := DecodeTransit([]byte(doc))
+	if err != nil {
+		t.Fatalf("DecodeTransit(%s): %v", doc, err)
+	}
+	return v
+}
+
+func TestNewManyValued(t *testing.T) {
+	schema := map[string]Attribute{
+		"block/tags": {Ref: true, Many: true},
+		"test/shape": {Many: true},
+	}
+	// Unknown tags decode to Tagged values holding a slice or a map.
+	point := decode(t, `["~#point",[1,2]]`)
+	samePoint := decode(t, `["~#point",[1,2]]`)
+	circle := decode(t, `["~#circle",["^ ","~:r",3]]`)
+	if _, ok := point.(Tagged); !ok {
+		t.Fatalf("point decoded to %T, want Tagged", point)
+	}
+
+	db := New(schema, []Datom{
+		{E: 1, A: "block/tags", V: int64(10), Tx: 1, Added: true},
+		{E: 1, A: "block/tags", V: int64(11), Tx: 1, Added: true},
+		{E: 1, A: "block/tags", V: int64(10), Tx: 2, Added: true},
+		{E: 1, A: "test/shape", V: point, Tx: 2, Added: true},
+		{E: 1, A: "test/shape", V: samePoint, Tx: 2, Added: true},
+		{E: 1, A: "test/shape", V: circle, Tx: 2, Added: true},
+		{E: 1, A: "block/tags", V: int64(11), Tx: 3, Added: false},
+		{E: 1, A: "test/shape", V: samePoint, Tx: 3, Added: false},
+	})
+	e := db.Entity(1)
+	if got := e.All("block/tags"); !slices.Equal(got, []any{int64(10)}) {
+		t.Errorf("block/tags = %v, want [10]", got)
+	}
+	if got := e.All("test/shape"); len(got) != 1 || !valueEqual(got[0], circle) {
+		t.Errorf("test/shape = %v, want [%v]", got, circle)
+	}
+	if got := db.Referencing(10, "block/tags"); len(got) != 1 || got[0].ID != 1 {
+		t.Errorf("Referencing(10) = %v, want entity 1", got)
+	}
+	if got := db.Referencing(11, "block/tags"); len(got) != 0 {
+		t.Errorf("Referencing(11) = %v, want none after the retraction", got)
+	}
+	if db.MaxTx() != 3 {
+		t.Errorf("MaxTx = %d, want 3", db.MaxTx())
+	}
+
+	// Comparing snapshots compares the tagged values too.
+	again := New(schema, []Datom{
+		{E: 1, A: "block/tags", V: int64(10), Tx: 1, Added: true},
+		{E: 1, A: "test/shape", V: decode(t, `["~#circle",["^ ","~:r",3]]`), Tx: 1, Added: true},
+	})
+	if ids := Changed(db, again); len(ids) != 0 {
+		t.Errorf("Changed = %v, want nothing", ids)
+	}
+	moved := New(schema, []Datom{
+		{E: 1, A: "block/tags", V: int64(10), Tx: 1, Added: true},
+		{E: 1, A: "test/shape", V: point, Tx: 1, Added: true},
+	})
+	if ids := Changed(db, moved); !slices.Equal(ids, []int64{1}) {
+		t.Errorf("Changed = %v, want [1]", ids)
+	}
+}
+
+func TestNewRetractions(t *testing.T) {
+	schema := map[string]Attribute{
+		"db/ident":     {Unique: true},
+		"block/uuid":   {Unique: true},
+		"block/parent": {Ref: true},
+	}
+	db := New(schema, []Datom{
+		{E: 1, A: "db/ident", V: Keyword("logseq.class/Task"), Tx: 1, Added: true},
+		{E: 2, A: "block/uuid", V: UUID("6790c2a4-1c2b-4f3e-9d2a-0123456789ab"), Tx: 1, Added: true},
+		{E: 2, A: "block/title", V: "first", Tx: 1, Added: true},
+		{E: 2, A: "block/title", V: "second", Tx: 2, Added: true},
+		{E: 2, A: "block/parent", V: int64(3), Tx: 2, Added: true},
+		{E: 3, A: "block/title", V: "parent", Tx: 2, Added: true},
+		// Retracting an entity's last attribute removes it.
+		{E: 3, A: "block/title", V: "parent", Tx: 3, Added: false},
+		// Retractions of unknown entities are ignored.
+		{E: 4, A: "block/title", V: "gone", Tx: 3, Added: false},
+	})
+
+	if got := db.Entity(2).Title(); got != "second" {
+		t.Errorf("title = %q, want the later value", got)
+	}
+	if db.Entity(3) != nil || db.Entity(4) != nil {
+		t.Error("retracted entities are still present")
+	}
+	if db.Len() != 2 {
+		t.Errorf("Len = %d, want 2", db.Len())
+	}
+	if e := db.Ident("logseq.class/Task"); e == nil || e.ID != 1 {
+		t.Errorf("Ident = %v, want entity 1", e)
+	}
+	if e := db.ByUUID("6790C2A4-1C2B-4F3E-9D2A-0123456789AB"); e == nil || e.ID != 2 {
+		t.Errorf("ByUUID = %v, want entity 2", e)
+	}
+	// A ref to a retracted entity no longer resolves.
+	if p := db.Entity(2).Parent(); p != nil {
+		t.Errorf("Parent = %v, want nil", p)
+	}
+}
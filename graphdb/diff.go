@@ -0,0 +1,39 @@
+package graphdb
+
+// Changed returns the ids of the entities that differ between two
+// snapshots of a graph: added, retracted, or with an attribute whose values
+// changed. It is ordered by id. Values of cardinality-many attributes are
+// compared as sets.
+func Changed(old, new *DB) []int64 {
+	var ids []int64
+	for id, e := range new.entities {
+		if prev := old.entities[id]; prev == nil || !sameAttrs(prev.attrs, e.attrs) {
+			ids = append(ids, id)
+		}
+	}
+	for id := range old.entities {
+		if new.entities[id] == nil {
+			ids = append(ids, id)
+		}
+	}
+	sortIDs(ids)
+	return ids
+}
+
+func sameAttrs(a, b map[string][]any) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for attr, values := range a {
+		other, ok := b[attr]
+		if !ok || len(values) != len(other) {
+			return false
+		}
+		for _, v := range values {
+			if !containsValue(other, v) {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,177 @@
+package graphdb
+
+import (
+	"sort"
+	"time"
+)
+
+// Entity is an entity in a DB snapshot. Accessors take attribute names
+// without the leading colon, e.g. e.String("block/title").
+type Entity struct {
+	ID    int64
+	db    *DB
+	attrs map[string][]any
+}
+
+// DB returns the snapshot the entity belongs to.
+func (e *Entity) DB() *DB {
+	return e.db
+}
+
+// Attributes returns the names of the entity's attributes, sorted.
+func (e *Entity) Attributes() []string {
+	names := make([]string, 0, len(e.attrs))
+	for name := range e.attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Has reports whether the entity has a value for attr.
+func (e *Entity) Has(attr string) bool {
+	return len(e.attrs[attr]) > 0
+}
+
+// Get returns the value of attr, or the first value of a cardinality-many
+// attribute. It returns nil when the attribute is not set.
+func (e *Entity) Get(attr string) any {
+	if values := e.attrs[attr]; len(values) > 0 {
+		return values[0]
+	}
+	return nil
+}
+
+// All returns every value of attr.
+func (e *Entity) All(attr string) []any {
+	return e.attrs[attr]
+}
+
+// String returns attr as a string. Keywords and UUIDs are returned in
+// their printed form without the leading colon or tag.
+func (e *Entity) String(attr string) string {
+	switch v := e.Get(attr).(type) {
+	case string:
+		return v
+	case Keyword:
+		return string(v)
+	case UUID:
+		return string(v)
+	}
+	return ""
+}
+
+// Int returns attr as an integer, or 0.
+func (e *Entity) Int(attr string) int64 {
+	i, _ := toInt64(e.Get(attr))
+	return i
+}
+
+// Bool returns attr as a boolean.
+func (e *Entity) Bool(attr string) bool {
+	b, _ := e.Get(attr).(bool)
+	return b
+}
+
+// Time returns a millisecond timestamp attribute such as
+// block/created-at as a time.
+func (e *Entity) Time(attr string) time.Time {
+	ms, ok := toInt64(e.Get(attr))
+	if !ok {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
+
+// Ref returns the entity attr points at, or nil.
+func (e *Entity) Ref(attr string) *Entity {
+	id, ok := toInt64(e.Get(attr))
+	if !ok {
+		return nil
+	}
+	return e.db.Entity(id)
+}
+
+// Refs returns every entity a cardinality-many ref attribute points at.
+func (e *Entity) Refs(attr string) []*Entity {
+	var out []*Entity
+	for _, v := range e.attrs[attr] {
+		if id, ok := toInt64(v); ok {
+			if ref := e.db.Entity(id); ref != nil {
+				out = append(out, ref)
+			}
+		}
+	}
+	return out
+}
+
+// Referencing returns the entities whose attr points at e.
+func (e *Entity) Referencing(attr string) []*Entity {
+	return e.db.Referencing(e.ID, attr)
+}
+
+// UUID returns the entity's :block/uuid.
+func (e *Entity) UUID() string {
+	return e.String("block/uuid")
+}
+
+// Ident returns the entity's :db/ident, e.g. "logseq.class/Task".
+func (e *Entity) Ident() string {
+	return e.String("db/ident")
+}
+
+// Title returns the entity's :block/title.
+func (e *Entity) Title() string {
+	return e.String("block/title")
+}
+
+// Name returns a page's lower-cased :block/name.
+func (e *Entity) Name() string {
+	return e.String("block/name")
+}
+
+// Order returns a block's fractional index, which sorts siblings
+// lexicographically.
+func (e *Entity) Order() string {
+	return e.String("block/order")
+}
+
+// Page returns the page a block belongs to.
+func (e *Entity) Page() *Entity {
+	return e.Ref("block/page")
+}
+
+// Parent returns a block's parent block or page.
+func (e *Entity) Parent() *Entity {
+	return e.Ref("block/parent")
+}
+
+// Tags returns the tags (classes) of a block or page.
+func (e *Entity) Tags() []*Entity {
+	return e.Refs("block/tags")
+}
+
+// HasTag reports whether the entity is tagged with the class whose
+// :db/ident is ident.
+func (e *Entity) HasTag(ident string) bool {
+	class := e.db.Ident(ident)
+	if class == nil {
+		return false
+	}
+	for _, v := range e.attrs["block/tags"] {
+		if id, ok := toInt64(v); ok && id == class.ID {
+			return true
+		}
+	}
+	return false
+}
+
+// CreatedAt returns :block/created-at.
+func (e *Entity) CreatedAt() time.Time {
+	return e.Time("block/created-at")
+}
+
+// UpdatedAt returns :block/updated-at.
+func (e *Entity) UpdatedAt() time.Time {
+	return e.Time("block/updated-at")
+}
@@ -0,0 +1,151 @@
+package graphdb
+
+import (
+	"sort"
+	"strings"
+)
+
+// Built-in idents of the Logseq DB schema.
+const (
+	ClassTask     = "logseq.class/Task"
+	ClassTag      = "logseq.class/Tag"
+	ClassProperty = "logseq.class/Property"
+	ClassJournal  = "logseq.class/Journal"
+
+	PropertyStatus    = "logseq.property/status"
+	PropertyPriority  = "logseq.property/priority"
+	PropertyDeadline  = "logseq.property/deadline"
+	PropertyScheduled = "logseq.property/scheduled"
+
+	PropertyRepeated       = "logseq.property.repeat/repeated?"
+	PropertyRecurFrequency = "logseq.property.repeat/recur-frequency"
+	PropertyRecurUnit      = "logseq.property.repeat/recur-unit"
+
+	// ConfigFile is the path of the graph's config.edn, which DB graphs
+	// keep in the database as a file entity.
+	ConfigFile = "logseq/config.edn"
+)
+
+// Tagged returns the entities tagged with the class whose :db/ident is
+// class, ordered by id.
+func (db *DB) Tagged(class string) []*Entity {
+	c := db.Ident(class)
+	if c == nil {
+		return nil
+	}
+	return db.Referencing(c.ID, "block/tags")
+}
+
+// Tasks returns the blocks tagged #Task that have a status, ordered by id,
+// like list_all_tasks.cljs.
+func (db *DB) Tasks() []*Entity {
+	var tasks []*Entity
+	for _, e := range db.Tagged(ClassTask) {
+		if e.Has(PropertyStatus) {
+			tasks = append(tasks, e)
+		}
+	}
+	return tasks
+}
+
+// Pages returns every page, ordered by title.
+func (db *DB) Pages() []*Entity {
+	pages := db.With("block/name")
+	sort.SliceStable(pages, func(i, j int) bool {
+		return pages[i].Title() < pages[j].Title()
+	})
+	return pages
+}
+
+// Tags returns every tag (class) in the graph.
+func (db *DB) Tags() []*Entity {
+	return db.Tagged(ClassTag)
+}
+
+// Properties returns every property in the graph.
+func (db *DB) Properties() []*Entity {
+	return db.Tagged(ClassProperty)
+}
+
+// FindPage looks a page up by name (case-insensitively) or UUID. Tags and
+// properties are pages too.
+func (db *DB) FindPage(nameOrUUID string) *Entity {
+	name := strings.ToLower(nameOrUUID)
+	for _, e := range db.With("block/name") {
+		if e.Name() == name {
+			return e
+		}
+	}
+	if e := db.ByUUID(nameOrUUID); e != nil && e.Has("block/name") {
+		return e
+	}
+	return nil
+}
+
+// Journals returns the journal pages whose :block/journal-day, the day as
+// a YYYYMMDD number, is within from and to inclusive, most recent first. A
+// zero bound is open.
+func (db *DB) Journals(from, to int64) []*Entity {
+	var journals []*Entity
+	for _, e := range db.With("block/journal-day") {
+		day := e.Int("block/journal-day")
+		if (from == 0 || day >= from) && (to == 0 || day <= to) {
+			journals = append(journals, e)
+		}
+	}
+	sort.SliceStable(journals, func(i, j int) bool {
+		return journals[i].Int("block/journal-day") > journals[j].Int("block/journal-day")
+	})
+	return journals
+}
+
+// File returns the content of the file entity at path, or "" if the graph
+// has none.
+func (db *DB) File(path string) string {
+	for _, e := range db.With("file/path") {
+		if e.String("file/path") == path {
+			return e.String("file/content")
+		}
+	}
+	return ""
+}
+
+// FindTag looks a tag up by title (case-insensitively) or :db/ident.
+func (db *DB) FindTag(titleOrIdent string) *Entity {
+	for _, e := range db.Tags() {
+		if strings.EqualFold(e.Title(), titleOrIdent) || e.Ident() == titleOrIdent {
+			return e
+		}
+	}
+	return nil
+}
+
+// PageBlocks returns the blocks on a page that have a title, ordered by
+// :block/order like get_page.cljs. The outline hierarchy is not taken into
+// account.
+func (db *DB) PageBlocks(page *Entity) []*Entity {
+	var blocks []*Entity
+	for _, e := range db.Referencing(page.ID, "block/page") {
+		if e.Has("block/title") {
+			blocks = append(blocks, e)
+		}
+	}
+	SortByOrder(blocks)
+	return blocks
+}
+
+// SortByOrder sorts sibling blocks by their fractional index.
+func SortByOrder(blocks []*Entity) {
+	sort.SliceStable(blocks, func(i, j int) bool {
+		return blocks[i].Order() < blocks[j].Order()
+	})
+}
+
+// RefTitle returns the title of the entity a ref attribute points at, such
+// as a task's status ("Todo") or priority ("High").
+func (e *Entity) RefTitle(attr string) string {
+	if ref := e.Ref(attr); ref != nil {
+		return ref.Title()
+	}
+	return ""
+}
@@ -0,0 +1,230 @@
+package graphdb
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Block order keys are fractional indexes: strings that sort in outline
+// order and leave room for a key between any two of them. This is a port
+// of deps/logseq/clj_fractional_indexing.cljc, itself a port of
+// rocicorp/fractional-indexing, with its base-62 digits.
+
+const orderDigits = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// smallestInteger is the integer part no key may consist of alone.
+var smallestInteger = "A" + strings.Repeat("0", 26)
+
+// OrderKeyBetween returns an order key that sorts after a and before b.
+// An empty a or b is an open end, so OrderKeyBetween(last, "") appends
+// and OrderKeyBetween("", "") starts a list.
+func OrderKeyBetween(a, b string) (string, error) {
+	if a != "" {
+		if err := validateOrderKey(a); err != nil {
+			return "", err
+		}
+	}
+	if b != "" {
+		if err := validateOrderKey(b); err != nil {
+			return "", err
+		}
+	}
+	if a != "" && b != "" && a >= b {
+		return "", fmt.Errorf("order key %q is not before %q", a, b)
+	}
+
+	if a == "" {
+		if b == "" {
+			return "a0", nil
+		}
+		ib, _ := integerPart(b)
+		fb := b[len(ib):]
+		if ib == smallestInteger {
+			return ib + midpoint("", fb), nil
+		}
+		if ib < b {
+			return ib, nil
+		}
+		res, ok := decrementInteger(ib)
+		if !ok {
+			return "", errors.New("cannot decrement any more")
+		}
+		return res, nil
+	}
+
+	ia, _ := integerPart(a)
+	fa := a[len(ia):]
+	if b == "" {
+		if i, ok := incrementInteger(ia); ok {
+			return i, nil
+		}
+		return ia + midpoint(fa, ""), nil
+	}
+
+	ib, _ := integerPart(b)
+	fb := b[len(ib):]
+	if ia == ib {
+		return ia + midpoint(fa, fb), nil
+	}
+	i, ok := incrementInteger(ia)
+	if !ok {
+		return "", errors.New("cannot increment any more")
+	}
+	if i < b {
+		return i, nil
+	}
+	return ia + midpoint(fa, ""), nil
+}
+
+// midpoint returns a fraction between a and b, where a < b and an empty b
+// is the end of the range. Neither may end in a zero digit.
+func midpoint(a, b string) string {
+	if b != "" {
+		// Keep the common prefix, padding a with zeros.
+		n := 0
+		for n < len(b) && digitAt(a, n) == b[n] {
+			n++
+		}
+		if n > 0 {
+			rest := ""
+			if n < len(a) {
+				rest = a[n:]
+			}
+			return b[:n] + midpoint(rest, b[n:])
+		}
+	}
+	digitA := 0
+	if a != "" {
+		digitA = strings.IndexByte(orderDigits, a[0])
+	}
+	digitB := len(orderDigits)
+	if b != "" {
+		digitB = strings.IndexByte(orderDigits, b[0])
+	}
+	if digitB-digitA > 1 {
+		// Math.round(0.5 * (digitA + digitB)), rounding halves up
+		return string(orderDigits[(digitA+digitB+1)/2])
+	}
+	if len(b) > 1 {
+		return b[:1]
+	}
+	rest := ""
+	if len(a) > 1 {
+		rest = a[1:]
+	}
+	return string(orderDigits[digitA]) + midpoint(rest, "")
+}
+
+func digitAt(s string, i int) byte {
+	if i < len(s) {
+		return s[i]
+	}
+	return orderDigits[0]
+}
+
+// integerLength is the length of the integer part that starts with head:
+// a-z for 2 to 27 characters of positive integers, Z-A for negative ones.
+func integerLength(head byte) (int, error) {
+	switch {
+	case head >= 'a' && head <= 'z':
+		return int(head-'a') + 2, nil
+	case head >= 'A' && head <= 'Z':
+		return int('Z'-head) + 2, nil
+	}
+	return 0, fmt.Errorf("invalid order key head %q", head)
+}
+
+func integerPart(key string) (string, error) {
+	if key == "" {
+		return "", errors.New("empty order key")
+	}
+	n, err := integerLength(key[0])
+	if err != nil {
+		return "", err
+	}
+	if n > len(key) {
+		return "", fmt.Errorf("invalid order key %q", key)
+	}
+	return key[:n], nil
+}
+
+func validateOrderKey(key string) error {
+	if key == smallestInteger {
+		return fmt.Errorf("invalid order key %q", key)
+	}
+	i, err := integerPart(key)
+	if err != nil {
+		return err
+	}
+	if f := key[len(i):]; strings.HasSuffix(f, orderDigits[:1]) {
+		return fmt.Errorf("invalid order key %q", key)
+	}
+	for j := 1; j < len(key); j++ {
+		if strings.IndexByte(orderDigits, key[j]) < 0 {
+			return fmt.Errorf("invalid order key %q", key)
+		}
+	}
+	return nil
+}
+
+func incrementInteger(x string) (string, bool) {
+	head, digits := x[0], []byte(x[1:])
+	carry := true
+	for i := len(digits) - 1; carry && i >= 0; i-- {
+		d := strings.IndexByte(orderDigits, digits[i]) + 1
+		if d == len(orderDigits) {
+			digits[i] = orderDigits[0]
+		} else {
+			digits[i] = orderDigits[d]
+			carry = false
+		}
+	}
+	if !carry {
+		return string(head) + string(digits), true
+	}
+	switch head {
+	case 'Z':
+		return "a" + orderDigits[:1], true
+	case 'z':
+		return "", false
+	}
+	h := head + 1
+	if h > 'a' {
+		digits = append(digits, orderDigits[0])
+	} else {
+		digits = digits[:len(digits)-1]
+	}
+	return string(h) + string(digits), true
+}
+
+func decrementInteger(x string) (string, bool) {
+	last := orderDigits[len(orderDigits)-1]
+	head, digits := x[0], []byte(x[1:])
+	borrow := true
+	for i := len(digits) - 1; borrow && i >= 0; i-- {
+		d := strings.IndexByte(orderDigits, digits[i]) - 1
+		if d == -1 {
+			digits[i] = last
+		} else {
+			digits[i] = orderDigits[d]
+			borrow = false
+		}
+	}
+	if !borrow {
+		return string(head) + string(digits), true
+	}
+	switch head {
+	case 'a':
+		return "Z" + string(last), true
+	case 'A':
+		return "", false
+	}
+	h := head - 1
+	if h < 'Z' {
+		digits = append(digits, last)
+	} else {
+		digits = digits[:len(digits)-1]
+	}
+	return string(h) + string(digits), true
+}
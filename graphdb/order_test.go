@@ -0,0 +1,125 @@
+package graphdb
+
+import (
+	"strings"
+	"testing"
+)
+
+// The OrderKeyBetween cases are the reference vectors of
+// rocicorp/fractional-indexing, with "" for its null ends.
+func TestOrderKeyBetween(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want string
+	}{
+		{"", "", "a0"},
+		{"", "a0", "Zz"},
+		{"", "Zz", "Zy"},
+		{"a0", "", "a1"},
+		{"a1", "", "a2"},
+		{"a0", "a1", "a0V"},
+		{"a1", "a2", "a1V"},
+		{"a0V", "a1", "a0l"},
+		{"Zz", "a0", "ZzV"},
+		{"Zz", "a1", "a0"},
+		{"", "Y00", "Xzzz"},
+		{"bzz", "", "c000"},
+		{"a0", "a0V", "a0G"},
+		{"a0", "a0G", "a08"},
+		{"b125", "b129", "b127"},
+		{"a0", "a1V", "a1"},
+		{"Zz", "a01", "a0"},
+		{"", "a0V", "a0"},
+		{"", "b999", "b99"},
+		{"", "A000000000000000000000000001", "A000000000000000000000000000V"},
+		{"zzzzzzzzzzzzzzzzzzzzzzzzzzy", "", "zzzzzzzzzzzzzzzzzzzzzzzzzzz"},
+		{"zzzzzzzzzzzzzzzzzzzzzzzzzzz", "", "zzzzzzzzzzzzzzzzzzzzzzzzzzzV"},
+	}
+	for _, tt := range tests {
+		got, err := OrderKeyBetween(tt.a, tt.b)
+		if err != nil {
+			t.Errorf("OrderKeyBetween(%q, %q): %v", tt.a, tt.b, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("OrderKeyBetween(%q, %q) = %q, want %q", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestOrderKeyBetweenErrors(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want string
+	}{
+		{"", "A00000000000000000000000000", "invalid order key"},
+		{"a00", "", "invalid order key"},
+		{"a00", "a1", "invalid order key"},
+		{"0", "1", "invalid order key head"},
+		{"a0", "a0", "is not before"},
+		{"a1", "a0", "is not before"},
+		{"a0", "a0!", "invalid order key"},
+		{"b1", "", "invalid order key"},
+	}
+	for _, tt := range tests {
+		got, err := OrderKeyBetween(tt.a, tt.b)
+		if err == nil {
+			t.Errorf("OrderKeyBetween(%q, %q) = %q, want an error", tt.a, tt.b, got)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("OrderKeyBetween(%q, %q): %v, want %q", tt.a, tt.b, err, tt.want)
+		}
+	}
+}
+
+func TestMidpoint(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want string
+	}{
+		{"", "", "V"},
+		{"V", "", "l"},
+		{"", "V", "G"},
+		{"", "1", "0V"},
+		{"1", "2", "1V"},
+		{"0V", "1", "0l"},
+		{"125", "129", "127"},
+		{"z", "", "zV"},
+	}
+	for _, tt := range tests {
+		if got := midpoint(tt.a, tt.b); got != tt.want {
+			t.Errorf("midpoint(%q, %q) = %q, want %q", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestIncrementDecrementInteger(t *testing.T) {
+	tests := []struct {
+		x, next string
+	}{
+		{"a0", "a1"},
+		{"a9", "aA"},
+		{"az", "b00"},
+		{"bzz", "c000"},
+		{"Zy", "Zz"},
+		{"Zz", "a0"},
+		{"Yzz", "Z0"},
+		{"Xzzz", "Y00"},
+	}
+	for _, tt := range tests {
+		if got, ok := incrementInteger(tt.x); !ok || got != tt.next {
+			t.Errorf("incrementInteger(%q) = %q, %v, want %q", tt.x, got, ok, tt.next)
+		}
+		if got, ok := decrementInteger(tt.next); !ok || got != tt.x {
+			t.Errorf("decrementInteger(%q) = %q, %v, want %q", tt.next, got, ok, tt.x)
+		}
+	}
+
+	if got, ok := incrementInteger("z" + strings.Repeat("z", 26)); ok {
+		t.Errorf("incrementInteger(largest) = %q, want none", got)
+	}
+	if got, ok := decrementInteger(smallestInteger); ok {
+		t.Errorf("decrementInteger(smallest) = %q, want none", got)
+	}
+}
@@ -0,0 +1,221 @@
+package graphdb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+
+	_ "modernc.org/sqlite"
+)
+
+// Logseq persists a DataScript database into the kvs table of db.sqlite
+// using DataScript's storage protocol: row 0 holds the root (schema and the
+// addresses of the index trees), row 1 the tail of transactions not yet
+// folded into the trees, and every other row is a node of a persistent
+// sorted set. Node content is transit+json; branch child addresses are kept
+// in the separate addresses column.
+const (
+	rootAddr = 0
+	tailAddr = 1
+)
+
+// Open reads the graph database at path (a db.sqlite file) into memory.
+// The file is opened read-only so it is safe to use while Logseq is
+// running.
+func Open(ctx context.Context, path string) (*DB, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	dsn := (&url.URL{Scheme: "file", Path: abs, RawQuery: "mode=ro&_pragma=busy_timeout(5000)"}).String()
+	conn, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %w", path, err)
+	}
+	defer conn.Close()
+
+	s := &store{conn: conn}
+	db, err := s.restore(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return db, nil
+}
+
+type store struct {
+	conn *sql.DB
+}
+
+type node struct {
+	content   any
+	addresses []int64
+}
+
+func (s *store) load(ctx context.Context, addr int64) (*node, error) {
+	var content string
+	var addresses sql.NullString
+	err := s.conn.QueryRowContext(ctx, "SELECT content, addresses FROM kvs WHERE addr = ?", addr).Scan(&content, &addresses)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	n := &node{}
+	if n.content, err = DecodeTransit([]byte(content)); err != nil {
+		return nil, fmt.Errorf("node %d: %w", addr, err)
+	}
+	if addresses.Valid && addresses.String != "" {
+		if err := json.Unmarshal([]byte(addresses.String), &n.addresses); err != nil {
+			return nil, fmt.Errorf("node %d addresses: %w", addr, err)
+		}
+	}
+	return n, nil
+}
+
+func (s *store) restore(ctx context.Context) (*DB, error) {
+	root, err := s.load(ctx, rootAddr)
+	if err != nil {
+		return nil, err
+	}
+	if root == nil {
+		return nil, errors.New("not a Logseq DB graph: no root in kvs table")
+	}
+	meta, ok := root.content.(map[any]any)
+	if !ok {
+		return nil, fmt.Errorf("unexpected root of type %T", root.content)
+	}
+
+	schema := parseSchema(meta[Keyword("schema")])
+	eavt, ok := toInt64(meta[Keyword("eavt")])
+	if !ok {
+		return nil, errors.New("root has no eavt address")
+	}
+
+	var datoms []Datom
+	if err := s.walk(ctx, eavt, &datoms); err != nil {
+		return nil, err
+	}
+
+	tail, err := s.load(ctx, tailAddr)
+	if err != nil {
+		return nil, err
+	}
+	if tail != nil {
+		txs, _ := tail.content.([]any)
+		for _, tx := range txs {
+			ds, _ := tx.([]any)
+			for _, raw := range ds {
+				d, err := parseDatom(raw)
+				if err != nil {
+					return nil, fmt.Errorf("tail: %w", err)
+				}
+				datoms = append(datoms, d)
+			}
+		}
+	}
+
+	return New(schema, datoms), nil
+}
+
+// walk collects the datoms of the sorted-set tree rooted at addr in index
+// order.
+func (s *store) walk(ctx context.Context, addr int64, datoms *[]Datom) error {
+	n, err := s.load(ctx, addr)
+	if err != nil {
+		return err
+	}
+	if n == nil {
+		return fmt.Errorf("missing node %d", addr)
+	}
+	m, ok := n.content.(map[any]any)
+	if !ok {
+		return fmt.Errorf("node %d: unexpected content of type %T", addr, n.content)
+	}
+
+	level, _ := toInt64(m[Keyword("level")])
+	if level > 0 {
+		addresses := n.addresses
+		if len(addresses) == 0 {
+			// Older stores kept the addresses inside the node itself.
+			raw, _ := m[Keyword("addresses")].([]any)
+			for _, a := range raw {
+				if i, ok := toInt64(a); ok {
+					addresses = append(addresses, i)
+				}
+			}
+		}
+		for _, child := range addresses {
+			if err := s.walk(ctx, child, datoms); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	keys, _ := m[Keyword("keys")].([]any)
+	for _, raw := range keys {
+		d, err := parseDatom(raw)
+		if err != nil {
+			return fmt.Errorf("node %d: %w", addr, err)
+		}
+		*datoms = append(*datoms, d)
+	}
+	return nil
+}
+
+// parseDatom decodes a serialized [e a v tx] datom. DataScript encodes
+// retractions as a negative tx.
+func parseDatom(raw any) (Datom, error) {
+	arr, ok := raw.([]any)
+	if !ok || len(arr) < 4 {
+		return Datom{}, fmt.Errorf("malformed datom %v", raw)
+	}
+	e, ok := toInt64(arr[0])
+	if !ok {
+		return Datom{}, fmt.Errorf("malformed datom entity %v", arr[0])
+	}
+	a, ok := arr[1].(Keyword)
+	if !ok {
+		return Datom{}, fmt.Errorf("malformed datom attribute %v", arr[1])
+	}
+	tx, _ := toInt64(arr[3])
+	d := Datom{E: e, A: string(a), V: arr[2], Tx: tx, Added: true}
+	if tx < 0 {
+		d.Tx, d.Added = -tx, false
+	}
+	return d, nil
+}
+
+func parseSchema(raw any) map[string]Attribute {
+	schema := make(map[string]Attribute)
+	m, _ := raw.(map[any]any)
+	for k, v := range m {
+		name, ok := k.(Keyword)
+		if !ok {
+			continue
+		}
+		props, _ := v.(map[any]any)
+		schema[string(name)] = Attribute{
+			Ref:    props[Keyword("db/valueType")] == Keyword("db.type/ref"),
+			Many:   props[Keyword("db/cardinality")] == Keyword("db.cardinality/many"),
+			Unique: props[Keyword("db/unique")] != nil,
+		}
+	}
+	return schema
+}
+
+func toInt64(v any) (int64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return n, true
+	case float64:
+		return int64(n), true
+	}
+	return 0, false
+}
@@ -0,0 +1,361 @@
+package graphdb
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Keyword is a Clojure keyword without its leading colon, e.g.
+// "block/title" for :block/title.
+type Keyword string
+
+func (k Keyword) String() string { return ":" + string(k) }
+
+// Symbol is a Clojure symbol.
+type Symbol string
+
+// UUID is a UUID in its canonical string form.
+type UUID string
+
+// Tagged is a transit value whose tag has no built-in decoding.
+type Tagged struct {
+	Tag string
+	Rep any
+}
+
+// tag is the decoded form of a "~#tag" string. It only exists while
+// decoding.
+type tag string
+
+// Transit constants, see https://github.com/cognitect/transit-format.
+const (
+	mapAsArray      = "^ "
+	cacheMinLength  = 4
+	cacheCodeDigits = 44
+	cacheMaxEntries = cacheCodeDigits * cacheCodeDigits
+)
+
+// readCache mirrors the rolling cache a transit writer keeps for map keys,
+// keywords, symbols and tags.
+type readCache struct {
+	entries []any
+}
+
+func (c *readCache) write(v any) {
+	if len(c.entries) == cacheMaxEntries {
+		c.entries = c.entries[:0]
+	}
+	c.entries = append(c.entries, v)
+}
+
+func (c *readCache) read(code string) (any, error) {
+	idx := int(code[1] - '0')
+	if len(code) == 3 {
+		idx = idx*cacheCodeDigits + int(code[2]-'0')
+	}
+	if idx < 0 || idx >= len(c.entries) {
+		return nil, fmt.Errorf("transit: cache reference %q out of range", code)
+	}
+	return c.entries[idx], nil
+}
+
+func isCacheCode(s string) bool {
+	return len(s) > 1 && s[0] == '^' && s != mapAsArray
+}
+
+func isCacheable(s string, asMapKey bool) bool {
+	if len(s) < cacheMinLength {
+		return false
+	}
+	if asMapKey {
+		return true
+	}
+	return s[0] == '~' && (s[1] == ':' || s[1] == '$' || s[1] == '#')
+}
+
+// DecodeTransit decodes a transit+json document. Maps decode to
+// map[any]any, vectors, lists and sets to []any, integers to int64 and
+// keywords, symbols and UUIDs to their named types.
+func DecodeTransit(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var raw any
+	if err := dec.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("transit: %w", err)
+	}
+	d := &transitDecoder{cache: &readCache{}}
+	return d.decode(raw, false)
+}
+
+type transitDecoder struct {
+	cache *readCache
+}
+
+func (d *transitDecoder) decode(node any, asMapKey bool) (any, error) {
+	switch n := node.(type) {
+	case nil, bool:
+		return n, nil
+	case json.Number:
+		return decodeNumber(n)
+	case string:
+		return d.decodeString(n, asMapKey)
+	case []any:
+		return d.decodeArray(n, asMapKey)
+	case map[string]any:
+		// Verbose-mode maps. Logseq writes the compact form, but accept both.
+		m := make(map[any]any, len(n))
+		for k, v := range n {
+			key, err := d.decodeString(k, true)
+			if err != nil {
+				return nil, err
+			}
+			val, err := d.decode(v, false)
+			if err != nil {
+				return nil, err
+			}
+			if t, ok := key.(tag); ok && len(n) == 1 {
+				return decodeTagged(string(t), val)
+			}
+			m[hashable(key)] = val
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("transit: unexpected JSON value %T", node)
+}
+
+func decodeNumber(n json.Number) (any, error) {
+	if i, err := n.Int64(); err == nil {
+		return i, nil
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return nil, fmt.Errorf("transit: %w", err)
+	}
+	return f, nil
+}
+
+func (d *transitDecoder) decodeString(s string, asMapKey bool) (any, error) {
+	if isCacheCode(s) {
+		return d.cache.read(s)
+	}
+	v, err := parseString(s)
+	if err != nil {
+		return nil, err
+	}
+	if isCacheable(s, asMapKey) {
+		d.cache.write(v)
+	}
+	return v, nil
+}
+
+func (d *transitDecoder) decodeArray(arr []any, asMapKey bool) (any, error) {
+	if len(arr) > 0 && arr[0] == mapAsArray {
+		if len(arr)%2 != 1 {
+			return nil, fmt.Errorf("transit: map with odd number of entries")
+		}
+		m := make(map[any]any, len(arr)/2)
+		for i := 1; i < len(arr); i += 2 {
+			key, err := d.decode(arr[i], true)
+			if err != nil {
+				return nil, err
+			}
+			val, err := d.decode(arr[i+1], false)
+			if err != nil {
+				return nil, err
+			}
+			m[hashable(key)] = val
+		}
+		return m, nil
+	}
+
+	if len(arr) == 2 {
+		if t, ok, err := d.peekTag(arr[0]); err != nil {
+			return nil, err
+		} else if ok {
+			rep, err := d.decodeTagRep(arr[1], asMapKey)
+			if err != nil {
+				return nil, err
+			}
+			return decodeTagged(string(t), rep)
+		}
+	}
+
+	out := make([]any, len(arr))
+	for i, elem := range arr {
+		v, err := d.decode(elem, asMapKey)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+// decodeTagRep decodes the representation of a tagged value. Arrays are
+// always plain arrays here, never maps or nested tags.
+func (d *transitDecoder) decodeTagRep(node any, asMapKey bool) (any, error) {
+	arr, ok := node.([]any)
+	if !ok {
+		return d.decode(node, asMapKey)
+	}
+	out := make([]any, len(arr))
+	for i, elem := range arr {
+		v, err := d.decode(elem, asMapKey)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+// peekTag reports whether node is a tag, only touching the cache when it
+// is one so that ordinary two element arrays are not double counted.
+func (d *transitDecoder) peekTag(node any) (tag, bool, error) {
+	s, ok := node.(string)
+	if !ok {
+		return "", false, nil
+	}
+	if strings.HasPrefix(s, "~#") {
+		v, err := d.decodeString(s, false)
+		if err != nil {
+			return "", false, err
+		}
+		t, ok := v.(tag)
+		return t, ok, nil
+	}
+	if isCacheCode(s) {
+		v, err := d.cache.read(s)
+		if err != nil {
+			return "", false, err
+		}
+		t, ok := v.(tag)
+		return t, ok, nil
+	}
+	return "", false, nil
+}
+
+func parseString(s string) (any, error) {
+	if len(s) < 2 || s[0] != '~' {
+		return s, nil
+	}
+	rest := s[2:]
+	switch s[1] {
+	case '~', '^', '`':
+		return s[1:], nil
+	case ':':
+		return Keyword(rest), nil
+	case '$':
+		return Symbol(rest), nil
+	case '#':
+		return tag(rest), nil
+	case 'u':
+		return UUID(rest), nil
+	case '_':
+		return nil, nil
+	case '?':
+		return rest == "t", nil
+	case 'i':
+		i, err := strconv.ParseInt(rest, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("transit: bad integer %q", s)
+		}
+		return i, nil
+	case 'n':
+		b, ok := new(big.Int).SetString(rest, 10)
+		if !ok {
+			return nil, fmt.Errorf("transit: bad bigint %q", s)
+		}
+		if b.IsInt64() {
+			return b.Int64(), nil
+		}
+		return b, nil
+	case 'd', 'f':
+		f, err := strconv.ParseFloat(rest, 64)
+		if err != nil {
+			return nil, fmt.Errorf("transit: bad decimal %q", s)
+		}
+		return f, nil
+	case 'z':
+		switch rest {
+		case "NaN":
+			return math.NaN(), nil
+		case "INF":
+			return math.Inf(1), nil
+		case "-INF":
+			return math.Inf(-1), nil
+		}
+		return nil, fmt.Errorf("transit: bad special number %q", s)
+	case 'm':
+		ms, err := strconv.ParseInt(rest, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("transit: bad timestamp %q", s)
+		}
+		return time.UnixMilli(ms).UTC(), nil
+	case 't':
+		t, err := time.Parse(time.RFC3339Nano, rest)
+		if err != nil {
+			return nil, fmt.Errorf("transit: bad instant %q", s)
+		}
+		return t, nil
+	case 'b':
+		b, err := base64.StdEncoding.DecodeString(rest)
+		if err != nil {
+			return nil, fmt.Errorf("transit: bad bytes %q", s)
+		}
+		return b, nil
+	case 'r', 'c':
+		return rest, nil
+	}
+	return Tagged{Tag: s[1:2], Rep: rest}, nil
+}
+
+func decodeTagged(t string, rep any) (any, error) {
+	switch t {
+	case "'":
+		return rep, nil
+	case "set", "list":
+		if arr, ok := rep.([]any); ok {
+			return arr, nil
+		}
+	case "cmap":
+		arr, ok := rep.([]any)
+		if !ok || len(arr)%2 != 0 {
+			return nil, fmt.Errorf("transit: bad cmap")
+		}
+		m := make(map[any]any, len(arr)/2)
+		for i := 0; i < len(arr); i += 2 {
+			m[hashable(arr[i])] = arr[i+1]
+		}
+		return m, nil
+	case "u":
+		if s, ok := rep.(string); ok {
+			return UUID(s), nil
+		}
+	case "m":
+		if ms, ok := rep.(int64); ok {
+			return time.UnixMilli(ms).UTC(), nil
+		}
+	}
+	return Tagged{Tag: t, Rep: rep}, nil
+}
+
+// hashable makes a decoded value usable as a Go map key. Composite keys
+// are rare in Logseq data and are keyed by their printed form; a tagged
+// value is kept, with its rep made hashable in turn.
+func hashable(v any) any {
+	switch v := v.(type) {
+	case []any, map[any]any, []byte:
+		return fmt.Sprint(v)
+	case Tagged:
+		return Tagged{Tag: v.Tag, Rep: hashable(v.Rep)}
+	}
+	return v
+}
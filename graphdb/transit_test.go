@@ -0,0 +1,88 @@
+package graphdb
+
+import (
+	"math"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDecodeTransit(t *testing.T) {
+	bigInt, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	tests := []struct {
+		name string
+		doc  string
+		want any
+	}{
+		{"string", `"plain"`, "plain"},
+		{"escaped", `"~~tilde"`, "~tilde"},
+		{"integer", `42`, int64(42)},
+		{"integer string", `"~i9007199254740993"`, int64(9007199254740993)},
+		{"bigint", `"~n123456789012345678901234567890"`, bigInt},
+		{"float", `1.5`, 1.5},
+		{"infinity", `"~zINF"`, math.Inf(1)},
+		{"nil", `"~_"`, nil},
+		{"bool", `"~?t"`, true},
+		{"keyword", `"~:block/title"`, Keyword("block/title")},
+		{"symbol", `"~$inc"`, Symbol("inc")},
+		{"uuid", `"~u6790c2a4-1c2b-4f3e-9d2a-0123456789ab"`, UUID("6790c2a4-1c2b-4f3e-9d2a-0123456789ab")},
+		{"timestamp", `"~m1700000000000"`, time.UnixMilli(1700000000000).UTC()},
+		{"bytes", `"~bAQID"`, []byte{1, 2, 3}},
+		{"array map", `["^ ","~:a",1,"b",2]`, map[any]any{Keyword("a"): int64(1), "b": int64(2)}},
+		{"verbose map", `{"~:a":1,"b":2}`, map[any]any{Keyword("a"): int64(1), "b": int64(2)}},
+		{"verbose map with composite key", `{"~bAQID":1}`, map[any]any{"[1 2 3]": int64(1)}},
+		{"set", `["~#set",[1,2]]`, []any{int64(1), int64(2)}},
+		{"list", `["~#list",["a"]]`, []any{"a"}},
+		{"tagged uuid", `["~#u","6790c2a4-1c2b-4f3e-9d2a-0123456789ab"]`, UUID("6790c2a4-1c2b-4f3e-9d2a-0123456789ab")},
+		{"verbose tagged uuid", `{"~#u":"6790c2a4-1c2b-4f3e-9d2a-0123456789ab"}`, UUID("6790c2a4-1c2b-4f3e-9d2a-0123456789ab")},
+		{"cmap", `["~#cmap",[["a"],1,"b",2]]`, map[any]any{"[a]": int64(1), "b": int64(2)}},
+		{"unknown tag", `["~#point",[1,2]]`, Tagged{Tag: "point", Rep: []any{int64(1), int64(2)}}},
+		{"unknown scalar tag", `"~xyz"`, Tagged{Tag: "x", Rep: "yz"}},
+		{"two element array", `["a","b"]`, []any{"a", "b"}},
+
+		// Map keys, keywords, symbols and tags of four characters or more
+		// are cached, and later occurrences are written as ^ codes.
+		{"cached map key", `[["^ ","long-key",1],["^ ","^0",2]]`, []any{
+			map[any]any{"long-key": int64(1)},
+			map[any]any{"long-key": int64(2)},
+		}},
+		{"cached keyword", `["~:block/title","^0"]`, []any{Keyword("block/title"), Keyword("block/title")}},
+		{"short key not cached", `[["^ ","~:a",1,"long",2],["^ ","^0",3]]`, []any{
+			map[any]any{Keyword("a"): int64(1), "long": int64(2)},
+			map[any]any{"long": int64(3)},
+		}},
+		{"cached tag", `[["~#point",[1]],["^0",[2]]]`, []any{
+			Tagged{Tag: "point", Rep: []any{int64(1)}},
+			Tagged{Tag: "point", Rep: []any{int64(2)}},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeTransit([]byte(tt.doc))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeTransitErrors(t *testing.T) {
+	for _, doc := range []string{
+		`["^ ","a"]`,
+		`"^5"`,
+		// Only map keys, keywords, symbols and tags are cached.
+		`["a long string","^0"]`,
+		`"~ixyz"`,
+		`"~zwhat"`,
+		`["~#cmap",[1]]`,
+		`{`,
+	} {
+		if v, err := DecodeTransit([]byte(doc)); err == nil {
+			t.Errorf("DecodeTransit(%s) = %#v, want an error", doc, v)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// graphFile is the file that makes a directory under the graphs directory
+// a graph.
+const graphFile = "db.sqlite"
+
+func graphPath(dir, graph string) string {
+	return filepath.Join(dir, graph, graphFile)
+}
+
+// checkGraphName rejects graph names that are not a single, visible
+// directory name, so that a graph argument cannot leave the graphs
+// directory.
+func checkGraphName(graph string) error {
+	if graph == "" || strings.HasPrefix(graph, ".") || strings.ContainsAny(graph, "/\\\x00") || !filepath.IsLocal(graph) {
+		return &BackendError{Code: errCodeInvalidArgument, Message: fmt.Sprintf("Invalid graph name %q: expected the name of a directory in the graphs directory", graph)}
+	}
+	return nil
+}
+
+// resolveGraphPath returns the absolute path of a graph's database after
+// checking that the name is safe and the file exists.
+func resolveGraphPath(dir, graph string) (string, error) {
+	if err := checkGraphName(graph); err != nil {
+		return "", err
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	path := graphPath(dir, graph)
+	if rel, err := filepath.Rel(dir, path); err != nil || !filepath.IsLocal(rel) {
+		return "", &BackendError{Code: errCodeInvalidArgument, Message: fmt.Sprintf("Invalid graph name %q", graph)}
+	}
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return "", &BackendError{Code: errCodeGraphNotFound, Message: "Database does not exist: " + path}
+	}
+	return path, nil
+}
+
+// fileVersion identifies the state of a graph's database by the size and
+// modification time of db.sqlite and its write-ahead log.
+func fileVersion(path string) string {
+	var version strings.Builder
+	for _, p := range []string{path, path + "-wal"} {
+		if info, err := os.Stat(p); err == nil {
+			fmt.Fprintf(&version, "%d:%d;", info.Size(), info.ModTime().UnixNano())
+		} else {
+			version.WriteString("-;")
+		}
+	}
+	return version.String()
+}
+
+// graphVersion is the fileVersion of a graph in dir.
+func graphVersion(dir, graph string) (string, error) {
+	path, err := resolveGraphPath(dir, graph)
+	if err != nil {
+		return "", err
+	}
+	return fileVersion(path), nil
+}
+
+// scanGraphs returns the names of the directories in dir that hold a
+// graph, sorted. A missing dir holds no graphs.
+func scanGraphs(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var graphs []string
+	for _, e := range entries {
+		if !e.IsDir() || checkGraphName(e.Name()) != nil {
+			continue
+		}
+		if info, err := os.Stat(graphPath(dir, e.Name())); err == nil && info.Mode().IsRegular() {
+			graphs = append(graphs, e.Name())
+		}
+	}
+	return graphs, nil
+}
+
+// statGraph fills in the size and modification time of a graph's file.
+func statGraph(dir string, g *Graph) error {
+	path, err := resolveGraphPath(dir, g.Name)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	modified := info.ModTime()
+	g.Size = info.Size()
+	g.ModifiedAt = &modified
+	return nil
+}
+
+// countGraph fills in the page, block and task counts of a graph.
+func (r graphReader) countGraph(ctx context.Context, g *Graph) error {
+	db, err := r.load(ctx, g.Name)
+	if err != nil {
+		return err
+	}
+	g.Pages = len(db.With("block/name"))
+	g.Blocks = len(db.With("block/page"))
+	g.Tasks = len(db.Tasks())
+	return nil
+}
+
+// currentGraphTimeout bounds the API call behind Graph.Current, so that
+// listing graphs does not stall when Logseq is not running.
+const currentGraphTimeout = 2 * time.Second
+
+// isCurrentGraph reports whether graph is open in the Logseq app behind
+// the API. An unreachable API has no graph open.
+func (w *apiWriter) isCurrentGraph(ctx context.Context, graph string) bool {
+	ctx, cancel := context.WithTimeout(ctx, currentGraphTimeout)
+	defer cancel()
+	current, err := w.api.GetCurrentGraph(ctx)
+	return err == nil && current != nil && current.Name == graph
+}
+
+// listGraphs returns the graphs the backend can read, with the settings
+// the configuration gives them. A graph that cannot be read is listed
+// with the error.
+func (m *MCPServer) listGraphs(ctx context.Context) ([]Graph, error) {
+	names, err := m.backend.ListGraphs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	graphs := make([]Graph, 0, len(names))
+	for _, name := range names {
+		g, err := m.backend.GraphInfo(ctx, name)
+		if err != nil {
+			// One unreadable graph should not hide the others.
+			g = &Graph{Name: name, Error: err.Error()}
+		}
+		if cfg, ok := m.cfg.Graphs[name]; ok && cfg != nil {
+			g.Aliases = cfg.Aliases
+		}
+		g.ReadOnly = m.cfg.isReadOnly(name)
+		graphs = append(graphs, *g)
+	}
+	return graphs, nil
+}
+
+// checkGraph returns a graph-not-found error naming the available graphs
+// if the backend has no graph called graph.
+func (m *MCPServer) checkGraph(ctx context.Context, graph string) error {
+	names, err := m.backend.ListGraphs(ctx)
+	if err != nil {
+		return err
+	}
+	if slices.Contains(names, graph) {
+		return nil
+	}
+	msg := "Graph not found: " + graph
+	if len(names) > 0 {
+		msg += " (available graphs: " + strings.Join(names, ", ") + ")"
+	} else {
+		msg += " (no graphs in " + m.cfg.GraphsDir + ")"
+	}
+	return &BackendError{Code: errCodeGraphNotFound, Message: msg}
+}
@@ -0,0 +1,821 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/slimslenderslacks/mcp-logseq/logseqapi"
+)
+
+func textResult(text string) *mcp.CallToolResult {
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: text},
+		},
+	}
+}
+
+func errorResult(text string) *mcp.CallToolResult {
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: text},
+		},
+		IsError: true,
+	}
+}
+
+// backendErrorResult turns a backend failure into a tool error, with setup
+// instructions when the Logseq HTTP API could not be reached.
+func backendErrorResult(err error) *mcp.CallToolResult {
+	var unavailable *apiUnavailableError
+	var apiErr *logseqapi.Error
+	var scriptErr *scriptError
+	var backendErr *BackendError
+	switch {
+	case errors.As(err, &unavailable):
+		return errorResult(fmt.Sprintf("API call failed: %v\n\n%s", err, unavailableHint(unavailable.addr)))
+	case errors.As(err, &apiErr):
+		return errorResult(fmt.Sprintf("API call failed: %v", err))
+	case errors.As(err, &scriptErr):
+		return errorResult(err.Error())
+	case errors.As(err, &backendErr):
+		return errorResult("Error: " + backendErr.Message)
+	}
+	return errorResult("Error: " + err.Error())
+}
+
+// readGraph runs a read against graph, after resolving aliases and the
+// default graph and checking that the graph exists, and returns the
+// rendered value as the text result and output(value) as the structured
+// result.
+func readGraph[T, Out any](ctx context.Context, m *MCPServer, graph string, read func(graph string) (T, error), render func(T) string, output func(T) *Out) (*mcp.CallToolResult, *Out, error) {
+	graph, err := m.cfg.resolveGraph(graph)
+	if err != nil {
+		return errorResult("Error: " + err.Error()), nil, nil
+	}
+	if err := m.checkGraph(ctx, graph); err != nil {
+		return backendErrorResult(err), nil, nil
+	}
+	v, err := read(graph)
+	if err != nil {
+		return backendErrorResult(err), nil, nil
+	}
+	return textResult(render(v)), output(v), nil
+}
+
+func (m *MCPServer) listAllTasks(ctx context.Context, graph string) (*mcp.CallToolResult, *TaskList, error) {
+	return readGraph(ctx, m, graph, func(graph string) ([]Task, error) {
+		return m.backend.ListTasks(ctx, graph)
+	}, formatTasks, func(tasks []Task) *TaskList {
+		return &TaskList{Tasks: tasks}
+	})
+}
+
+func (m *MCPServer) listGraphsTool(ctx context.Context) (*mcp.CallToolResult, *GraphList, error) {
+	graphs, err := m.listGraphs(ctx)
+	if err != nil {
+		return backendErrorResult(err), nil, nil
+	}
+	return textResult(formatGraphs(graphs)), &GraphList{Graphs: graphs}, nil
+}
+
+// parseDate parses a YYYY-MM-DD date (local midnight) or an RFC 3339
+// timestamp into milliseconds. An empty string is an open bound.
+func parseDate(name, value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	if t, err := time.ParseInLocation(time.DateOnly, value, time.Local); err == nil {
+		return t.UnixMilli(), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return 0, fmt.Errorf("%s: expected YYYY-MM-DD or an RFC 3339 timestamp, got %q", name, value)
+	}
+	return t.UnixMilli(), nil
+}
+
+// taskFilter builds the backend filter from find_tasks arguments.
+func taskFilter(args FindTasksArgs) (TaskFilter, error) {
+	f := TaskFilter{
+		Statuses: args.Status,
+		Priority: args.Priority,
+		Page:     args.Page,
+		Tag:      args.Tag,
+		Text:     args.Text,
+		Parent:   args.Parent,
+	}
+	bounds := []struct {
+		name  string
+		value string
+		dst   *int64
+	}{
+		{"createdAfter", args.CreatedAfter, &f.Created.After},
+		{"createdBefore", args.CreatedBefore, &f.Created.Before},
+		{"updatedAfter", args.UpdatedAfter, &f.Updated.After},
+		{"updatedBefore", args.UpdatedBefore, &f.Updated.Before},
+		{"deadlineAfter", args.DeadlineAfter, &f.Deadline.After},
+		{"deadlineBefore", args.DeadlineBefore, &f.Deadline.Before},
+		{"scheduledAfter", args.ScheduledAfter, &f.Scheduled.After},
+		{"scheduledBefore", args.ScheduledBefore, &f.Scheduled.Before},
+	}
+	for _, b := range bounds {
+		ms, err := parseDate(b.name, b.value)
+		if err != nil {
+			return TaskFilter{}, err
+		}
+		*b.dst = ms
+	}
+	return f, nil
+}
+
+func (m *MCPServer) findTasks(ctx context.Context, args FindTasksArgs) (*mcp.CallToolResult, *TaskList, error) {
+	filter, err := taskFilter(args)
+	if err != nil {
+		return errorResult("Error: " + err.Error()), nil, nil
+	}
+	if args.Sort != "" && !slices.Contains(taskSortFields, args.Sort) {
+		return errorResult(fmt.Sprintf("Error: sort must be one of %s", strings.Join(taskSortFields, ", "))), nil, nil
+	}
+	return readGraph(ctx, m, args.Graph, func(graph string) ([]Task, error) {
+		tasks, err := m.backend.FindTasks(ctx, graph, filter)
+		if err != nil {
+			return nil, err
+		}
+		sortTasks(tasks, args.Sort, args.Descending)
+		if args.Limit > 0 && len(tasks) > args.Limit {
+			tasks = tasks[:args.Limit]
+		}
+		return tasks, nil
+	}, formatFoundTasks, func(tasks []Task) *TaskList {
+		return &TaskList{Tasks: tasks}
+	})
+}
+
+// defaultUpcomingDays is how far ahead list_upcoming_tasks looks unless
+// told otherwise.
+const defaultUpcomingDays = 7
+
+func (m *MCPServer) listUpcomingTasks(ctx context.Context, args ListUpcomingTasksArgs) (*mcp.CallToolResult, *UpcomingTasks, error) {
+	if args.Days < 0 {
+		return errorResult("Error: days must not be negative"), nil, nil
+	}
+	if args.Days == 0 {
+		args.Days = defaultUpcomingDays
+	}
+	now := time.Now()
+	return readGraph(ctx, m, args.Graph, func(graph string) (*UpcomingTasks, error) {
+		tasks, err := m.backend.ListTasks(ctx, graph)
+		if err != nil {
+			return nil, err
+		}
+		return upcomingTasks(tasks, now, args.Days), nil
+	}, formatUpcomingTasks, func(upcoming *UpcomingTasks) *UpcomingTasks {
+		return upcoming
+	})
+}
+
+func (m *MCPServer) getBlockTree(ctx context.Context, args GetBlockTreeArgs) (*mcp.CallToolResult, *BlockTree, error) {
+	if args.PageOrBlockID == "" {
+		return errorResult("Error: pageOrBlockId parameter is required"), nil, nil
+	}
+	if args.MaxDepth < 0 {
+		return errorResult("Error: maxDepth must not be negative"), nil, nil
+	}
+	if args.Format == "" {
+		args.Format = "markdown"
+	}
+	if !slices.Contains(blockTreeFormats, args.Format) {
+		return errorResult(fmt.Sprintf("Error: format must be one of %s", strings.Join(blockTreeFormats, ", "))), nil, nil
+	}
+	properties := args.Properties == nil || *args.Properties
+	return readGraph(ctx, m, args.Graph, func(graph string) (*BlockTree, error) {
+		tree, err := m.backend.GetBlockTree(ctx, graph, args.PageOrBlockID)
+		if err != nil {
+			return nil, err
+		}
+		pruned := *tree
+		pruned.Blocks = pruneBlocks(tree.Blocks, args.MaxDepth, properties)
+		return &pruned, nil
+	}, func(tree *BlockTree) string {
+		return formatBlockTree(tree, args.Format)
+	}, func(tree *BlockTree) *BlockTree {
+		return tree
+	})
+}
+
+// pruneBlocks returns a copy of blocks cut off below depth levels (0 keeps
+// them all) and without their properties unless properties is set. blocks
+// may be cached, so it is left as it is.
+func pruneBlocks(blocks []BlockNode, depth int, properties bool) []BlockNode {
+	blocks = slices.Clone(blocks)
+	for i := range blocks {
+		b := &blocks[i]
+		if !properties {
+			b.Properties = nil
+		}
+		switch {
+		case depth == 1 && len(b.Children) > 0:
+			b.Children = nil
+			b.Truncated = true
+		case depth != 1:
+			b.Children = pruneBlocks(b.Children, max(depth-1, 0), properties)
+		}
+	}
+	return blocks
+}
+
+// Result page sizes of search.
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+func (m *MCPServer) search(ctx context.Context, args SearchArgs) (*mcp.CallToolResult, *SearchResults, error) {
+	if strings.TrimSpace(args.Query) == "" {
+		return errorResult("Error: query parameter is required"), nil, nil
+	}
+	if args.Limit < 0 || args.Limit > maxSearchLimit || args.Offset < 0 {
+		return errorResult(fmt.Sprintf("Error: limit must be between 1 and %d and offset must not be negative", maxSearchLimit)), nil, nil
+	}
+	if args.Limit == 0 {
+		args.Limit = defaultSearchLimit
+	}
+	return readGraph(ctx, m, args.Graph, func(graph string) (*SearchResults, error) {
+		return m.backend.Search(ctx, graph, SearchQuery{Query: args.Query, Limit: args.Limit, Offset: args.Offset})
+	}, formatSearchResults, func(results *SearchResults) *SearchResults {
+		return results
+	})
+}
+
+// writeGraph resolves the graph a write goes to, checks that it exists and
+// refuses read-only graphs. Without a graph argument or default graph the
+// result is "", and the backend writes to the graph open in Logseq after
+// checking that it is not read-only.
+func (m *MCPServer) writeGraph(ctx context.Context, graph string) (string, error) {
+	if graph != "" || m.cfg.DefaultGraph != "" {
+		var err error
+		if graph, err = m.cfg.resolveGraph(graph); err != nil {
+			return "", err
+		}
+		if err := m.checkGraph(ctx, graph); err != nil {
+			return "", err
+		}
+	}
+	if m.cfg.isReadOnly(graph) {
+		return "", readOnlyError(graph)
+	}
+	return graph, nil
+}
+
+// normalizeSchedule resolves deadline, scheduled and repeat arguments in
+// place: dates to RFC 3339 and recurrences to their canonical spelling.
+// clearable allows "none", which removes the date or recurrence.
+func normalizeSchedule(deadline, scheduled, repeat *string, clearable bool) error {
+	now := time.Now()
+	var err error
+	if *deadline, err = normalizeWhen("deadline", *deadline, now); err != nil {
+		return err
+	}
+	if *scheduled, err = normalizeWhen("scheduled", *scheduled, now); err != nil {
+		return err
+	}
+	if *repeat, err = normalizeRepeat(*repeat); err != nil {
+		return err
+	}
+	if !clearable && (*deadline == clearValue || *scheduled == clearValue || *repeat == clearValue) {
+		return fmt.Errorf("%q only removes a date or recurrence in update_task", clearValue)
+	}
+	return nil
+}
+
+// scheduleTime returns a normalized deadline or scheduled argument as a
+// time, or nil if it sets none.
+func scheduleTime(value string) *time.Time {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+// writeSchedule lists the dates and recurrence a task write set.
+func writeSchedule(sb *strings.Builder, indent string, deadline, scheduled *time.Time, repeat string) {
+	if deadline != nil {
+		fmt.Fprintf(sb, "%sDeadline: %s\n", indent, formatTime(deadline))
+	}
+	if scheduled != nil {
+		fmt.Fprintf(sb, "%sScheduled: %s\n", indent, formatTime(scheduled))
+	}
+	if repeat != "" && repeat != clearValue {
+		fmt.Fprintf(sb, "%sRepeat: %s\n", indent, repeat)
+	}
+}
+
+func (m *MCPServer) createTask(ctx context.Context, args CreateTaskArgs) (*mcp.CallToolResult, *CreatedBlock, error) {
+	if args.PageOrBlockID == "" || args.Content == "" {
+		return errorResult("Error: pageOrBlockId and content parameters are required"), nil, nil
+	}
+	if args.Status == "" {
+		args.Status = "Todo"
+	}
+	if args.Priority == "" {
+		args.Priority = "Medium"
+	}
+	if err := normalizeSchedule(&args.Deadline, &args.Scheduled, &args.Repeat, false); err != nil {
+		return errorResult("Error: " + err.Error()), nil, nil
+	}
+	if args.Repeat != "" && args.Deadline == "" && args.Scheduled == "" {
+		return errorResult("Error: a repeating task needs a deadline or scheduled date to repeat"), nil, nil
+	}
+
+	graph, err := m.writeGraph(ctx, args.Graph)
+	if err != nil {
+		return backendErrorResult(err), nil, nil
+	}
+	args.Graph = graph
+
+	block, err := m.backend.CreateTask(ctx, args)
+	if err != nil {
+		return backendErrorResult(err), nil, nil
+	}
+
+	created := &CreatedBlock{
+		ID:        block.ID,
+		UUID:      block.UUID,
+		Content:   args.Content,
+		Status:    args.Status,
+		Priority:  args.Priority,
+		Deadline:  scheduleTime(args.Deadline),
+		Scheduled: scheduleTime(args.Scheduled),
+		Repeat:    args.Repeat,
+	}
+	taskType := "Top-level task"
+	if isUUID(args.PageOrBlockID) {
+		taskType = "Sub-task"
+		created.Parent = args.PageOrBlockID
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "✓ %s created successfully!\n", taskType)
+	fmt.Fprintf(&sb, "  Block ID: %d\n", block.ID)
+	fmt.Fprintf(&sb, "  UUID: %s\n", block.UUID)
+	fmt.Fprintf(&sb, "  Title: %s\n", args.Content)
+	fmt.Fprintf(&sb, "  Status: %s\n", args.Status)
+	fmt.Fprintf(&sb, "  Priority: %s\n", args.Priority)
+	writeSchedule(&sb, "  ", created.Deadline, created.Scheduled, created.Repeat)
+	if created.Parent != "" {
+		fmt.Fprintf(&sb, "  Parent UUID: %s\n", created.Parent)
+	}
+	return textResult(sb.String()), created, nil
+}
+
+func (m *MCPServer) completeTask(ctx context.Context, args CompleteTaskArgs) (*mcp.CallToolResult, *TaskUpdate, error) {
+	if args.UUID == "" {
+		return errorResult("Error: uuid parameter is required"), nil, nil
+	}
+	graph, err := m.writeGraph(ctx, args.Graph)
+	if err != nil {
+		return backendErrorResult(err), nil, nil
+	}
+	args.Graph = graph
+
+	update, err := m.backend.CompleteTask(ctx, args)
+	if err != nil {
+		return backendErrorResult(err), nil, nil
+	}
+	var sb strings.Builder
+	if update.Repeat != "" {
+		fmt.Fprintf(&sb, "✓ Repeating task completed and rescheduled\n  UUID: %s\n  Status: %s\n", args.UUID, update.Status)
+		writeSchedule(&sb, "  ", update.Deadline, update.Scheduled, update.Repeat)
+	} else {
+		fmt.Fprintf(&sb, "✓ Task marked as complete!\n  UUID: %s\n  Status: Done\n", args.UUID)
+	}
+	return textResult(sb.String()), update, nil
+}
+
+func (m *MCPServer) updateTask(ctx context.Context, args UpdateTaskArgs) (*mcp.CallToolResult, *TaskUpdate, error) {
+	if args.UUID == "" {
+		return errorResult("Error: uuid parameter is required"), nil, nil
+	}
+	if args.Status == "" && args.Content == "" && args.Deadline == "" && args.Scheduled == "" && args.Repeat == "" {
+		return errorResult("Error: at least one of status, content, deadline, scheduled or repeat must be provided"), nil, nil
+	}
+	if err := normalizeSchedule(&args.Deadline, &args.Scheduled, &args.Repeat, true); err != nil {
+		return errorResult("Error: " + err.Error()), nil, nil
+	}
+	graph, err := m.writeGraph(ctx, args.Graph)
+	if err != nil {
+		return backendErrorResult(err), nil, nil
+	}
+	args.Graph = graph
+
+	if err := m.backend.UpdateTask(ctx, args); err != nil {
+		return backendErrorResult(err), nil, nil
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "✓ Task updated\n  UUID: %s\n  Updated:\n", args.UUID)
+	if args.Status != "" {
+		fmt.Fprintf(&sb, "   - Status: %s\n", args.Status)
+	}
+	if args.Content != "" {
+		fmt.Fprintf(&sb, "   - Content: %s\n", args.Content)
+	}
+	update := &TaskUpdate{
+		UUID:      args.UUID,
+		Status:    args.Status,
+		Content:   args.Content,
+		Deadline:  scheduleTime(args.Deadline),
+		Scheduled: scheduleTime(args.Scheduled),
+	}
+	if args.Repeat != clearValue {
+		update.Repeat = args.Repeat
+	}
+	writeSchedule(&sb, "   - ", update.Deadline, update.Scheduled, update.Repeat)
+	for _, f := range []struct{ name, value string }{{"deadline", args.Deadline}, {"scheduled", args.Scheduled}, {"repeat", args.Repeat}} {
+		if f.value == clearValue {
+			update.Cleared = append(update.Cleared, f.name)
+			fmt.Fprintf(&sb, "   - Removed %s\n", f.name)
+		}
+	}
+	return textResult(sb.String()), update, nil
+}
+
+func (m *MCPServer) addContent(ctx context.Context, args AddContentArgs) (*mcp.CallToolResult, *CreatedBlock, error) {
+	if args.PageOrBlockID == "" || args.Content == "" {
+		return errorResult("Error: pageOrBlockId and content parameters are required"), nil, nil
+	}
+
+	graph, err := m.writeGraph(ctx, args.Graph)
+	if err != nil {
+		return backendErrorResult(err), nil, nil
+	}
+	args.Graph = graph
+
+	block, err := m.backend.AddContent(ctx, args)
+	if err != nil {
+		return backendErrorResult(err), nil, nil
+	}
+
+	created := &CreatedBlock{ID: block.ID, UUID: block.UUID, Content: args.Content}
+	contentType := "Top-level block"
+	if isUUID(args.PageOrBlockID) {
+		contentType = "Child block"
+		created.Parent = args.PageOrBlockID
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "✓ %s created successfully!\n", contentType)
+	fmt.Fprintf(&sb, "  Block ID: %d\n", block.ID)
+	fmt.Fprintf(&sb, "  UUID: %s\n", block.UUID)
+	fmt.Fprintf(&sb, "  Content: %s\n", args.Content)
+	if created.Parent != "" {
+		fmt.Fprintf(&sb, "  Parent UUID: %s\n", created.Parent)
+	}
+	return textResult(sb.String()), created, nil
+}
+
+func (m *MCPServer) getJournal(ctx context.Context, args GetJournalArgs) (*mcp.CallToolResult, *PageContent, error) {
+	day, err := parseJournalDate(args.Date, time.Now())
+	if err != nil {
+		return errorResult("Error: date: " + err.Error()), nil, nil
+	}
+	return readGraph(ctx, m, args.Graph, func(graph string) (*PageContent, error) {
+		n := int(journalDay(day))
+		journals, err := m.backend.ListJournals(ctx, graph, n, n)
+		if err != nil {
+			return nil, err
+		}
+		if len(journals) == 0 {
+			return nil, &BackendError{Code: errCodePageNotFound, Message: "No journal page for " + day.Format(time.DateOnly)}
+		}
+		return m.backend.GetPage(ctx, graph, journals[0].UUID)
+	}, formatPage, func(content *PageContent) *PageContent {
+		return content
+	})
+}
+
+func (m *MCPServer) listJournals(ctx context.Context, args ListJournalsArgs) (*mcp.CallToolResult, *JournalList, error) {
+	if args.Limit < 0 {
+		return errorResult("Error: limit must not be negative"), nil, nil
+	}
+	now := time.Now()
+	var from, to int
+	for _, bound := range []struct {
+		name, value string
+		day         *int
+	}{{"from", args.From, &from}, {"to", args.To, &to}} {
+		if bound.value == "" {
+			continue
+		}
+		day, err := parseJournalDate(bound.value, now)
+		if err != nil {
+			return errorResult(fmt.Sprintf("Error: %s: %v", bound.name, err)), nil, nil
+		}
+		*bound.day = int(journalDay(day))
+	}
+	if from != 0 && to != 0 && from > to {
+		return errorResult("Error: from must not be after to"), nil, nil
+	}
+	return readGraph(ctx, m, args.Graph, func(graph string) ([]Page, error) {
+		journals, err := m.backend.ListJournals(ctx, graph, from, to)
+		if args.Limit > 0 && len(journals) > args.Limit {
+			journals = journals[:args.Limit]
+		}
+		return journals, err
+	}, formatJournals, func(journals []Page) *JournalList {
+		return &JournalList{Journals: journals}
+	})
+}
+
+func (m *MCPServer) appendToJournal(ctx context.Context, args AppendToJournalArgs) (*mcp.CallToolResult, *JournalEntry, error) {
+	if args.Content == "" {
+		return errorResult("Error: content parameter is required"), nil, nil
+	}
+	day, err := parseJournalDate(args.Date, time.Now())
+	if err != nil {
+		return errorResult("Error: date: " + err.Error()), nil, nil
+	}
+	args.Date = day.Format(time.DateOnly)
+
+	graph, err := m.writeGraph(ctx, args.Graph)
+	if err != nil {
+		return backendErrorResult(err), nil, nil
+	}
+	args.Graph = graph
+
+	entry, err := m.backend.AppendToJournal(ctx, args)
+	if err != nil {
+		return backendErrorResult(err), nil, nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString("✓ Block added to journal!\n")
+	fmt.Fprintf(&sb, "  Journal: %s (%s)\n", entry.Page, entry.Date)
+	if entry.PageCreated {
+		sb.WriteString("  Journal page created\n")
+	}
+	fmt.Fprintf(&sb, "  Block ID: %d\n", entry.ID)
+	fmt.Fprintf(&sb, "  UUID: %s\n", entry.UUID)
+	fmt.Fprintf(&sb, "  Content: %s\n", entry.Content)
+	return textResult(sb.String()), entry, nil
+}
+
+func (m *MCPServer) moveBlock(ctx context.Context, args MoveBlockArgs) (*mcp.CallToolResult, *BlockChange, error) {
+	if args.UUID == "" || args.Target == "" {
+		return errorResult("Error: uuid and target parameters are required"), nil, nil
+	}
+	if args.Position == "" {
+		args.Position = "last-child"
+	}
+	if !slices.Contains(blockPositions, args.Position) {
+		return errorResult(fmt.Sprintf("Error: position must be one of %s", strings.Join(blockPositions, ", "))), nil, nil
+	}
+	if (args.Position == "before" || args.Position == "after") && !isUUID(args.Target) {
+		return errorResult("Error: target must be a block UUID to move a block before or after it"), nil, nil
+	}
+	if args.UUID == args.Target {
+		return errorResult("Error: cannot move a block relative to itself"), nil, nil
+	}
+	graph, err := m.writeGraph(ctx, args.Graph)
+	if err != nil {
+		return backendErrorResult(err), nil, nil
+	}
+	args.Graph = graph
+
+	if err := m.backend.MoveBlock(ctx, args); err != nil {
+		return backendErrorResult(err), nil, nil
+	}
+	text := fmt.Sprintf("✓ Block moved\n  UUID: %s\n  Target: %s\n  Position: %s\n", args.UUID, args.Target, args.Position)
+	return textResult(text), &BlockChange{UUID: args.UUID, Action: "moved", Target: args.Target, Position: args.Position}, nil
+}
+
+func (m *MCPServer) deleteBlock(ctx context.Context, args DeleteBlockArgs) (*mcp.CallToolResult, *BlockChange, error) {
+	if args.UUID == "" {
+		return errorResult("Error: uuid parameter is required"), nil, nil
+	}
+	graph, err := m.writeGraph(ctx, args.Graph)
+	if err != nil {
+		return backendErrorResult(err), nil, nil
+	}
+	args.Graph = graph
+
+	if err := m.backend.DeleteBlock(ctx, args); err != nil {
+		return backendErrorResult(err), nil, nil
+	}
+	children := "moved up into its place"
+	if args.Recursive {
+		children = "deleted"
+	}
+	text := fmt.Sprintf("✓ Block deleted\n  UUID: %s\n  Children: %s\n", args.UUID, children)
+	return textResult(text), &BlockChange{UUID: args.UUID, Action: "deleted", Recursive: args.Recursive}, nil
+}
+
+func (m *MCPServer) indentBlock(ctx context.Context, args IndentBlockArgs, outdent bool) (*mcp.CallToolResult, *BlockChange, error) {
+	if args.UUID == "" {
+		return errorResult("Error: uuid parameter is required"), nil, nil
+	}
+	graph, err := m.writeGraph(ctx, args.Graph)
+	if err != nil {
+		return backendErrorResult(err), nil, nil
+	}
+	args.Graph = graph
+
+	if err := m.backend.IndentBlock(ctx, args, outdent); err != nil {
+		return backendErrorResult(err), nil, nil
+	}
+	action := "indented"
+	if outdent {
+		action = "outdented"
+	}
+	text := fmt.Sprintf("✓ Block %s\n  UUID: %s\n", action, args.UUID)
+	return textResult(text), &BlockChange{UUID: args.UUID, Action: action}, nil
+}
+
+func (m *MCPServer) createPage(ctx context.Context, args CreatePageArgs) (*mcp.CallToolResult, *PageChange, error) {
+	if strings.TrimSpace(args.Name) == "" {
+		return errorResult("Error: name parameter is required"), nil, nil
+	}
+	graph, err := m.writeGraph(ctx, args.Graph)
+	if err != nil {
+		return backendErrorResult(err), nil, nil
+	}
+	args.Graph = graph
+
+	page, blocks, err := m.backend.CreatePage(ctx, args)
+	if err != nil {
+		return backendErrorResult(err), nil, nil
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "✓ Page created successfully!\n")
+	fmt.Fprintf(&sb, "  Title: %s\n", args.Name)
+	fmt.Fprintf(&sb, "  UUID: %s\n", page.UUID)
+	for _, k := range slices.Sorted(maps.Keys(args.Properties)) {
+		fmt.Fprintf(&sb, "  %s:: %s\n", k, args.Properties[k])
+	}
+	if len(args.Tags) > 0 {
+		fmt.Fprintf(&sb, "  Tags: %s\n", strings.Join(args.Tags, ", "))
+	}
+	if blocks > 0 {
+		fmt.Fprintf(&sb, "  Blocks: %d\n", blocks)
+	}
+	return textResult(sb.String()), &PageChange{UUID: page.UUID, Title: args.Name, Action: "created", Blocks: blocks}, nil
+}
+
+func (m *MCPServer) renamePage(ctx context.Context, args RenamePageArgs) (*mcp.CallToolResult, *PageChange, error) {
+	if args.Name == "" || strings.TrimSpace(args.NewName) == "" {
+		return errorResult("Error: name and newName parameters are required"), nil, nil
+	}
+	graph, err := m.writeGraph(ctx, args.Graph)
+	if err != nil {
+		return backendErrorResult(err), nil, nil
+	}
+	args.Graph = graph
+
+	if err := m.backend.RenamePage(ctx, args); err != nil {
+		return backendErrorResult(err), nil, nil
+	}
+	text := fmt.Sprintf("✓ Page renamed\n  Old Title: %s\n  New Title: %s\n", args.Name, args.NewName)
+	return textResult(text), &PageChange{Title: args.NewName, OldTitle: args.Name, Action: "renamed"}, nil
+}
+
+// deleteToken identifies the state of a page that a delete_page preview
+// showed, so a confirmation only deletes the page the preview described.
+func deleteToken(graph string, content *PageContent) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%d", graph, content.Page.UUID, len(content.Blocks))
+	if content.Page.UpdatedAt != nil {
+		fmt.Fprintf(h, "\x00%d", content.Page.UpdatedAt.UnixMilli())
+	}
+	return hex.EncodeToString(h.Sum(nil))[:12]
+}
+
+// deletePage previews the deletion of a page and returns a confirmation
+// token, or deletes the page when called with that token.
+func (m *MCPServer) deletePage(ctx context.Context, args DeletePageArgs) (*mcp.CallToolResult, *PageChange, error) {
+	if args.Name == "" {
+		return errorResult("Error: name parameter is required"), nil, nil
+	}
+	graph, err := m.writeGraph(ctx, args.Graph)
+	if err != nil {
+		return backendErrorResult(err), nil, nil
+	}
+	// The preview reads the page from the graph the delete goes to.
+	if graph == "" {
+		if graph, err = m.backend.CurrentGraph(ctx); err != nil {
+			return backendErrorResult(err), nil, nil
+		}
+		if m.cfg.isReadOnly(graph) {
+			return backendErrorResult(readOnlyError(graph)), nil, nil
+		}
+	}
+	args.Graph = graph
+
+	content, err := m.backend.GetPage(ctx, graph, args.Name)
+	if err != nil {
+		return backendErrorResult(err), nil, nil
+	}
+	refs, err := m.backend.GetReferences(ctx, graph, content.Page.UUID)
+	if err != nil {
+		return backendErrorResult(err), nil, nil
+	}
+	references := 0
+	for _, g := range slices.Concat(refs.Linked, refs.Tagged) {
+		references += len(g.References)
+	}
+	change := &PageChange{
+		UUID:       content.Page.UUID,
+		Title:      content.Page.Title,
+		Blocks:     len(content.Blocks),
+		References: references,
+	}
+
+	token := deleteToken(graph, content)
+	if args.Confirm == "" {
+		change.Action = "confirm-delete"
+		change.ConfirmToken = token
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "Deleting page %s (UUID %s) will delete its %d blocks.\n", content.Page.Title, content.Page.UUID, len(content.Blocks))
+		if references > 0 {
+			fmt.Fprintf(&sb, "%d blocks or pages elsewhere link to it or are tagged with it.\n", references)
+		}
+		fmt.Fprintf(&sb, "To delete it, call delete_page again with confirm: %q\n", token)
+		return textResult(sb.String()), change, nil
+	}
+	if args.Confirm != token {
+		return errorResult("Error: confirm does not match the page; it may have changed since the preview. Call delete_page without confirm to get a new token."), nil, nil
+	}
+
+	if err := m.backend.DeletePage(ctx, args); err != nil {
+		return backendErrorResult(err), nil, nil
+	}
+	change.Action = "deleted"
+	text := fmt.Sprintf("✓ Page deleted\n  Title: %s\n  UUID: %s\n  Blocks deleted: %d\n", content.Page.Title, content.Page.UUID, len(content.Blocks))
+	return textResult(text), change, nil
+}
+
+func (m *MCPServer) setPageProperty(ctx context.Context, args SetPagePropertyArgs) (*mcp.CallToolResult, *PageChange, error) {
+	if args.Name == "" || strings.TrimSpace(args.Key) == "" {
+		return errorResult("Error: name and key parameters are required"), nil, nil
+	}
+	graph, err := m.writeGraph(ctx, args.Graph)
+	if err != nil {
+		return backendErrorResult(err), nil, nil
+	}
+	args.Graph = graph
+
+	if err := m.backend.SetPageProperty(ctx, args); err != nil {
+		return backendErrorResult(err), nil, nil
+	}
+	text := fmt.Sprintf("✓ Page property set\n  Page: %s\n  %s:: %s\n", args.Name, args.Key, args.Value)
+	return textResult(text), &PageChange{Title: args.Name, Action: "property-set", Property: args.Key, Value: args.Value}, nil
+}
+
+func (m *MCPServer) setBlockProperty(ctx context.Context, args SetBlockPropertyArgs) (*mcp.CallToolResult, *PropertyChange, error) {
+	if args.UUID == "" || strings.TrimSpace(args.Key) == "" || args.Value == nil {
+		return errorResult("Error: uuid, key and value parameters are required"), nil, nil
+	}
+	graph, err := m.writeGraph(ctx, args.Graph)
+	if err != nil {
+		return backendErrorResult(err), nil, nil
+	}
+	args.Graph = graph
+
+	change, err := m.backend.SetBlockProperty(ctx, args)
+	if err != nil {
+		return backendErrorResult(err), nil, nil
+	}
+	text := fmt.Sprintf("✓ Block property set\n  UUID: %s\n  %s:: %s\n", change.UUID, change.Title, strings.Join(change.Values, ", "))
+	return textResult(text), change, nil
+}
+
+func (m *MCPServer) removeBlockProperty(ctx context.Context, args RemoveBlockPropertyArgs) (*mcp.CallToolResult, *PropertyChange, error) {
+	if args.UUID == "" || strings.TrimSpace(args.Key) == "" {
+		return errorResult("Error: uuid and key parameters are required"), nil, nil
+	}
+	graph, err := m.writeGraph(ctx, args.Graph)
+	if err != nil {
+		return backendErrorResult(err), nil, nil
+	}
+	args.Graph = graph
+
+	change, err := m.backend.RemoveBlockProperty(ctx, args)
+	if err != nil {
+		return backendErrorResult(err), nil, nil
+	}
+	text := fmt.Sprintf("✓ Block property removed\n  UUID: %s\n  Property: %s\n", change.UUID, change.Title)
+	if change.Action == "unchanged" {
+		text = fmt.Sprintf("Block %s has no %s property; nothing to remove\n", change.UUID, change.Title)
+	}
+	return textResult(text), change, nil
+}
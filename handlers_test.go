@@ -0,0 +1,382 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// connect serves cfg and backend to an in-memory client session.
+func connect(t *testing.T, cfg *Config, backend Backend) *mcp.ClientSession {
+	t.Helper()
+	ctx := context.Background()
+	cfg.applyDefaults()
+	server := newMCPServer(cfg, backend)
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	if _, err := server.server.Connect(ctx, serverTransport, nil); err != nil {
+		t.Fatal(err)
+	}
+	session, err := mcp.NewClient(&mcp.Implementation{Name: "test"}, nil).Connect(ctx, clientTransport, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { session.Close() })
+	return session
+}
+
+// newMemoryServer connects to a memory backend holding graphs, the first
+// of which stands in for the graph open in Logseq.
+func newMemoryServer(t *testing.T, cfg *Config, graphs ...string) *mcp.ClientSession {
+	t.Helper()
+	cfg.Backend = backendMemory
+	b := newMemoryBackend(graphs...)
+	b.readOnly = cfg.isReadOnly
+	return connect(t, cfg, b)
+}
+
+func callTool(t *testing.T, session *mcp.ClientSession, name string, args map[string]any) *mcp.CallToolResult {
+	t.Helper()
+	res, err := session.CallTool(context.Background(), &mcp.CallToolParams{Name: name, Arguments: args})
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	return res
+}
+
+func resultText(res *mcp.CallToolResult) string {
+	var sb strings.Builder
+	for _, c := range res.Content {
+		if text, ok := c.(*mcp.TextContent); ok {
+			sb.WriteString(text.Text)
+		}
+	}
+	return sb.String()
+}
+
+// wantText fails t unless res succeeded and its text contains each of want.
+func wantText(t *testing.T, res *mcp.CallToolResult, want ...string) {
+	t.Helper()
+	text := resultText(res)
+	if res.IsError {
+		t.Errorf("got error %q", text)
+		return
+	}
+	for _, w := range want {
+		if !strings.Contains(text, w) {
+			t.Errorf("got %q, want it to contain %q", text, w)
+		}
+	}
+}
+
+// wantError fails t unless res is an error whose text contains want.
+func wantError(t *testing.T, res *mcp.CallToolResult, want string) {
+	t.Helper()
+	if text := resultText(res); !res.IsError || !strings.Contains(text, want) {
+		t.Errorf("got %q (error %v), want an error containing %q", text, res.IsError, want)
+	}
+}
+
+var uuidLine = regexp.MustCompile(`UUID: (\S+)`)
+
+// createdUUID returns the UUID a create_task or add_content result names.
+func createdUUID(t *testing.T, res *mcp.CallToolResult) string {
+	t.Helper()
+	m := uuidLine.FindStringSubmatch(resultText(res))
+	if res.IsError || m == nil {
+		t.Fatalf("got %q, want a created block", resultText(res))
+	}
+	return m[1]
+}
+
+func TestCreateTask(t *testing.T) {
+	session := newMemoryServer(t, &Config{})
+
+	res := callTool(t, session, "create_task", map[string]any{"pageOrBlockId": "Inbox", "content": "Plan the offsite"})
+	wantText(t, res, "Top-level task created", "Status: Todo", "Priority: Medium")
+	parent := createdUUID(t, res)
+
+	res = callTool(t, session, "create_task", map[string]any{"pageOrBlockId": parent, "content": "Book a venue", "status": "Doing", "priority": "High"})
+	wantText(t, res, "Sub-task created", "Parent UUID: "+parent)
+
+	res = callTool(t, session, "list_all_tasks", map[string]any{"graph": "mcp"})
+	wantText(t, res, "Title: Plan the offsite", "Title: Book a venue", "Status: Doing", "Priority: High")
+
+	wantError(t, callTool(t, session, "create_task", map[string]any{"pageOrBlockId": "Inbox", "content": ""}), "pageOrBlockId and content parameters are required")
+}
+
+func TestCompleteAndUpdateTask(t *testing.T) {
+	session := newMemoryServer(t, &Config{})
+	uuid := createdUUID(t, callTool(t, session, "create_task", map[string]any{"pageOrBlockId": "Inbox", "content": "Call Bob"}))
+
+	wantText(t, callTool(t, session, "update_task", map[string]any{"uuid": uuid, "status": "Doing", "content": "Call Bob back"}), "Status: Doing", "Content: Call Bob back")
+	wantText(t, callTool(t, session, "list_all_tasks", map[string]any{"graph": "mcp"}), "Title: Call Bob back", "Status: Doing")
+
+	wantText(t, callTool(t, session, "complete_task", map[string]any{"uuid": uuid}), "Task marked as complete")
+	wantText(t, callTool(t, session, "list_all_tasks", map[string]any{"graph": "mcp"}), "Status: Done")
+
+	wantError(t, callTool(t, session, "complete_task", map[string]any{"uuid": ""}), "uuid parameter is required")
+	wantError(t, callTool(t, session, "update_task", map[string]any{"uuid": uuid}), "at least one of status, content, deadline, scheduled or repeat must be provided")
+	wantError(t, callTool(t, session, "complete_task", map[string]any{"uuid": "00000000-0000-0000-0000-000000000000"}), "not found")
+}
+
+func TestAddContent(t *testing.T) {
+	session := newMemoryServer(t, &Config{})
+
+	res := callTool(t, session, "add_content", map[string]any{"pageOrBlockId": "Notes", "content": "Ideas for the offsite"})
+	wantText(t, res, "Top-level block created")
+	parent := createdUUID(t, res)
+	wantText(t, callTool(t, session, "add_content", map[string]any{"pageOrBlockId": parent, "content": "A boat trip"}), "Child block created", "Parent UUID: "+parent)
+
+	wantText(t, callTool(t, session, "get_page", map[string]any{"graph": "mcp", "pageName": "notes"}), "Ideas for the offsite", "A boat trip")
+	wantText(t, callTool(t, session, "list_pages", map[string]any{"graph": "mcp"}), "Notes")
+}
+
+func TestReadToolsCheckGraph(t *testing.T) {
+	session := newMemoryServer(t, &Config{}, "mcp", "Demo")
+	callTool(t, session, "create_task", map[string]any{"pageOrBlockId": "Inbox", "content": "Call Bob"})
+
+	for _, tool := range []string{"list_all_tasks", "list_tasks_by_status", "find_tasks", "list_pages", "list_tags", "list_properties"} {
+		wantError(t, callTool(t, session, tool, map[string]any{"graph": ""}), "graph parameter is required")
+		wantError(t, callTool(t, session, tool, map[string]any{"graph": "nope"}), "nope")
+	}
+	// Writes without a graph go to the first graph.
+	wantText(t, callTool(t, session, "list_tasks_by_status", map[string]any{"graph": "mcp"}), "Todo", "Call Bob")
+	if text := resultText(callTool(t, session, "list_all_tasks", map[string]any{"graph": "Demo"})); strings.Contains(text, "Call Bob") {
+		t.Errorf("Demo lists a task written to mcp: %q", text)
+	}
+}
+
+// structured decodes the structured content of a successful result into
+// out.
+func structured(t *testing.T, res *mcp.CallToolResult, out any) {
+	t.Helper()
+	if res.IsError {
+		t.Fatalf("got error %q", resultText(res))
+	}
+	data, err := json.Marshal(res.StructuredContent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		t.Fatalf("decoding %s: %v", data, err)
+	}
+}
+
+func TestFindTasks(t *testing.T) {
+	session := newMemoryServer(t, &Config{})
+	report := createdUUID(t, callTool(t, session, "create_task", map[string]any{"pageOrBlockId": "Work", "content": "Write report", "status": "Todo", "priority": "Medium", "deadline": "2030-01-10"}))
+	tasks := []map[string]any{
+		{"pageOrBlockId": report, "content": "Review report", "status": "Doing", "priority": "High", "deadline": "2030-01-05"},
+		{"pageOrBlockId": "Work", "content": "File expenses", "status": "Done", "priority": "Low"},
+		{"pageOrBlockId": "Home", "content": "Fix the sink", "status": "Todo", "priority": "Medium", "scheduled": "2030-02-01"},
+	}
+	for _, args := range tasks {
+		createdUUID(t, callTool(t, session, "create_task", args))
+	}
+
+	tests := []struct {
+		name string
+		args map[string]any
+		want []string
+	}{
+		{"all by id", map[string]any{}, []string{"Write report", "Review report", "File expenses", "Fix the sink"}},
+		{"status", map[string]any{"status": []string{"todo", "doing"}}, []string{"Write report", "Review report", "Fix the sink"}},
+		{"priority", map[string]any{"priority": "Medium"}, []string{"Write report", "Fix the sink"}},
+		{"page", map[string]any{"page": "home"}, []string{"Fix the sink"}},
+		{"text", map[string]any{"text": "REPORT"}, []string{"Write report", "Review report"}},
+		{"parent", map[string]any{"parent": report}, []string{"Review report"}},
+		{"created range", map[string]any{"createdAfter": "2000-01-01", "createdBefore": "2000-12-31"}, nil},
+		{"sort by priority", map[string]any{"sort": "priority", "descending": true}, []string{"Review report", "Write report", "Fix the sink", "File expenses"}},
+		{"sort by title", map[string]any{"sort": "title"}, []string{"File expenses", "Fix the sink", "Review report", "Write report"}},
+		{"deadline range", map[string]any{"deadlineAfter": "2030-01-06", "deadlineBefore": "2030-01-31"}, []string{"Write report"}},
+		{"scheduled range", map[string]any{"scheduledAfter": "2030-01-01"}, []string{"Fix the sink"}},
+		// Tasks without a deadline sort last in either direction.
+		{"sort by deadline", map[string]any{"sort": "deadline", "descending": true}, []string{"Write report", "Review report", "File expenses", "Fix the sink"}},
+		{"limit", map[string]any{"sort": "deadline", "limit": 1}, []string{"Review report"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := map[string]any{"graph": "mcp"}
+			for k, v := range tt.args {
+				args[k] = v
+			}
+			var list TaskList
+			structured(t, callTool(t, session, "find_tasks", args), &list)
+			var got []string
+			for _, task := range list.Tasks {
+				got = append(got, task.Title)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	wantError(t, callTool(t, session, "find_tasks", map[string]any{"graph": "mcp", "createdBefore": "soon"}), "createdBefore: expected YYYY-MM-DD")
+}
+
+func TestReadOnlyGraphRefusesWrites(t *testing.T) {
+	session := newMemoryServer(t, &Config{
+		DefaultGraph: "mcp",
+		Graphs:       map[string]*GraphConfig{"Demo": {ReadOnly: true}},
+	}, "mcp", "Demo")
+
+	writes := []struct {
+		tool string
+		args map[string]any
+	}{
+		{"create_task", map[string]any{"pageOrBlockId": "Inbox", "content": "Call Bob"}},
+		{"add_content", map[string]any{"pageOrBlockId": "Inbox", "content": "A note"}},
+		{"create_page", map[string]any{"name": "Projects"}},
+		{"delete_page", map[string]any{"name": "Inbox"}},
+		{"append_to_journal", map[string]any{"content": "A note"}},
+	}
+	for _, w := range writes {
+		args := map[string]any{"graph": "Demo"}
+		for k, v := range w.args {
+			args[k] = v
+		}
+		wantError(t, callTool(t, session, w.tool, args), "Graph Demo is read-only")
+	}
+
+	createdUUID(t, callTool(t, session, "create_task", map[string]any{"pageOrBlockId": "Inbox", "content": "Call Bob"}))
+}
+
+func TestReadOnlyOpenGraphRefusesWrites(t *testing.T) {
+	// Without a graph argument or default graph, writes go to the open
+	// graph, here Demo.
+	session := newMemoryServer(t, &Config{
+		Graphs: map[string]*GraphConfig{"Demo": {ReadOnly: true}},
+	}, "Demo", "mcp")
+
+	wantError(t, callTool(t, session, "create_task", map[string]any{"pageOrBlockId": "Inbox", "content": "Call Bob"}), "Graph Demo is read-only")
+	wantError(t, callTool(t, session, "add_content", map[string]any{"pageOrBlockId": "Inbox", "content": "A note"}), "Graph Demo is read-only")
+}
+
+func TestDisabledTools(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      *Config
+		disabled map[string]string
+		enabled  []string
+	}{
+		{
+			name:     "read-only",
+			cfg:      &Config{ReadOnly: true},
+			disabled: map[string]string{"create_task": "the server is read-only", "add_content": "the server is read-only"},
+			enabled:  []string{"list_all_tasks", "find_tasks"},
+		},
+		{
+			name:     "deny list",
+			cfg:      &Config{DenyTools: []string{"add_content"}},
+			disabled: map[string]string{"add_content": "it is in the deny list"},
+			enabled:  []string{"create_task", "list_all_tasks"},
+		},
+		{
+			name:     "allowlist",
+			cfg:      &Config{Tools: []string{"list_all_tasks"}},
+			disabled: map[string]string{"find_tasks": "it is not in the tool allowlist", "create_task": "it is not in the tool allowlist"},
+			enabled:  []string{"list_all_tasks"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := newMemoryServer(t, tt.cfg, "mcp")
+			ctx := context.Background()
+			tools, err := session.ListTools(ctx, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var listed []string
+			for _, tool := range tools.Tools {
+				listed = append(listed, tool.Name)
+			}
+			for name, reason := range tt.disabled {
+				if slices.Contains(listed, name) {
+					t.Errorf("%s is listed", name)
+				}
+				_, err := session.CallTool(ctx, &mcp.CallToolParams{Name: name, Arguments: map[string]any{"graph": "mcp"}})
+				if err == nil || !strings.Contains(err.Error(), reason) {
+					t.Errorf("calling %s: got %v, want an error containing %q", name, err, reason)
+				}
+			}
+			for _, name := range tt.enabled {
+				if !slices.Contains(listed, name) {
+					t.Errorf("%s is not listed", name)
+				}
+			}
+		})
+	}
+}
+
+func TestInstructionsDescribeRestrictions(t *testing.T) {
+	session := newMemoryServer(t, &Config{
+		DefaultGraph: "mcp",
+		DenyTools:    []string{"add_content"},
+		Graphs:       map[string]*GraphConfig{"Demo": {ReadOnly: true}},
+	}, "mcp", "Demo")
+	instructions := session.InitializeResult().Instructions
+	for _, want := range []string{`graph "mcp"`, "read-only and writes to them are refused: Demo", "disabled: add_content"} {
+		if !strings.Contains(instructions, want) {
+			t.Errorf("instructions %q do not contain %q", instructions, want)
+		}
+	}
+}
+
+func TestDeletePageConfirmToken(t *testing.T) {
+	session := newMemoryServer(t, &Config{DefaultGraph: "mcp"}, "mcp")
+	res := callTool(t, session, "create_page", map[string]any{
+		"name":   "Old Plans",
+		"blocks": []map[string]any{{"content": "First"}, {"content": "Second"}},
+	})
+	wantText(t, res, "Old Plans")
+
+	var preview PageChange
+	structured(t, callTool(t, session, "delete_page", map[string]any{"name": "Old Plans"}), &preview)
+	if preview.Action != "confirm-delete" || preview.ConfirmToken == "" || preview.Blocks != 2 {
+		t.Fatalf("preview = %+v, want confirm-delete of 2 blocks with a token", preview)
+	}
+
+	wantError(t, callTool(t, session, "delete_page", map[string]any{"name": "Old Plans", "confirm": "not-the-token"}), "confirm does not match")
+
+	// Changing the page after the preview invalidates its token.
+	createdUUID(t, callTool(t, session, "add_content", map[string]any{"pageOrBlockId": "Old Plans", "content": "Third"}))
+	wantError(t, callTool(t, session, "delete_page", map[string]any{"name": "Old Plans", "confirm": preview.ConfirmToken}), "confirm does not match")
+
+	structured(t, callTool(t, session, "delete_page", map[string]any{"name": "Old Plans"}), &preview)
+	var deleted PageChange
+	structured(t, callTool(t, session, "delete_page", map[string]any{"name": "Old Plans", "confirm": preview.ConfirmToken}), &deleted)
+	if deleted.Action != "deleted" || deleted.Blocks != 3 {
+		t.Fatalf("delete_page = %+v, want 3 blocks deleted", deleted)
+	}
+
+	wantError(t, callTool(t, session, "delete_page", map[string]any{"name": "Old Plans"}), "not found")
+}
+
+func TestCompleteRepeatingTask(t *testing.T) {
+	session := newMemoryServer(t, &Config{DefaultGraph: "mcp"}, "mcp")
+	uuid := createdUUID(t, callTool(t, session, "create_task", map[string]any{
+		"pageOrBlockId": "Home", "content": "Water the plants", "deadline": "2030-01-10", "repeat": "every 3 days",
+	}))
+
+	var update TaskUpdate
+	structured(t, callTool(t, session, "complete_task", map[string]any{"uuid": uuid}), &update)
+	if update.Status != "Todo" || update.Repeat != "every 3 days" || update.Deadline == nil || update.Deadline.Format("2006-01-02") != "2030-01-13" {
+		t.Errorf("complete_task = %+v, want Todo, repeating every 3 days, due 2030-01-13", update)
+	}
+}
+
+func TestCreatePageChecksProperties(t *testing.T) {
+	session := newMemoryServer(t, &Config{DefaultGraph: "mcp"}, "mcp")
+	res := callTool(t, session, "create_page", map[string]any{"name": "Projects", "properties": map[string]any{"type": "project", "priority": "Whenever"}})
+	wantError(t, res, "Invalid value")
+	wantError(t, callTool(t, session, "get_page", map[string]any{"pageName": "Projects"}), "not found")
+
+	wantText(t, callTool(t, session, "create_page", map[string]any{"name": "Projects", "properties": map[string]any{"priority": "High"}}), "Projects")
+	wantError(t, callTool(t, session, "set_page_property", map[string]any{"name": "Projects", "key": "logseq.property.repeat/recur-frequency", "value": "3"}), "internal Logseq property")
+}
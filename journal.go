@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/slimslenderslacks/mcp-logseq/graphdb"
+)
+
+// Journal pages are found by :block/journal-day, their day as a YYYYMMDD
+// number, and titled in the graph's :journal/page-title-format, the
+// date-fns pattern config.edn sets. Only a new journal page needs a title
+// worked out here; existing ones keep the title they have.
+
+// defaultDateFormat is Logseq's :journal/page-title-format unless
+// config.edn sets another.
+const defaultDateFormat = "MMM do, yyyy"
+
+var dateFormatPattern = regexp.MustCompile(`(?m)^[^;\n]*:journal/page-title-format\s+"([^"]+)"`)
+
+// journalTitleFormat returns the date format of db's journal page titles.
+func journalTitleFormat(db *graphdb.DB) string {
+	if m := dateFormatPattern.FindStringSubmatch(db.File(graphdb.ConfigFile)); m != nil {
+		return m[1]
+	}
+	return defaultDateFormat
+}
+
+// journalDay returns day as the YYYYMMDD number of :block/journal-day.
+func journalDay(day time.Time) int64 {
+	return int64(day.Year()*10000 + int(day.Month())*100 + day.Day())
+}
+
+// dayOfJournal is the inverse of journalDay.
+func dayOfJournal(n int) time.Time {
+	return time.Date(n/10000, time.Month(n/100%100), n%100, 0, 0, 0, 0, time.Local)
+}
+
+// findJournal returns the journal page of day, or nil.
+func findJournal(db *graphdb.DB, day time.Time) *graphdb.Entity {
+	n := journalDay(day)
+	if journals := db.Journals(n, n); len(journals) > 0 {
+		return journals[0]
+	}
+	return nil
+}
+
+var agoPattern = regexp.MustCompile(`^(\d+|a|an|one)\s+(day|week|month|year)s?\s+ago$`)
+
+// parseJournalDate reads the day of a journal. Journals look back, so a
+// weekday is the last one, today included, "last friday" the one before
+// today, and "3 days ago" counts back; anything else is read by parseWhen.
+// "" is today.
+func parseJournalDate(s string, now time.Time) (time.Time, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	words := strings.Join(strings.Fields(strings.ToLower(s)), " ")
+	if words == "" {
+		return today, nil
+	}
+	if m := agoPattern.FindStringSubmatch(words); m != nil {
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			n = 1
+		}
+		unit := strings.ToUpper(m[2][:1]) + m[2][1:]
+		return recurrence{frequency: n, unit: unit}.add(today, -1), nil
+	}
+	if weekday, ok := weekdays[strings.TrimPrefix(words, "last ")]; ok {
+		days := (int(today.Weekday()) - int(weekday) + 7) % 7
+		if days == 0 && strings.HasPrefix(words, "last ") {
+			days = 7
+		}
+		return today.AddDate(0, 0, -days), nil
+	}
+	t, err := parseWhen(s, now)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location()), nil
+}
+
+// formatJournalTitle formats day with a date-fns pattern, the subset
+// Logseq offers for journal titles: yyyy, yy, MMMM, MMM, MM, M, do, dd, d,
+// EEEE and E to EEE. Text in single quotes and anything that is not a
+// letter is copied.
+func formatJournalTitle(format string, day time.Time) string {
+	var sb strings.Builder
+	for i := 0; i < len(format); {
+		c := format[i]
+		if c == '\'' {
+			end := strings.IndexByte(format[i+1:], '\'')
+			switch {
+			case end < 0:
+				sb.WriteString(format[i+1:])
+				return sb.String()
+			case end == 0:
+				sb.WriteByte('\'')
+			default:
+				sb.WriteString(format[i+1 : i+1+end])
+			}
+			i += end + 2
+			continue
+		}
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z') {
+			sb.WriteByte(c)
+			i++
+			continue
+		}
+		j := i
+		for j < len(format) && format[j] == c {
+			j++
+		}
+		token := format[i:j]
+		if token == "d" && j < len(format) && format[j] == 'o' {
+			token = "do"
+			j++
+		}
+		sb.WriteString(dateToken(token, day))
+		i = j
+	}
+	return sb.String()
+}
+
+// dateToken formats one date-fns token. Unknown tokens are copied.
+func dateToken(token string, day time.Time) string {
+	switch token {
+	case "yyyy":
+		return fmt.Sprintf("%04d", day.Year())
+	case "yy":
+		return fmt.Sprintf("%02d", day.Year()%100)
+	case "y":
+		return strconv.Itoa(day.Year())
+	case "MMMM":
+		return day.Month().String()
+	case "MMM":
+		return day.Month().String()[:3]
+	case "MM":
+		return fmt.Sprintf("%02d", int(day.Month()))
+	case "M":
+		return strconv.Itoa(int(day.Month()))
+	case "dd":
+		return fmt.Sprintf("%02d", day.Day())
+	case "d":
+		return strconv.Itoa(day.Day())
+	case "do":
+		return ordinal(day.Day())
+	case "EEEE":
+		return day.Weekday().String()
+	case "E", "EE", "EEE":
+		return day.Weekday().String()[:3]
+	}
+	return token
+}
+
+// ordinal returns n with its English suffix: 1st, 2nd, 3rd, 11th, 22nd.
+func ordinal(n int) string {
+	suffix := "th"
+	if n%100 < 11 || n%100 > 13 {
+		switch n % 10 {
+		case 1:
+			suffix = "st"
+		case 2:
+			suffix = "nd"
+		case 3:
+			suffix = "rd"
+		}
+	}
+	return strconv.Itoa(n) + suffix
+}
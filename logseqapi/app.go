@@ -0,0 +1,30 @@
+package logseqapi
+
+import (
+	"context"
+	"strings"
+)
+
+// dbGraphPrefix is prepended to the names of DB graphs in repo URLs.
+const dbGraphPrefix = "logseq_db_"
+
+// GraphInfo describes the graph open in the Logseq app.
+type GraphInfo struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	Path string `json:"path"`
+}
+
+// GetCurrentGraph returns the graph open in the Logseq app, or nil if none
+// is. The name is the graph's directory name, without the "logseq_db_"
+// prefix DB graphs carry in their URL.
+func (c *Client) GetCurrentGraph(ctx context.Context) (*GraphInfo, error) {
+	var graph *GraphInfo
+	if err := c.Call(ctx, "logseq.App.getCurrentGraph", nil, &graph); err != nil {
+		return nil, err
+	}
+	if graph != nil {
+		graph.Name = strings.TrimPrefix(graph.Name, dbGraphPrefix)
+	}
+	return graph, nil
+}
@@ -0,0 +1,188 @@
+// Package logseqapi is a client for the Logseq HTTP API server
+// (Settings > Features > Developer Mode > HTTP APIs).
+//
+// Every call is a POST to /api with a body of the form
+// {"method": "logseq.Editor.insertBlock", "args": [...]}.
+package logseqapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"time"
+)
+
+const (
+	// DefaultHost is used when LOGSEQ_API_HOST is not set. It points at the
+	// Docker host since the server usually runs in a container.
+	DefaultHost = "host.docker.internal"
+	// DefaultPort is the port Logseq's HTTP API server listens on by default.
+	DefaultPort = "12315"
+)
+
+// Client calls methods on a Logseq HTTP API server.
+type Client struct {
+	host       string
+	port       string
+	token      string
+	httpClient *http.Client
+}
+
+// New creates a client for the API server at host:port. Empty values fall
+// back to DefaultHost and DefaultPort. A non-empty token is sent as a
+// bearer token on every request.
+func New(host, port, token string) *Client {
+	if host == "" {
+		host = DefaultHost
+	}
+	if port == "" {
+		port = DefaultPort
+	}
+	return &Client{
+		host:       host,
+		port:       port,
+		token:      token,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// NewFromEnv creates a client configured from LOGSEQ_API_HOST,
+// LOGSEQ_API_PORT and LOGSEQ_API_AUTHORIZATION_TOKEN.
+func NewFromEnv() *Client {
+	return New(
+		os.Getenv("LOGSEQ_API_HOST"),
+		os.Getenv("LOGSEQ_API_PORT"),
+		os.Getenv("LOGSEQ_API_AUTHORIZATION_TOKEN"),
+	)
+}
+
+// Addr returns the host:port the client talks to.
+func (c *Client) Addr() string {
+	return net.JoinHostPort(c.host, c.port)
+}
+
+func (c *Client) url() string {
+	return "http://" + c.Addr() + "/api"
+}
+
+// Error is returned when the API server rejects a call or reports an error
+// in its response body.
+type Error struct {
+	Method     string
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	if e.StatusCode != 0 && e.StatusCode != http.StatusOK {
+		return fmt.Sprintf("%s: API returned status %d: %s", e.Method, e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("%s: %s", e.Method, e.Message)
+}
+
+// IsUnavailable reports whether err means the API server could not be
+// reached at all, as opposed to rejecting a call.
+func IsUnavailable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EHOSTUNREACH) {
+		return true
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// Ping checks that the API server is reachable.
+func (c *Client) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("API returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+type request struct {
+	Method string `json:"method"`
+	Args   []any  `json:"args"`
+}
+
+// Call invokes an API method and decodes the response into result, which
+// may be nil when the caller does not need the response. A JSON null
+// response leaves result untouched.
+func (c *Client) Call(ctx context.Context, method string, args []any, result any) error {
+	if args == nil {
+		args = []any{}
+	}
+	body, err := json.Marshal(request{Method: method, Args: args})
+	if err != nil {
+		return fmt.Errorf("%s: encoding arguments: %w", method, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("%s: reading response: %w", method, err)
+	}
+
+	if resp.StatusCode >= 400 {
+		msg := string(bytes.TrimSpace(data))
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error != "" {
+			msg = apiErr.Error
+		}
+		return &Error{Method: method, StatusCode: resp.StatusCode, Message: msg}
+	}
+
+	// Errors raised inside Logseq come back as {"error": "..."} with a 200.
+	var apiErr struct {
+		Error any `json:"error"`
+	}
+	if json.Unmarshal(data, &apiErr) == nil && apiErr.Error != nil {
+		return &Error{Method: method, StatusCode: resp.StatusCode, Message: fmt.Sprint(apiErr.Error)}
+	}
+
+	if result == nil || len(bytes.TrimSpace(data)) == 0 || bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		return nil
+	}
+	if err := json.Unmarshal(data, result); err != nil {
+		return fmt.Errorf("%s: decoding response: %w", method, err)
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package logseqapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// EntityRef is a reference to another entity as returned inside a block,
+// e.g. its page or parent.
+type EntityRef struct {
+	ID int `json:"id"`
+}
+
+// BlockEntity is a block as returned by the logseq.Editor methods.
+type BlockEntity struct {
+	ID         int            `json:"id"`
+	UUID       string         `json:"uuid"`
+	Title      string         `json:"title,omitempty"`
+	Content    string         `json:"content,omitempty"`
+	Order      string         `json:"order,omitempty"`
+	Page       *EntityRef     `json:"page,omitempty"`
+	Parent     *EntityRef     `json:"parent,omitempty"`
+	Properties map[string]any `json:"properties,omitempty"`
+	Children   []BlockEntity  `json:"children,omitempty"`
+}
+
+// UnmarshalJSON accepts both full block objects and the ["uuid", "..."]
+// tuples the API uses for children that have not been loaded.
+func (b *BlockEntity) UnmarshalJSON(data []byte) error {
+	var tuple []json.RawMessage
+	if json.Unmarshal(data, &tuple) == nil {
+		if len(tuple) != 2 {
+			return fmt.Errorf("unexpected block tuple of length %d", len(tuple))
+		}
+		*b = BlockEntity{}
+		return json.Unmarshal(tuple[1], &b.UUID)
+	}
+
+	type plain BlockEntity
+	var p plain
+	if err := json.Unmarshal(data, &p); err != nil {
+		return err
+	}
+	*b = BlockEntity(p)
+	return nil
+}
+
+// Text returns the block's title, falling back to its content for file
+// graphs which do not have titles.
+func (b *BlockEntity) Text() string {
+	if b.Title != "" {
+		return b.Title
+	}
+	return b.Content
+}
+
+// InsertBlockOptions controls where InsertBlock places the new block.
+type InsertBlockOptions struct {
+	// Sibling inserts the block next to the source block instead of as its
+	// child.
+	Sibling bool `json:"sibling"`
+	// Before inserts the block before the source block (or as the first
+	// child) instead of after it.
+	Before     bool           `json:"before,omitempty"`
+	Properties map[string]any `json:"properties,omitempty"`
+}
+
+// InsertBlock inserts a block relative to srcBlock, which is a block UUID.
+func (c *Client) InsertBlock(ctx context.Context, srcBlock, content string, opts InsertBlockOptions) (*BlockEntity, error) {
+	return c.callBlock(ctx, "logseq.Editor.insertBlock", []any{srcBlock, content, opts})
+}
+
+// AppendBlockInPage appends a top-level block to the end of a page. The
+// page is referenced by name or UUID.
+func (c *Client) AppendBlockInPage(ctx context.Context, page, content string) (*BlockEntity, error) {
+	return c.callBlock(ctx, "logseq.Editor.appendBlockInPage", []any{page, content})
+}
+
+// AddBlockTag tags a block without adding the tag to its title.
+func (c *Client) AddBlockTag(ctx context.Context, blockUUID, tag string) error {
+	return c.Call(ctx, "logseq.Editor.addBlockTag", []any{blockUUID, tag}, nil)
+}
+
+// UpsertBlockProperty sets a property on a block, creating it if needed.
+// Built-in properties use their full key, e.g. "logseq.property/status".
+func (c *Client) UpsertBlockProperty(ctx context.Context, blockUUID, key string, value any) error {
+	return c.Call(ctx, "logseq.Editor.upsertBlockProperty", []any{blockUUID, key, value}, nil)
+}
+
+// RemoveBlockProperty removes a property and its values from a block.
+func (c *Client) RemoveBlockProperty(ctx context.Context, blockUUID, key string) error {
+	return c.Call(ctx, "logseq.Editor.removeBlockProperty", []any{blockUUID, key}, nil)
+}
+
+// UpdateBlock replaces a block's content.
+func (c *Client) UpdateBlock(ctx context.Context, blockUUID, content string) error {
+	return c.Call(ctx, "logseq.Editor.updateBlock", []any{blockUUID, content}, nil)
+}
+
+// MoveBlockOptions controls where MoveBlock places the block.
+type MoveBlockOptions struct {
+	// Before places the block before the target instead of after it.
+	Before bool `json:"before,omitempty"`
+	// Children makes the block a child of the target instead of a sibling.
+	Children bool `json:"children,omitempty"`
+}
+
+// MoveBlock moves srcBlock, with its children, next to or under
+// targetBlock. Both are block UUIDs; Logseq assigns the new :block/order.
+func (c *Client) MoveBlock(ctx context.Context, srcBlock, targetBlock string, opts MoveBlockOptions) error {
+	return c.Call(ctx, "logseq.Editor.moveBlock", []any{srcBlock, targetBlock, opts}, nil)
+}
+
+// RemoveBlock deletes a block and its children.
+func (c *Client) RemoveBlock(ctx context.Context, blockUUID string) error {
+	return c.Call(ctx, "logseq.Editor.removeBlock", []any{blockUUID}, nil)
+}
+
+// GetBlock returns a block by UUID or id, or nil if there is none. With
+// includeChildren its children are loaded, nested.
+func (c *Client) GetBlock(ctx context.Context, block any, includeChildren bool) (*BlockEntity, error) {
+	var result *BlockEntity
+	opts := map[string]any{"includeChildren": includeChildren}
+	if err := c.Call(ctx, "logseq.Editor.getBlock", []any{block, opts}, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetPreviousSiblingBlock returns the sibling just above a block, or nil
+// if it is the first child.
+func (c *Client) GetPreviousSiblingBlock(ctx context.Context, blockUUID string) (*BlockEntity, error) {
+	var result *BlockEntity
+	if err := c.Call(ctx, "logseq.Editor.getPreviousSiblingBlock", []any{blockUUID}, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetPage returns a page by name or UUID, or nil if there is none. Pages
+// come back in the same shape as blocks.
+func (c *Client) GetPage(ctx context.Context, page string) (*BlockEntity, error) {
+	var result *BlockEntity
+	if err := c.Call(ctx, "logseq.Editor.getPage", []any{page}, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// CreatePageOptions controls CreatePage.
+type CreatePageOptions struct {
+	// Redirect opens the new page in the app.
+	Redirect bool `json:"redirect"`
+	// CreateFirstBlock adds an empty block to the new page.
+	CreateFirstBlock bool `json:"createFirstBlock"`
+	// Journal makes the new page a journal; its name must be a date in
+	// the graph's date format.
+	Journal bool `json:"journal"`
+}
+
+// CreatePage creates a page with the given properties and returns it.
+func (c *Client) CreatePage(ctx context.Context, name string, properties map[string]any, opts CreatePageOptions) (*BlockEntity, error) {
+	if properties == nil {
+		properties = map[string]any{}
+	}
+	return c.callBlock(ctx, "logseq.Editor.createPage", []any{name, properties, opts})
+}
+
+// RenamePage renames a page. References to it follow, since DB graphs
+// store them by UUID.
+func (c *Client) RenamePage(ctx context.Context, oldName, newName string) error {
+	return c.Call(ctx, "logseq.Editor.renamePage", []any{oldName, newName}, nil)
+}
+
+// DeletePage deletes a page and its blocks.
+func (c *Client) DeletePage(ctx context.Context, name string) error {
+	return c.Call(ctx, "logseq.Editor.deletePage", []any{name}, nil)
+}
+
+// GetPageBlocksTree returns the top-level blocks of a page with their
+// children nested.
+func (c *Client) GetPageBlocksTree(ctx context.Context, page string) ([]BlockEntity, error) {
+	var blocks []BlockEntity
+	if err := c.Call(ctx, "logseq.Editor.getPageBlocksTree", []any{page}, &blocks); err != nil {
+		return nil, err
+	}
+	return blocks, nil
+}
+
+func (c *Client) callBlock(ctx context.Context, method string, args []any) (*BlockEntity, error) {
+	var block *BlockEntity
+	if err := c.Call(ctx, method, args, &block); err != nil {
+		return nil, err
+	}
+	if block == nil || block.UUID == "" {
+		return nil, &Error{Method: method, Message: "no block was returned"}
+	}
+	return block, nil
+}
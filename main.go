@@ -2,114 +2,151 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
-	"net/http"
 	"os"
-	"os/exec"
+	"os/signal"
+	"slices"
 	"strings"
-	"sync"
+	"syscall"
 
+	"github.com/modelcontextprotocol/go-sdk/jsonrpc"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 )
 
-// Task represents a Logseq task
-type Task struct {
-	ID       int    `json:"id"`
-	UUID     string `json:"uuid"`
-	Title    string `json:"title"`
-	Status   string `json:"status"`
-	Priority string `json:"priority"`
+// MCPServer holds the MCP server, the backend answering tool calls, the
+// watcher notifying subscribed resources and the index argument
+// completions come from
+type MCPServer struct {
+	server      *mcp.Server
+	cfg         *Config
+	backend     Backend
+	watcher     *graphWatcher
+	completions *completionIndexes
+
+	toolNames map[string]bool   // every tool, registered or not
+	disabled  map[string]string // tool name -> why it is not registered
 }
 
-// MCPServer holds the MCP server and task cache
-type MCPServer struct {
-	server *mcp.Server
-	tasks  map[string][]Task // graph -> tasks
-	mu     sync.RWMutex
+// newMCPServer creates a server whose tools, resources and prompts are
+// answered by backend.
+func newMCPServer(cfg *Config, backend Backend) *MCPServer {
+	mcpServer := &MCPServer{
+		cfg:     cfg,
+		backend: backend,
+
+		toolNames: make(map[string]bool),
+		disabled:  make(map[string]string),
+	}
+	title := "Logseq"
+	if cfg.ReadOnly {
+		title += " (read-only)"
+	}
+	mcpServer.server = mcp.NewServer(&mcp.Implementation{
+		Name:    "mcp-logseq",
+		Title:   title,
+		Version: "1.0.0",
+	}, &mcp.ServerOptions{
+		Instructions: mcpServer.instructions(),
+		// The SDK records subscriptions per session, and ResourceUpdated
+		// only notifies the sessions subscribed to the URI.
+		SubscribeHandler:   mcpServer.subscribe,
+		UnsubscribeHandler: mcpServer.unsubscribe,
+		CompletionHandler:  mcpServer.complete,
+	})
+	mcpServer.server.AddReceivingMiddleware(mcpServer.refuseDisabledTools)
+	mcpServer.watcher = newGraphWatcher(backend, cfg.WatchInterval, mcpServer.resourceUpdated)
+	mcpServer.completions = newCompletionIndexes(backend)
+
+	// Register tools, resources and prompts
+	registerTools(mcpServer)
+	registerResources(mcpServer)
+	registerPrompts(mcpServer)
+	for _, name := range slices.Concat(cfg.Tools, cfg.DenyTools) {
+		if !mcpServer.toolNames[name] {
+			log.Printf("⚠ WARNING: unknown tool %q in tool configuration", name)
+		}
+	}
+	return mcpServer
 }
 
 func main() {
-	if err := run(); err != nil {
+	configPath := flag.String("config", os.Getenv("LOGSEQ_CONFIG"), "path to a YAML config file (default $LOGSEQ_CONFIG)")
+	transport := flag.String("transport", transportStdio, "MCP transport: stdio or http")
+	addr := flag.String("addr", defaultHTTPAddr, "address to listen on with --transport http")
+	flag.Parse()
+
+	if err := run(*configPath, *transport, *addr); err != nil {
 		log.Fatal(err)
 	}
 }
 
-func run() error {
+func run(configPath, transport, addr string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		return err
+	}
+
+	if cfg.usesBackend(backendMemory) {
+		log.Println("⚠ WARNING: the memory backend is for tests; its graphs start empty and are lost on exit")
+	}
+
+	api := cfg.apiClient(cfg.DefaultGraph)
+
 	// Check if Logseq API is available
-	if err := checkLogseqAPI(); err != nil {
-		apiHost := os.Getenv("LOGSEQ_API_HOST")
-		if apiHost == "" {
-			apiHost = "host.docker.internal"
-		}
-		apiPort := os.Getenv("LOGSEQ_API_PORT")
-		if apiPort == "" {
-			apiPort = "12315"
-		}
+	if cfg.ReadOnly {
+		log.Println("Read-only mode: write tools are disabled")
+	} else if err := api.Ping(ctx); err != nil {
 		log.Printf("⚠ WARNING: Logseq API not available: %v", err)
 		log.Println("⚠ Some features (create_task, complete_task, update_task, add_content) will not work")
 		log.Println("⚠ To enable API features:")
 		log.Println("  1. Start Logseq on your host")
 		log.Println("  2. Enable HTTP API: Settings > Features > Developer Mode > HTTP APIs")
-		log.Printf("  3. Ensure the API is accessible at %s:%s\n", apiHost, apiPort)
+		log.Printf("  3. Ensure the API is accessible at %s\n", api.Addr())
 	} else {
 		log.Println("✓ Logseq API is accessible")
 	}
 
 	log.Println("Starting MCP Logseq Server...")
 	log.Println("This server provides programmatic access to Logseq via SQLite queries and HTTP API")
-
-	// Create server
-	server := mcp.NewServer(&mcp.Implementation{
-		Name:    "mcp-logseq",
-		Version: "1.0.0",
-	}, nil)
-
-	mcpServer := &MCPServer{
-		server: server,
-		tasks:  make(map[string][]Task),
-	}
-
-	// Register tools and resources
-	registerTools(mcpServer)
-	registerResources(mcpServer)
-
-	// Run server with stdio transport
-	log.Println("Ready to accept MCP protocol messages on stdio")
-	transport := &mcp.StdioTransport{}
-	return server.Run(context.Background(), transport)
+	mcpServer := newMCPServer(cfg, newBackendFromConfig(cfg))
+	return mcpServer.serve(ctx, transport, addr)
 }
 
-func checkLogseqAPI() error {
-	apiHost := os.Getenv("LOGSEQ_API_HOST")
-	if apiHost == "" {
-		apiHost = "host.docker.internal"
-	}
-
-	apiPort := os.Getenv("LOGSEQ_API_PORT")
-	if apiPort == "" {
-		apiPort = "12315"
-	}
-
-	resp, err := http.Get(fmt.Sprintf("http://%s:%s/api", apiHost, apiPort))
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode >= 400 {
-		return fmt.Errorf("API returned status %d", resp.StatusCode)
-	}
-	return nil
-}
+type ListGraphsArgs struct{}
 
 type ListAllTasksArgs struct {
 	Graph string `json:"graph"`
 }
 
 type FindTasksArgs struct {
+	Graph           string   `json:"graph"`
+	Status          []string `json:"status"`
+	Priority        string   `json:"priority"`
+	Page            string   `json:"page"`
+	Tag             string   `json:"tag"`
+	Text            string   `json:"text"`
+	Parent          string   `json:"parent"`
+	CreatedAfter    string   `json:"createdAfter"`
+	CreatedBefore   string   `json:"createdBefore"`
+	UpdatedAfter    string   `json:"updatedAfter"`
+	UpdatedBefore   string   `json:"updatedBefore"`
+	DeadlineAfter   string   `json:"deadlineAfter"`
+	DeadlineBefore  string   `json:"deadlineBefore"`
+	ScheduledAfter  string   `json:"scheduledAfter"`
+	ScheduledBefore string   `json:"scheduledBefore"`
+	Sort            string   `json:"sort"`
+	Descending      bool     `json:"descending"`
+	Limit           int      `json:"limit"`
+}
+
+type ListUpcomingTasksArgs struct {
 	Graph string `json:"graph"`
+	Days  int    `json:"days"`
 }
 
 type ListTasksByStatusArgs struct {
@@ -117,23 +154,51 @@ type ListTasksByStatusArgs struct {
 }
 
 type CreateTaskArgs struct {
+	Graph         string `json:"graph"`
 	PageOrBlockID string `json:"pageOrBlockId"`
 	Content       string `json:"content"`
 	Status        string `json:"status"`
 	Priority      string `json:"priority"`
+	Deadline      string `json:"deadline"`
+	Scheduled     string `json:"scheduled"`
+	Repeat        string `json:"repeat"`
 }
 
 type CompleteTaskArgs struct {
-	UUID string `json:"uuid"`
+	Graph string `json:"graph"`
+	UUID  string `json:"uuid"`
 }
 
 type UpdateTaskArgs struct {
-	UUID    string `json:"uuid"`
-	Status  string `json:"status"`
+	Graph     string `json:"graph"`
+	UUID      string `json:"uuid"`
+	Status    string `json:"status"`
+	Content   string `json:"content"`
+	Deadline  string `json:"deadline"`
+	Scheduled string `json:"scheduled"`
+	Repeat    string `json:"repeat"`
+}
+
+type GetJournalArgs struct {
+	Graph string `json:"graph"`
+	Date  string `json:"date"`
+}
+
+type AppendToJournalArgs struct {
+	Graph   string `json:"graph"`
+	Date    string `json:"date"`
 	Content string `json:"content"`
 }
 
+type ListJournalsArgs struct {
+	Graph string `json:"graph"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Limit int    `json:"limit"`
+}
+
 type AddContentArgs struct {
+	Graph         string `json:"graph"`
 	PageOrBlockID string `json:"pageOrBlockId"`
 	Content       string `json:"content"`
 }
@@ -148,6 +213,91 @@ type GetPageArgs struct {
 	PageName string `json:"pageName"`
 }
 
+type GetBlockTreeArgs struct {
+	Graph         string `json:"graph"`
+	PageOrBlockID string `json:"pageOrBlockId"`
+	MaxDepth      int    `json:"maxDepth"`
+	Properties    *bool  `json:"properties"`
+	Format        string `json:"format"`
+}
+
+type GetReferencesArgs struct {
+	Graph         string `json:"graph"`
+	PageOrBlockID string `json:"pageOrBlockId"`
+}
+
+type SearchArgs struct {
+	Graph  string `json:"graph"`
+	Query  string `json:"query"`
+	Limit  int    `json:"limit"`
+	Offset int    `json:"offset"`
+}
+
+type MoveBlockArgs struct {
+	Graph    string `json:"graph"`
+	UUID     string `json:"uuid"`
+	Target   string `json:"target"`
+	Position string `json:"position"`
+}
+
+type DeleteBlockArgs struct {
+	Graph     string `json:"graph"`
+	UUID      string `json:"uuid"`
+	Recursive bool   `json:"recursive"`
+}
+
+// IndentBlockArgs are the arguments of indent_block and outdent_block.
+type IndentBlockArgs struct {
+	Graph string `json:"graph"`
+	UUID  string `json:"uuid"`
+}
+
+// BlockInput is a block to create, with its children.
+type BlockInput struct {
+	Content  string       `json:"content"`
+	Children []BlockInput `json:"children"`
+}
+
+type CreatePageArgs struct {
+	Graph      string            `json:"graph"`
+	Name       string            `json:"name"`
+	Properties map[string]string `json:"properties"`
+	Tags       []string          `json:"tags"`
+	Blocks     []BlockInput      `json:"blocks"`
+}
+
+type RenamePageArgs struct {
+	Graph   string `json:"graph"`
+	Name    string `json:"name"`
+	NewName string `json:"newName"`
+}
+
+type DeletePageArgs struct {
+	Graph   string `json:"graph"`
+	Name    string `json:"name"`
+	Confirm string `json:"confirm"`
+}
+
+type SetPagePropertyArgs struct {
+	Graph string `json:"graph"`
+	Name  string `json:"name"`
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type SetBlockPropertyArgs struct {
+	Graph string `json:"graph"`
+	UUID  string `json:"uuid"`
+	Key   string `json:"key"`
+	Value any    `json:"value"`
+}
+
+type RemoveBlockPropertyArgs struct {
+	Graph string `json:"graph"`
+	UUID  string `json:"uuid"`
+	Key   string `json:"key"`
+}
+
 type ListTagsArgs struct {
 	Graph  string `json:"graph"`
 	Expand bool   `json:"expand"`
@@ -158,201 +308,615 @@ type ListPropertiesArgs struct {
 	Expand bool   `json:"expand"`
 }
 
+// writeTools change a graph. They are not registered in read-only mode.
+var writeTools = []string{"create_task", "complete_task", "update_task", "add_content", "append_to_journal", "move_block", "delete_block", "indent_block", "outdent_block", "create_page", "rename_page", "delete_page", "set_page_property", "set_block_property", "remove_block_property"}
+
+// toolDisabled returns why the configuration disables the tool called
+// name, or "" if it is enabled. The deny list wins over the allowlist.
+func (m *MCPServer) toolDisabled(name string) string {
+	switch {
+	case m.cfg.ReadOnly && slices.Contains(writeTools, name):
+		return "the server is read-only"
+	case slices.Contains(m.cfg.DenyTools, name):
+		return "it is in the deny list"
+	case len(m.cfg.Tools) > 0 && !slices.Contains(m.cfg.Tools, name):
+		return "it is not in the tool allowlist"
+	}
+	return ""
+}
+
+// addTool registers a tool unless the configuration disables it.
+func addTool[In, Out any](m *MCPServer, t *mcp.Tool, h mcp.ToolHandlerFor[In, Out]) {
+	m.toolNames[t.Name] = true
+	if reason := m.toolDisabled(t.Name); reason != "" {
+		m.disabled[t.Name] = reason
+		return
+	}
+	mcp.AddTool(m.server, t, h)
+}
+
+// refuseDisabledTools answers calls to disabled tools with an error saying
+// why, rather than the SDK's "unknown tool".
+func (m *MCPServer) refuseDisabledTools(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		if call, ok := req.(*mcp.CallToolRequest); ok {
+			if reason, ok := m.disabled[call.Params.Name]; ok {
+				return nil, &jsonrpc.Error{
+					Code:    jsonrpc.CodeInvalidParams,
+					Message: fmt.Sprintf("tool %q is disabled: %s", call.Params.Name, reason),
+				}
+			}
+		}
+		return next(ctx, method, req)
+	}
+}
+
+// instructions tells clients which graph calls default to and which tools
+// and graphs the configuration restricts.
+func (m *MCPServer) instructions() string {
+	var lines []string
+	if m.cfg.DefaultGraph != "" {
+		lines = append(lines, fmt.Sprintf("Tools use the graph %q when no graph argument is given.", m.cfg.DefaultGraph))
+	}
+	if m.cfg.ReadOnly {
+		lines = append(lines, fmt.Sprintf("This server is read-only: %s are not available.", strings.Join(writeTools, ", ")))
+	} else if graphs := m.cfg.readOnlyGraphs(); len(graphs) > 0 {
+		lines = append(lines, fmt.Sprintf("These graphs are read-only and writes to them are refused: %s.", strings.Join(graphs, ", ")))
+	}
+	if len(m.cfg.Tools) > 0 {
+		lines = append(lines, fmt.Sprintf("Only these tools are enabled: %s.", strings.Join(m.cfg.Tools, ", ")))
+	}
+	if len(m.cfg.DenyTools) > 0 {
+		lines = append(lines, fmt.Sprintf("These tools are disabled: %s.", strings.Join(m.cfg.DenyTools, ", ")))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// graphSchema is the input schema of the graph argument of read tools.
+func (m *MCPServer) graphSchema() map[string]any {
+	return map[string]any{
+		"type":        "string",
+		"description": m.graphDescription(),
+	}
+}
+
+// graphDescription describes the graph argument of read tools and prompts.
+func (m *MCPServer) graphDescription() string {
+	description := "The name of the Logseq graph (e.g., 'mcp', 'Demo')"
+	if m.cfg.DefaultGraph != "" {
+		description += fmt.Sprintf(". Defaults to '%s'.", m.cfg.DefaultGraph)
+	}
+	return description
+}
+
+// required lists the required arguments of a read tool: fields, plus
+// graph unless a default graph is configured.
+func (m *MCPServer) required(fields ...string) []string {
+	if m.cfg.DefaultGraph == "" {
+		return append([]string{"graph"}, fields...)
+	}
+	return fields
+}
+
+// writeGraphSchema is the input schema of the graph argument of write
+// tools.
+var writeGraphSchema = map[string]any{
+	"type":        "string",
+	"description": "The graph to write to, which selects its configured Logseq API endpoint. Defaults to the default graph.",
+}
+
+// dateSchema is the input schema of a date bound in find_tasks.
+func dateSchema(description string) map[string]any {
+	return map[string]any{
+		"type":        "string",
+		"description": description + " (YYYY-MM-DD or RFC 3339)",
+	}
+}
+
+// whenSchema describes a deadline or scheduled argument. clearable
+// arguments take "none" to remove the date.
+func whenSchema(description string, clearable bool) map[string]any {
+	description += ": YYYY-MM-DD, YYYY-MM-DD HH:MM, RFC 3339, or words such as today, tomorrow, friday, next week, in 3 days or tomorrow at 9am"
+	if clearable {
+		description += `, or "none" to remove it`
+	}
+	return map[string]any{"type": "string", "description": description}
+}
+
+// journalDateSchema describes a day argument of the journal tools.
+func journalDateSchema(description string) map[string]any {
+	return map[string]any{
+		"type":        "string",
+		"description": description + journalDateHelp,
+	}
+}
+
+// journalDateHelp lists the forms of a journal date.
+const journalDateHelp = ": YYYY-MM-DD, or words such as today, yesterday, monday (the last one, today included), last friday or 3 days ago"
+
+// repeatSchema describes the repeat argument of create_task and
+// update_task.
+func repeatSchema(clearable bool) map[string]any {
+	description := "How often the task repeats, e.g. daily, weekly, every 2 weeks, monthly or 3d. Completing a repeating task moves its deadline, or else its scheduled date, on instead of marking it Done"
+	if clearable {
+		description += `; "none" stops it repeating`
+	}
+	return map[string]any{"type": "string", "description": description}
+}
+
+// blockTreeSchema is the output schema of get_block_tree, written out by
+// hand because blocks nest.
+func blockTreeSchema() map[string]any {
+	str := map[string]any{"type": "string"}
+	return map[string]any{
+		"type":     "object",
+		"required": []string{"page"},
+		"properties": map[string]any{
+			"page": map[string]any{
+				"type":     "object",
+				"required": []string{"uuid", "title"},
+				"properties": map[string]any{
+					"id":         map[string]any{"type": "integer"},
+					"uuid":       str,
+					"title":      str,
+					"name":       str,
+					"journal":    map[string]any{"type": "boolean"},
+					"journalDay": map[string]any{"type": "integer"},
+					"createdAt":  map[string]any{"type": "string", "format": "date-time"},
+					"updatedAt":  map[string]any{"type": "string", "format": "date-time"},
+				},
+			},
+			"blocks": map[string]any{
+				"type":  "array",
+				"items": map[string]any{"$ref": "#/$defs/block"},
+			},
+		},
+		"$defs": map[string]any{
+			"block": map[string]any{
+				"type":     "object",
+				"required": []string{"id", "uuid", "title"},
+				"properties": map[string]any{
+					"id":        map[string]any{"type": "integer"},
+					"uuid":      str,
+					"title":     str,
+					"order":     str,
+					"collapsed": map[string]any{"type": "boolean"},
+					"properties": map[string]any{
+						"type":                 "object",
+						"description":          "property values by property title",
+						"additionalProperties": str,
+					},
+					"children": map[string]any{
+						"type":  "array",
+						"items": map[string]any{"$ref": "#/$defs/block"},
+					},
+					"truncated": map[string]any{
+						"type":        "boolean",
+						"description": "whether maxDepth left out the block's children",
+					},
+				},
+			},
+		},
+	}
+}
+
 func registerTools(mcpServer *MCPServer) {
 	// Database Query Tools
-	mcp.AddTool(
-		mcpServer.server,
+	addTool(
+		mcpServer,
+		&mcp.Tool{
+			Name:        "list_graphs",
+			Description: "List the Logseq graphs this server can read, with their size, last-modified time, page/block/task counts and whether each is open in the Logseq app. Use the names as the graph argument of other tools.",
+			InputSchema: map[string]any{
+				"type":       "object",
+				"properties": map[string]any{},
+			},
+		},
+		func(ctx context.Context, request *mcp.CallToolRequest, args ListGraphsArgs) (*mcp.CallToolResult, *GraphList, error) {
+			return mcpServer.listGraphsTool(ctx)
+		},
+	)
+
+	addTool(
+		mcpServer,
 		&mcp.Tool{
 			Name:        "list_all_tasks",
 			Description: "List all tasks from a Logseq graph database. Returns task ID, UUID, title, status, and priority.",
 			InputSchema: map[string]any{
 				"type": "object",
 				"properties": map[string]any{
-					"graph": map[string]any{
-						"type":        "string",
-						"description": "The name of the Logseq graph (e.g., 'mcp', 'Demo')",
-					},
+					"graph": mcpServer.graphSchema(),
 				},
-				"required": []string{"graph"},
+				"required": mcpServer.required(),
 			},
 		},
-		func(ctx context.Context, request *mcp.CallToolRequest, args ListAllTasksArgs) (*mcp.CallToolResult, any, error) {
-			return mcpServer.executeScript(ctx, "list_all_tasks.cljs", map[string]any{
-				"graph": args.Graph,
-			})
+		func(ctx context.Context, request *mcp.CallToolRequest, args ListAllTasksArgs) (*mcp.CallToolResult, *TaskList, error) {
+			return mcpServer.listAllTasks(ctx, args.Graph)
 		},
 	)
 
-	mcp.AddTool(
-		mcpServer.server,
+	addTool(
+		mcpServer,
 		&mcp.Tool{
 			Name:        "list_tasks_by_status",
 			Description: "List tasks grouped by status (Todo, Doing, Done, Backlog) from a Logseq graph.",
 			InputSchema: map[string]any{
 				"type": "object",
 				"properties": map[string]any{
-					"graph": map[string]any{
-						"type":        "string",
-						"description": "The name of the Logseq graph (e.g., 'mcp', 'Demo')",
-					},
+					"graph": mcpServer.graphSchema(),
 				},
-				"required": []string{"graph"},
+				"required": mcpServer.required(),
 			},
 		},
-		func(ctx context.Context, request *mcp.CallToolRequest, args ListTasksByStatusArgs) (*mcp.CallToolResult, any, error) {
-			return mcpServer.executeScript(ctx, "list_tasks_by_status.cljs", map[string]any{
-				"graph": args.Graph,
-			})
+		func(ctx context.Context, request *mcp.CallToolRequest, args ListTasksByStatusArgs) (*mcp.CallToolResult, *TasksByStatus, error) {
+			return readGraph(ctx, mcpServer, args.Graph, func(graph string) ([]Task, error) {
+				return mcpServer.backend.ListTasks(ctx, graph)
+			}, formatTasksByStatus, tasksByStatus)
 		},
 	)
 
-	mcp.AddTool(
-		mcpServer.server,
+	addTool(
+		mcpServer,
 		&mcp.Tool{
 			Name:        "find_tasks",
-			Description: "Find tasks matching specific criteria in a Logseq graph.",
+			Description: "Find tasks matching specific criteria in a Logseq graph. All criteria are optional and combined with AND. Dates are YYYY-MM-DD or RFC 3339 timestamps; ...After bounds are inclusive and ...Before bounds exclusive.",
 			InputSchema: map[string]any{
 				"type": "object",
 				"properties": map[string]any{
-					"graph": map[string]any{
+					"graph": mcpServer.graphSchema(),
+					"status": map[string]any{
+						"type":        "array",
+						"items":       map[string]any{"type": "string"},
+						"description": "Only tasks with one of these statuses (e.g. ['Todo', 'Doing'])",
+					},
+					"priority": map[string]any{
+						"type":        "string",
+						"description": "Only tasks with this priority",
+						"enum":        []string{"Low", "Medium", "High", "Urgent"},
+					},
+					"page": map[string]any{
+						"type":        "string",
+						"description": "Only tasks on this page (name or UUID)",
+					},
+					"tag": map[string]any{
+						"type":        "string",
+						"description": "Only tasks that also have this tag (title or ident, e.g. 'Project')",
+					},
+					"text": map[string]any{
+						"type":        "string",
+						"description": "Only tasks whose title contains this text (case-insensitive)",
+					},
+					"parent": map[string]any{
 						"type":        "string",
-						"description": "The name of the Logseq graph (e.g., 'mcp', 'Demo')",
+						"description": "Only tasks nested under the block with this UUID, at any depth",
+					},
+					"createdAfter":    dateSchema("Only tasks created at or after this date"),
+					"createdBefore":   dateSchema("Only tasks created before this date"),
+					"updatedAfter":    dateSchema("Only tasks updated at or after this date"),
+					"updatedBefore":   dateSchema("Only tasks updated before this date"),
+					"deadlineAfter":   dateSchema("Only tasks with a deadline at or after this date"),
+					"deadlineBefore":  dateSchema("Only tasks with a deadline before this date"),
+					"scheduledAfter":  dateSchema("Only tasks scheduled at or after this date"),
+					"scheduledBefore": dateSchema("Only tasks scheduled before this date"),
+					"sort": map[string]any{
+						"type":        "string",
+						"description": "Field to sort by. Tasks without the field come last.",
+						"enum":        taskSortFields,
+						"default":     "id",
+					},
+					"descending": map[string]any{
+						"type":        "boolean",
+						"description": "Sort in descending order",
+						"default":     false,
+					},
+					"limit": map[string]any{
+						"type":        "integer",
+						"description": "Maximum number of tasks to return (0 for no limit)",
+						"minimum":     0,
+						"default":     0,
 					},
 				},
-				"required": []string{"graph"},
+				"required": mcpServer.required(),
 			},
 		},
-		func(ctx context.Context, request *mcp.CallToolRequest, args FindTasksArgs) (*mcp.CallToolResult, any, error) {
-			return mcpServer.executeScript(ctx, "find_tasks.cljs", map[string]any{
-				"graph": args.Graph,
-			})
+		func(ctx context.Context, request *mcp.CallToolRequest, args FindTasksArgs) (*mcp.CallToolResult, *TaskList, error) {
+			return mcpServer.findTasks(ctx, args)
+		},
+	)
+
+	addTool(
+		mcpServer,
+		&mcp.Tool{
+			Name:        "list_upcoming_tasks",
+			Description: "List open tasks that are overdue, due today, or due in the next few days, soonest first. A task is due at its deadline, or at its scheduled date if it has no deadline. Done and canceled tasks are left out.",
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"graph": mcpServer.graphSchema(),
+					"days": map[string]any{
+						"type":        "integer",
+						"description": "How many days after today to look ahead",
+						"minimum":     1,
+						"default":     defaultUpcomingDays,
+					},
+				},
+				"required": mcpServer.required(),
+			},
+		},
+		func(ctx context.Context, request *mcp.CallToolRequest, args ListUpcomingTasksArgs) (*mcp.CallToolResult, *UpcomingTasks, error) {
+			return mcpServer.listUpcomingTasks(ctx, args)
 		},
 	)
 
-	mcp.AddTool(
-		mcpServer.server,
+	addTool(
+		mcpServer,
 		&mcp.Tool{
 			Name:        "list_pages",
 			Description: "List all pages in a graph",
 			InputSchema: map[string]any{
 				"type": "object",
 				"properties": map[string]any{
-					"graph": map[string]any{
-						"type":        "string",
-						"description": "The name of the Logseq graph (e.g., 'mcp', 'Demo')",
-					},
+					"graph": mcpServer.graphSchema(),
 					"expand": map[string]any{
 						"type":        "boolean",
 						"description": "Provide additional detail on each page (includes created-at and updated-at timestamps)",
 						"default":     false,
 					},
 				},
-				"required": []string{"graph"},
+				"required": mcpServer.required(),
 			},
 		},
-		func(ctx context.Context, request *mcp.CallToolRequest, args ListPagesArgs) (*mcp.CallToolResult, any, error) {
-			expandStr := "false"
-			if args.Expand {
-				expandStr = "true"
-			}
-			return mcpServer.executeScriptWithArgs(ctx, "list_pages.cljs", args.Graph, []string{expandStr})
+		func(ctx context.Context, request *mcp.CallToolRequest, args ListPagesArgs) (*mcp.CallToolResult, *PageList, error) {
+			return readGraph(ctx, mcpServer, args.Graph, func(graph string) ([]Page, error) {
+				return mcpServer.backend.ListPages(ctx, graph, args.Expand)
+			}, func(pages []Page) string {
+				return formatPages(pages, args.Expand)
+			}, func(pages []Page) *PageList {
+				return &PageList{Pages: pages}
+			})
 		},
 	)
 
-	mcp.AddTool(
-		mcpServer.server,
+	addTool(
+		mcpServer,
 		&mcp.Tool{
 			Name:        "get_page",
 			Description: "Get a page's content including its blocks. A property and a tag are pages.",
 			InputSchema: map[string]any{
 				"type": "object",
 				"properties": map[string]any{
-					"graph": map[string]any{
-						"type":        "string",
-						"description": "The name of the Logseq graph (e.g., 'mcp', 'Demo')",
-					},
+					"graph": mcpServer.graphSchema(),
 					"pageName": map[string]any{
 						"type":        "string",
 						"description": "The page's name or UUID to retrieve. A property and a tag are pages.",
 					},
 				},
-				"required": []string{"graph", "pageName"},
+				"required": mcpServer.required("pageName"),
 			},
 		},
-		func(ctx context.Context, request *mcp.CallToolRequest, args GetPageArgs) (*mcp.CallToolResult, any, error) {
-			return mcpServer.executeScriptWithArgs(ctx, "get_page.cljs", args.Graph, []string{args.PageName})
+		func(ctx context.Context, request *mcp.CallToolRequest, args GetPageArgs) (*mcp.CallToolResult, *PageContent, error) {
+			return readGraph(ctx, mcpServer, args.Graph, func(graph string) (*PageContent, error) {
+				return mcpServer.backend.GetPage(ctx, graph, args.PageName)
+			}, formatPage, func(content *PageContent) *PageContent {
+				return content
+			})
 		},
 	)
 
-	mcp.AddTool(
-		mcpServer.server,
+	addTool(
+		mcpServer,
 		&mcp.Tool{
-			Name:        "list_tags",
-			Description: "List all tags in a graph",
+			Name:        "get_journal",
+			Description: "Get a day's journal page with its blocks, by date rather than by page title",
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"graph": mcpServer.graphSchema(),
+					"date":  journalDateSchema("The journal's day (default: today)"),
+				},
+				"required": mcpServer.required(),
+			},
+		},
+		func(ctx context.Context, request *mcp.CallToolRequest, args GetJournalArgs) (*mcp.CallToolResult, *PageContent, error) {
+			return mcpServer.getJournal(ctx, args)
+		},
+	)
+
+	addTool(
+		mcpServer,
+		&mcp.Tool{
+			Name:        "list_journals",
+			Description: "List journal pages, most recent first, optionally between two dates",
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"graph": mcpServer.graphSchema(),
+					"from":  journalDateSchema("Earliest day to list, inclusive (optional)"),
+					"to":    journalDateSchema("Latest day to list, inclusive (optional)"),
+					"limit": map[string]any{
+						"type":        "integer",
+						"description": "Maximum number of journals to return (optional)",
+						"minimum":     1,
+					},
+				},
+				"required": mcpServer.required(),
+			},
+		},
+		func(ctx context.Context, request *mcp.CallToolRequest, args ListJournalsArgs) (*mcp.CallToolResult, *JournalList, error) {
+			return mcpServer.listJournals(ctx, args)
+		},
+	)
+
+	addTool(
+		mcpServer,
+		&mcp.Tool{
+			Name:        "get_block_tree",
+			Description: "Get the nested outline of a page, or of a block and its descendants, in outline order",
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"graph": mcpServer.graphSchema(),
+					"pageOrBlockId": map[string]any{
+						"type":        "string",
+						"description": "The page's name or UUID, or a block UUID to get just that block and its descendants",
+					},
+					"maxDepth": map[string]any{
+						"type":        "integer",
+						"description": "Levels of blocks to return below the page or block; 0 returns them all",
+						"minimum":     0,
+						"default":     0,
+					},
+					"properties": map[string]any{
+						"type":        "boolean",
+						"description": "Include block properties",
+						"default":     true,
+					},
+					"format": map[string]any{
+						"type":        "string",
+						"description": "Render the text result as an indented markdown outline or as JSON",
+						"enum":        blockTreeFormats,
+						"default":     "markdown",
+					},
+				},
+				"required": mcpServer.required("pageOrBlockId"),
+			},
+			// The SDK cannot infer a schema for the recursive BlockNode.
+			OutputSchema: blockTreeSchema(),
+		},
+		func(ctx context.Context, request *mcp.CallToolRequest, args GetBlockTreeArgs) (*mcp.CallToolResult, *BlockTree, error) {
+			return mcpServer.getBlockTree(ctx, args)
+		},
+	)
+
+	addTool(
+		mcpServer,
+		&mcp.Tool{
+			Name:        "get_references",
+			Description: "Get what references a page or block: linked references, tag usages and, for pages, unlinked mentions of the title, grouped by page",
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"graph": mcpServer.graphSchema(),
+					"pageOrBlockId": map[string]any{
+						"type":        "string",
+						"description": "The page's name or UUID, or a block UUID",
+					},
+				},
+				"required": mcpServer.required("pageOrBlockId"),
+			},
+		},
+		func(ctx context.Context, request *mcp.CallToolRequest, args GetReferencesArgs) (*mcp.CallToolResult, *References, error) {
+			return readGraph(ctx, mcpServer, args.Graph, func(graph string) (*References, error) {
+				return mcpServer.backend.GetReferences(ctx, graph, args.PageOrBlockID)
+			}, formatReferences, func(refs *References) *References {
+				return refs
+			})
+		},
+	)
+
+	addTool(
+		mcpServer,
+		&mcp.Tool{
+			Name:        "search",
+			Description: "Full-text search over the page names and block text of a graph, best matches first, with highlighted snippets and the page and parent blocks of each match",
 			InputSchema: map[string]any{
 				"type": "object",
 				"properties": map[string]any{
-					"graph": map[string]any{
+					"graph": mcpServer.graphSchema(),
+					"query": map[string]any{
 						"type":        "string",
-						"description": "The name of the Logseq graph (e.g., 'mcp', 'Demo')",
+						"description": `Words to find, all of which must match. Quote a phrase ("weekly review") and end a word with * to match it as a prefix (meet*).`,
 					},
+					"limit": map[string]any{
+						"type":        "integer",
+						"description": fmt.Sprintf("Maximum number of results (at most %d)", maxSearchLimit),
+						"minimum":     1,
+						"maximum":     maxSearchLimit,
+						"default":     defaultSearchLimit,
+					},
+					"offset": map[string]any{
+						"type":        "integer",
+						"description": "Number of results to skip, for the next page of results",
+						"minimum":     0,
+						"default":     0,
+					},
+				},
+				"required": mcpServer.required("query"),
+			},
+		},
+		func(ctx context.Context, request *mcp.CallToolRequest, args SearchArgs) (*mcp.CallToolResult, *SearchResults, error) {
+			return mcpServer.search(ctx, args)
+		},
+	)
+
+	addTool(
+		mcpServer,
+		&mcp.Tool{
+			Name:        "list_tags",
+			Description: "List all tags in a graph",
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"graph": mcpServer.graphSchema(),
 					"expand": map[string]any{
 						"type":        "boolean",
 						"description": "Provide additional detail on each tag (e.g. their parents/extends and tag properties)",
 						"default":     false,
 					},
 				},
-				"required": []string{"graph"},
+				"required": mcpServer.required(),
 			},
 		},
-		func(ctx context.Context, request *mcp.CallToolRequest, args ListTagsArgs) (*mcp.CallToolResult, any, error) {
-			expandStr := "false"
-			if args.Expand {
-				expandStr = "true"
-			}
-			return mcpServer.executeScriptWithArgs(ctx, "list_tags.cljs", args.Graph, []string{expandStr})
+		func(ctx context.Context, request *mcp.CallToolRequest, args ListTagsArgs) (*mcp.CallToolResult, *TagList, error) {
+			return readGraph(ctx, mcpServer, args.Graph, func(graph string) ([]Tag, error) {
+				return mcpServer.backend.ListTags(ctx, graph, args.Expand)
+			}, func(tags []Tag) string {
+				return formatTags(tags, args.Expand)
+			}, func(tags []Tag) *TagList {
+				return &TagList{Tags: tags}
+			})
 		},
 	)
 
-	mcp.AddTool(
-		mcpServer.server,
+	addTool(
+		mcpServer,
 		&mcp.Tool{
 			Name:        "list_properties",
 			Description: "List all properties in a graph",
 			InputSchema: map[string]any{
 				"type": "object",
 				"properties": map[string]any{
-					"graph": map[string]any{
-						"type":        "string",
-						"description": "The name of the Logseq graph (e.g., 'mcp', 'Demo')",
-					},
+					"graph": mcpServer.graphSchema(),
 					"expand": map[string]any{
 						"type":        "boolean",
 						"description": "Provide additional detail on each property (e.g. property type, cardinality)",
 						"default":     false,
 					},
 				},
-				"required": []string{"graph"},
+				"required": mcpServer.required(),
 			},
 		},
-		func(ctx context.Context, request *mcp.CallToolRequest, args ListPropertiesArgs) (*mcp.CallToolResult, any, error) {
-			expandStr := "false"
-			if args.Expand {
-				expandStr = "true"
-			}
-			return mcpServer.executeScriptWithArgs(ctx, "list_properties.cljs", args.Graph, []string{expandStr})
+		func(ctx context.Context, request *mcp.CallToolRequest, args ListPropertiesArgs) (*mcp.CallToolResult, *PropertyList, error) {
+			return readGraph(ctx, mcpServer, args.Graph, func(graph string) ([]Property, error) {
+				return mcpServer.backend.ListProperties(ctx, graph, args.Expand)
+			}, func(props []Property) string {
+				return formatProperties(props, args.Expand)
+			}, func(props []Property) *PropertyList {
+				return &PropertyList{Properties: props}
+			})
 		},
 	)
 
 	// API-based Tools
-	mcp.AddTool(
-		mcpServer.server,
+	addTool(
+		mcpServer,
 		&mcp.Tool{
 			Name:        "create_task",
 			Description: "Create a new task in Logseq via API. Can create a top-level task on a page or a sub-task under an existing block. Requires Logseq to be running with HTTP API enabled.",
 			InputSchema: map[string]any{
 				"type": "object",
 				"properties": map[string]any{
+					"graph": writeGraphSchema,
 					"pageOrBlockId": map[string]any{
 						"type":        "string",
 						"description": "The page name, date, or block UUID where the task should be created. For top-level tasks, use a page name (e.g., 'Feb 7th, 2026' or 'Projects'). For sub-tasks, use the parent task's UUID.",
@@ -373,33 +937,32 @@ func registerTools(mcpServer *MCPServer) {
 						"enum":        []string{"High", "Medium", "Low"},
 						"default":     "Medium",
 					},
+					"deadline":  whenSchema("When the task is due", false),
+					"scheduled": whenSchema("When the task is scheduled", false),
+					"repeat":    repeatSchema(false),
 				},
 				"required": []string{"pageOrBlockId", "content"},
 			},
 		},
-		func(ctx context.Context, request *mcp.CallToolRequest, args CreateTaskArgs) (*mcp.CallToolResult, any, error) {
-			result, metadata, err := mcpServer.executeAPIScript(ctx, "create_task_clean.cljs", map[string]any{
-				"pageOrBlockId": args.PageOrBlockID,
-				"content":       args.Content,
-				"status":        args.Status,
-				"priority":      args.Priority,
-			})
-			if err == nil {
+		func(ctx context.Context, request *mcp.CallToolRequest, args CreateTaskArgs) (*mcp.CallToolResult, *CreatedBlock, error) {
+			result, out, err := mcpServer.createTask(ctx, args)
+			if !result.IsError {
 				// Notify clients that resources have changed
 				go mcpServer.notifyResourcesChanged(ctx)
 			}
-			return result, metadata, err
+			return result, out, err
 		},
 	)
 
-	mcp.AddTool(
-		mcpServer.server,
+	addTool(
+		mcpServer,
 		&mcp.Tool{
 			Name:        "complete_task",
-			Description: "Mark a task as complete (Done status) via API. Requires Logseq running.",
+			Description: "Mark a task as complete (Done status) via API. A repeating task goes back to Todo instead, with its deadline (or scheduled date) moved on by its interval until it is in the future. Requires Logseq running.",
 			InputSchema: map[string]any{
 				"type": "object",
 				"properties": map[string]any{
+					"graph": writeGraphSchema,
 					"uuid": map[string]any{
 						"type":        "string",
 						"description": "The UUID of the task block to mark as complete",
@@ -408,25 +971,24 @@ func registerTools(mcpServer *MCPServer) {
 				"required": []string{"uuid"},
 			},
 		},
-		func(ctx context.Context, request *mcp.CallToolRequest, args CompleteTaskArgs) (*mcp.CallToolResult, any, error) {
-			result, metadata, err := mcpServer.executeAPIScript(ctx, "complete_task.cljs", map[string]any{
-				"uuid": args.UUID,
-			})
-			if err == nil {
+		func(ctx context.Context, request *mcp.CallToolRequest, args CompleteTaskArgs) (*mcp.CallToolResult, *TaskUpdate, error) {
+			result, out, err := mcpServer.completeTask(ctx, args)
+			if !result.IsError {
 				go mcpServer.notifyResourcesChanged(ctx)
 			}
-			return result, metadata, err
+			return result, out, err
 		},
 	)
 
-	mcp.AddTool(
-		mcpServer.server,
+	addTool(
+		mcpServer,
 		&mcp.Tool{
 			Name:        "update_task",
-			Description: "Update a task's status and/or content via API. Requires Logseq running. At least one of status or content must be provided.",
+			Description: "Update a task's status, content, deadline, scheduled date or recurrence via API. Requires Logseq running. At least one of them must be provided.",
 			InputSchema: map[string]any{
 				"type": "object",
 				"properties": map[string]any{
+					"graph": writeGraphSchema,
 					"uuid": map[string]any{
 						"type":        "string",
 						"description": "The UUID of the task block to update",
@@ -440,31 +1002,31 @@ func registerTools(mcpServer *MCPServer) {
 						"type":        "string",
 						"description": "New task content/title (optional)",
 					},
+					"deadline":  whenSchema("New deadline (optional)", true),
+					"scheduled": whenSchema("New scheduled date (optional)", true),
+					"repeat":    repeatSchema(true),
 				},
 				"required": []string{"uuid"},
 			},
 		},
-		func(ctx context.Context, request *mcp.CallToolRequest, args UpdateTaskArgs) (*mcp.CallToolResult, any, error) {
-			result, metadata, err := mcpServer.executeAPIScript(ctx, "update_task.cljs", map[string]any{
-				"uuid":    args.UUID,
-				"status":  args.Status,
-				"content": args.Content,
-			})
-			if err == nil {
+		func(ctx context.Context, request *mcp.CallToolRequest, args UpdateTaskArgs) (*mcp.CallToolResult, *TaskUpdate, error) {
+			result, out, err := mcpServer.updateTask(ctx, args)
+			if !result.IsError {
 				go mcpServer.notifyResourcesChanged(ctx)
 			}
-			return result, metadata, err
+			return result, out, err
 		},
 	)
 
-	mcp.AddTool(
-		mcpServer.server,
+	addTool(
+		mcpServer,
 		&mcp.Tool{
 			Name:        "add_content",
-			Description: "Add content (blocks) to a page or as children of an existing block via API. This is for general content, not tasks. Requires Logseq running.",
+			Description: "Add content (blocks) to a page or as children of an existing block via API. This is for general content, not tasks; append_to_journal writes to a day's journal by date. Requires Logseq running.",
 			InputSchema: map[string]any{
 				"type": "object",
 				"properties": map[string]any{
+					"graph": writeGraphSchema,
 					"pageOrBlockId": map[string]any{
 						"type":        "string",
 						"description": "The page name, date, or block UUID where the content should be added. For top-level content, use a page name (e.g., 'Feb 7th, 2026' or 'Notes'). For child content, use the parent block's UUID.",
@@ -477,331 +1039,394 @@ func registerTools(mcpServer *MCPServer) {
 				"required": []string{"pageOrBlockId", "content"},
 			},
 		},
-		func(ctx context.Context, request *mcp.CallToolRequest, args AddContentArgs) (*mcp.CallToolResult, any, error) {
-			result, metadata, err := mcpServer.executeAPIScript(ctx, "add_content.cljs", map[string]any{
-				"pageOrBlockId": args.PageOrBlockID,
-				"content":       args.Content,
-			})
-			if err == nil {
+		func(ctx context.Context, request *mcp.CallToolRequest, args AddContentArgs) (*mcp.CallToolResult, *CreatedBlock, error) {
+			result, out, err := mcpServer.addContent(ctx, args)
+			if !result.IsError {
 				go mcpServer.notifyResourcesChanged(ctx)
 			}
-			return result, metadata, err
+			return result, out, err
 		},
 	)
-}
-
-func registerResources(mcpServer *MCPServer) {
-	mcpServer.server.AddResource(
-		&mcp.Resource{
-			URI:         "logseq://tasks/*",
-			Name:        "Logseq Tasks",
-			Description: "All tasks in a Logseq graph. Use URI pattern: logseq://tasks/{graph}",
-			MIMEType:    "application/json",
-		},
-		func(ctx context.Context, request *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
-			// Extract graph from URI
-			uri := request.Params.URI
-			parts := strings.Split(uri, "/")
-			if len(parts) < 4 {
-				return nil, fmt.Errorf("invalid URI format, expected: logseq://tasks/{graph}")
-			}
-			graph := parts[3]
-
-			// Fetch tasks
-			_, _, err := mcpServer.executeScript(ctx, "list_all_tasks.cljs", map[string]any{
-				"graph": graph,
-			})
-			if err != nil {
-				return nil, err
-			}
-
-			mcpServer.mu.RLock()
-			defer mcpServer.mu.RUnlock()
-
-			tasks := mcpServer.tasks[graph]
-			jsonData, err := json.Marshal(tasks)
-			if err != nil {
-				return nil, err
-			}
 
-			return &mcp.ReadResourceResult{
-				Contents: []*mcp.ResourceContents{
-					{
-						URI:      uri,
-						MIMEType: "application/json",
-						Text:     string(jsonData),
+	addTool(
+		mcpServer,
+		&mcp.Tool{
+			Name:        "append_to_journal",
+			Description: "Add a block to a day's journal page, creating the page, titled in the graph's date format, if it does not exist yet. Defaults to today. Use this rather than add_content for daily notes and logs. Requires Logseq running.",
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"graph": writeGraphSchema,
+					"date":  journalDateSchema("The journal's day (default: today)"),
+					"content": map[string]any{
+						"type":        "string",
+						"description": "The content to add (supports markdown formatting)",
 					},
 				},
-			}, nil
+				"required": []string{"content"},
+			},
+		},
+		func(ctx context.Context, request *mcp.CallToolRequest, args AppendToJournalArgs) (*mcp.CallToolResult, *JournalEntry, error) {
+			result, out, err := mcpServer.appendToJournal(ctx, args)
+			if !result.IsError {
+				go mcpServer.notifyResourcesChanged(ctx)
+			}
+			return result, out, err
 		},
 	)
-}
 
-func (m *MCPServer) executeScript(ctx context.Context, scriptName string, args map[string]any) (*mcp.CallToolResult, any, error) {
-	// Extract graph parameter
-	graph, ok := args["graph"].(string)
-	if !ok || graph == "" {
-		return &mcp.CallToolResult{
-			Content: []mcp.Content{
-				&mcp.TextContent{Text: "Error: graph parameter is required"},
+	addTool(
+		mcpServer,
+		&mcp.Tool{
+			Name:        "move_block",
+			Description: "Move a block, with its children, under another block or page, or before or after a sibling. Requires Logseq running.",
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"graph": writeGraphSchema,
+					"uuid": map[string]any{
+						"type":        "string",
+						"description": "The UUID of the block to move",
+					},
+					"target": map[string]any{
+						"type":        "string",
+						"description": "The block UUID, or for first-child and last-child also the page name or UUID, to move the block to",
+					},
+					"position": map[string]any{
+						"type":        "string",
+						"description": "Where the block goes relative to target: as its first or last child, or as the sibling just before or after it",
+						"enum":        blockPositions,
+						"default":     "last-child",
+					},
+				},
+				"required": []string{"uuid", "target"},
 			},
-			IsError: true,
-		}, nil, nil
-	}
-
-	// Execute the script
-	cmd := exec.CommandContext(ctx, "/app/mcp-logseq/run-script.sh", scriptName, graph)
-	cmd.Env = append(os.Environ(),
-		"HOME=/root",
+		},
+		func(ctx context.Context, request *mcp.CallToolRequest, args MoveBlockArgs) (*mcp.CallToolResult, *BlockChange, error) {
+			result, out, err := mcpServer.moveBlock(ctx, args)
+			if !result.IsError {
+				go mcpServer.notifyResourcesChanged(ctx)
+			}
+			return result, out, err
+		},
 	)
 
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return &mcp.CallToolResult{
-			Content: []mcp.Content{
-				&mcp.TextContent{Text: fmt.Sprintf("Script execution failed: %v\nOutput: %s", err, string(output))},
+	addTool(
+		mcpServer,
+		&mcp.Tool{
+			Name:        "delete_block",
+			Description: "Delete a block. Its children move up into its place unless recursive is set, which deletes them too. Requires Logseq running.",
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"graph": writeGraphSchema,
+					"uuid": map[string]any{
+						"type":        "string",
+						"description": "The UUID of the block to delete",
+					},
+					"recursive": map[string]any{
+						"type":        "boolean",
+						"description": "Delete the block's children as well",
+						"default":     false,
+					},
+				},
+				"required": []string{"uuid"},
 			},
-			IsError: true,
-		}, nil, nil
-	}
-
-	// Parse and cache tasks if this is a task listing
-	if strings.Contains(scriptName, "task") {
-		m.parseTasks(graph, string(output))
-	}
-
-	return &mcp.CallToolResult{
-		Content: []mcp.Content{
-			&mcp.TextContent{Text: string(output)},
 		},
-	}, nil, nil
-}
+		func(ctx context.Context, request *mcp.CallToolRequest, args DeleteBlockArgs) (*mcp.CallToolResult, *BlockChange, error) {
+			result, out, err := mcpServer.deleteBlock(ctx, args)
+			if !result.IsError {
+				go mcpServer.notifyResourcesChanged(ctx)
+			}
+			return result, out, err
+		},
+	)
 
-func (m *MCPServer) executeScriptWithArgs(ctx context.Context, scriptName string, graph string, extraArgs []string) (*mcp.CallToolResult, any, error) {
-	if graph == "" {
-		return &mcp.CallToolResult{
-			Content: []mcp.Content{
-				&mcp.TextContent{Text: "Error: graph parameter is required"},
+	for _, outdent := range []bool{false, true} {
+		name, description := "indent_block", "Indent a block, with its children, making it the last child of the sibling above it. Requires Logseq running."
+		if outdent {
+			name, description = "outdent_block", "Outdent a block, with its children, making it the sibling just after its parent. Requires Logseq running."
+		}
+		addTool(
+			mcpServer,
+			&mcp.Tool{
+				Name:        name,
+				Description: description,
+				InputSchema: map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"graph": writeGraphSchema,
+						"uuid": map[string]any{
+							"type":        "string",
+							"description": "The UUID of the block to " + strings.TrimSuffix(name, "_block"),
+						},
+					},
+					"required": []string{"uuid"},
+				},
 			},
-			IsError: true,
-		}, nil, nil
+			func(ctx context.Context, request *mcp.CallToolRequest, args IndentBlockArgs) (*mcp.CallToolResult, *BlockChange, error) {
+				result, out, err := mcpServer.indentBlock(ctx, args, outdent)
+				if !result.IsError {
+					go mcpServer.notifyResourcesChanged(ctx)
+				}
+				return result, out, err
+			},
+		)
 	}
 
-	// Build command arguments: script name, graph, then any extra args
-	cmdArgs := []string{scriptName, graph}
-	cmdArgs = append(cmdArgs, extraArgs...)
-
-	// Execute the script
-	cmd := exec.CommandContext(ctx, "/app/mcp-logseq/run-script.sh", cmdArgs...)
-	cmd.Env = append(os.Environ(),
-		"HOME=/root",
+	addTool(
+		mcpServer,
+		&mcp.Tool{
+			Name:        "create_page",
+			Description: "Create a page with optional properties, tags and an initial outline of blocks. Requires Logseq running.",
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"graph": writeGraphSchema,
+					"name": map[string]any{
+						"type":        "string",
+						"description": "The title of the new page",
+					},
+					"properties": map[string]any{
+						"type":                 "object",
+						"description":          "Page properties by name, e.g. {\"type\": \"project\"}",
+						"additionalProperties": map[string]any{"type": "string"},
+					},
+					"tags": map[string]any{
+						"type":        "array",
+						"description": "Tags (classes) to give the page, e.g. [\"Project\"]",
+						"items":       map[string]any{"type": "string"},
+					},
+					"blocks": map[string]any{
+						"type":        "array",
+						"description": "Blocks to add to the page, in order, each with optional nested children",
+						"items":       map[string]any{"$ref": "#/$defs/block"},
+					},
+				},
+				"required": []string{"name"},
+				"$defs": map[string]any{
+					"block": map[string]any{
+						"type":     "object",
+						"required": []string{"content"},
+						"properties": map[string]any{
+							"content": map[string]any{"type": "string"},
+							"children": map[string]any{
+								"type":  "array",
+								"items": map[string]any{"$ref": "#/$defs/block"},
+							},
+						},
+					},
+				},
+			},
+		},
+		func(ctx context.Context, request *mcp.CallToolRequest, args CreatePageArgs) (*mcp.CallToolResult, *PageChange, error) {
+			result, out, err := mcpServer.createPage(ctx, args)
+			if !result.IsError {
+				go mcpServer.notifyResourcesChanged(ctx)
+			}
+			return result, out, err
+		},
 	)
 
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return &mcp.CallToolResult{
-			Content: []mcp.Content{
-				&mcp.TextContent{Text: fmt.Sprintf("Script execution failed: %v\nOutput: %s", err, string(output))},
+	addTool(
+		mcpServer,
+		&mcp.Tool{
+			Name:        "rename_page",
+			Description: "Rename a page. Links and tags that point at it follow the new name. Requires Logseq running.",
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"graph": writeGraphSchema,
+					"name": map[string]any{
+						"type":        "string",
+						"description": "The page's current name",
+					},
+					"newName": map[string]any{
+						"type":        "string",
+						"description": "The page's new name",
+					},
+				},
+				"required": []string{"name", "newName"},
 			},
-			IsError: true,
-		}, nil, nil
-	}
-
-	return &mcp.CallToolResult{
-		Content: []mcp.Content{
-			&mcp.TextContent{Text: string(output)},
 		},
-	}, nil, nil
-}
-
-func (m *MCPServer) executeAPIScript(ctx context.Context, scriptName string, args map[string]any) (*mcp.CallToolResult, any, error) {
-	// Build arguments for the script
-	var scriptArgs []string
-
-	switch scriptName {
-	case "create_task_clean.cljs":
-		pageOrBlockId, _ := args["pageOrBlockId"].(string)
-		content, _ := args["content"].(string)
-		status, _ := args["status"].(string)
-		priority, _ := args["priority"].(string)
+		func(ctx context.Context, request *mcp.CallToolRequest, args RenamePageArgs) (*mcp.CallToolResult, *PageChange, error) {
+			result, out, err := mcpServer.renamePage(ctx, args)
+			if !result.IsError {
+				go mcpServer.notifyResourcesChanged(ctx)
+			}
+			return result, out, err
+		},
+	)
 
-		if pageOrBlockId == "" || content == "" {
-			return &mcp.CallToolResult{
-				Content: []mcp.Content{
-					&mcp.TextContent{Text: "Error: pageOrBlockId and content parameters are required"},
-				},
-				IsError: true,
-			}, nil, nil
-		}
-		if status == "" {
-			status = "Todo"
-		}
-		if priority == "" {
-			priority = "Medium"
-		}
-		scriptArgs = []string{pageOrBlockId, content, status, priority}
-
-	case "complete_task.cljs", "get_task_info.cljs":
-		uuid, _ := args["uuid"].(string)
-		if uuid == "" {
-			return &mcp.CallToolResult{
-				Content: []mcp.Content{
-					&mcp.TextContent{Text: "Error: uuid parameter is required"},
+	addTool(
+		mcpServer,
+		&mcp.Tool{
+			Name:        "delete_page",
+			Description: "Delete a page and its blocks. Call it first without confirm to see what would be deleted and get a confirmation token, then again with confirm set to that token. Requires Logseq running.",
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"graph": writeGraphSchema,
+					"name": map[string]any{
+						"type":        "string",
+						"description": "The name or UUID of the page to delete",
+					},
+					"confirm": map[string]any{
+						"type":        "string",
+						"description": "The confirmation token returned by a previous call without confirm",
+					},
 				},
-				IsError: true,
-			}, nil, nil
-		}
-		scriptArgs = []string{uuid}
-
-	case "update_task.cljs":
-		uuid, _ := args["uuid"].(string)
-		status, _ := args["status"].(string)
-		content, _ := args["content"].(string)
+				"required": []string{"name"},
+			},
+		},
+		func(ctx context.Context, request *mcp.CallToolRequest, args DeletePageArgs) (*mcp.CallToolResult, *PageChange, error) {
+			result, out, err := mcpServer.deletePage(ctx, args)
+			if !result.IsError && out != nil && out.Action == "deleted" {
+				go mcpServer.notifyResourcesChanged(ctx)
+			}
+			return result, out, err
+		},
+	)
 
-		if uuid == "" {
-			return &mcp.CallToolResult{
-				Content: []mcp.Content{
-					&mcp.TextContent{Text: "Error: uuid parameter is required"},
+	addTool(
+		mcpServer,
+		&mcp.Tool{
+			Name:        "set_page_property",
+			Description: "Set a property on a page, creating the property if the graph does not have it yet. Requires Logseq running.",
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"graph": writeGraphSchema,
+					"name": map[string]any{
+						"type":        "string",
+						"description": "The name or UUID of the page",
+					},
+					"key": map[string]any{
+						"type":        "string",
+						"description": "The property's name",
+					},
+					"value": map[string]any{
+						"type":        "string",
+						"description": "The property's value",
+					},
 				},
-				IsError: true,
-			}, nil, nil
-		}
+				"required": []string{"name", "key", "value"},
+			},
+		},
+		func(ctx context.Context, request *mcp.CallToolRequest, args SetPagePropertyArgs) (*mcp.CallToolResult, *PageChange, error) {
+			result, out, err := mcpServer.setPageProperty(ctx, args)
+			if !result.IsError {
+				go mcpServer.notifyResourcesChanged(ctx)
+			}
+			return result, out, err
+		},
+	)
 
-		if status == "" && content == "" {
-			return &mcp.CallToolResult{
-				Content: []mcp.Content{
-					&mcp.TextContent{Text: "Error: at least one of status or content must be provided"},
+	addTool(
+		mcpServer,
+		&mcp.Tool{
+			Name:        "set_block_property",
+			Description: "Set a property on a block. Built-in and user properties are both accepted; the value is checked against the property's type, cardinality and closed values as list_properties reports them. Node properties take page names or block UUIDs, date properties YYYY-MM-DD days with a journal page, datetime properties RFC 3339 times. An unknown key creates a text property. Requires Logseq running.",
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"graph": writeGraphSchema,
+					"uuid": map[string]any{
+						"type":        "string",
+						"description": "The UUID of the block (or page)",
+					},
+					"key": map[string]any{
+						"type":        "string",
+						"description": "The property's name or :db/ident, e.g. owner or logseq.property/priority",
+					},
+					"value": map[string]any{
+						"description": "The value, or for a property with many values a list of them",
+						"anyOf": []any{
+							map[string]any{"type": []string{"string", "number", "boolean"}},
+							map[string]any{"type": "array", "items": map[string]any{"type": []string{"string", "number", "boolean"}}},
+						},
+					},
 				},
-				IsError: true,
-			}, nil, nil
-		}
-
-		scriptArgs = []string{uuid, status, content}
-
-	case "add_content.cljs":
-		pageOrBlockId, _ := args["pageOrBlockId"].(string)
-		content, _ := args["content"].(string)
+				"required": []string{"uuid", "key", "value"},
+			},
+		},
+		func(ctx context.Context, request *mcp.CallToolRequest, args SetBlockPropertyArgs) (*mcp.CallToolResult, *PropertyChange, error) {
+			result, out, err := mcpServer.setBlockProperty(ctx, args)
+			if !result.IsError {
+				go mcpServer.notifyResourcesChanged(ctx)
+			}
+			return result, out, err
+		},
+	)
 
-		if pageOrBlockId == "" || content == "" {
-			return &mcp.CallToolResult{
-				Content: []mcp.Content{
-					&mcp.TextContent{Text: "Error: pageOrBlockId and content parameters are required"},
+	addTool(
+		mcpServer,
+		&mcp.Tool{
+			Name:        "remove_block_property",
+			Description: "Remove a property and its values from a block. Requires Logseq running.",
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"graph": writeGraphSchema,
+					"uuid": map[string]any{
+						"type":        "string",
+						"description": "The UUID of the block (or page)",
+					},
+					"key": map[string]any{
+						"type":        "string",
+						"description": "The property's name or :db/ident",
+					},
 				},
-				IsError: true,
-			}, nil, nil
-		}
-
-		scriptArgs = []string{pageOrBlockId, content}
-	}
-
-	// Execute the script
-	cmdArgs := append([]string{scriptName}, scriptArgs...)
-	cmd := exec.CommandContext(ctx, "/app/mcp-logseq/run-script.sh", cmdArgs...)
-
-	// Pass through API configuration from environment
-	envVars := []string{"HOME=/root"}
-	if apiHost := os.Getenv("LOGSEQ_API_HOST"); apiHost != "" {
-		envVars = append(envVars, "LOGSEQ_API_HOST="+apiHost)
-	}
-	if apiPort := os.Getenv("LOGSEQ_API_PORT"); apiPort != "" {
-		envVars = append(envVars, "LOGSEQ_API_PORT="+apiPort)
-	}
-	if apiToken := os.Getenv("LOGSEQ_API_AUTHORIZATION_TOKEN"); apiToken != "" {
-		envVars = append(envVars, "LOGSEQ_API_AUTHORIZATION_TOKEN="+apiToken)
-	}
-	cmd.Env = append(os.Environ(), envVars...)
-
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		errMsg := fmt.Sprintf("API script execution failed: %v\nOutput: %s", err, string(output))
-		if strings.Contains(string(output), "fetch failed") || strings.Contains(string(output), "ECONNREFUSED") {
-			apiHost := os.Getenv("LOGSEQ_API_HOST")
-			if apiHost == "" {
-				apiHost = "host.docker.internal"
-			}
-			apiPort := os.Getenv("LOGSEQ_API_PORT")
-			if apiPort == "" {
-				apiPort = "12315"
-			}
-			errMsg += "\n\nLogseq API appears to be unavailable. Please ensure:\n"
-			errMsg += "  1. Logseq is running on your host\n"
-			errMsg += "  2. HTTP API is enabled (Settings > Features > Developer Mode > HTTP APIs)\n"
-			errMsg += fmt.Sprintf("  3. The API is accessible at %s:%s", apiHost, apiPort)
-		}
-		return &mcp.CallToolResult{
-			Content: []mcp.Content{
-				&mcp.TextContent{Text: errMsg},
+				"required": []string{"uuid", "key"},
 			},
-			IsError: true,
-		}, nil, nil
-	}
-
-	return &mcp.CallToolResult{
-		Content: []mcp.Content{
-			&mcp.TextContent{Text: string(output)},
 		},
-	}, nil, nil
-}
-
-func (m *MCPServer) parseTasks(graph string, output string) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	var tasks []Task
-	lines := strings.Split(output, "\n")
-	var currentTask *Task
-
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" {
-			if currentTask != nil {
-				tasks = append(tasks, *currentTask)
-				currentTask = nil
+		func(ctx context.Context, request *mcp.CallToolRequest, args RemoveBlockPropertyArgs) (*mcp.CallToolResult, *PropertyChange, error) {
+			result, out, err := mcpServer.removeBlockProperty(ctx, args)
+			if !result.IsError && out != nil && out.Action == "removed" {
+				go mcpServer.notifyResourcesChanged(ctx)
 			}
-			continue
-		}
+			return result, out, err
+		},
+	)
+}
 
-		if currentTask == nil {
-			currentTask = &Task{}
+// subscribe checks that the URI names a resource of a readable graph and
+// starts watching it for the session. The SDK records the subscription
+// too, and ResourceUpdated only notifies the sessions subscribed to a URI.
+func (m *MCPServer) subscribe(ctx context.Context, req *mcp.SubscribeRequest) error {
+	r, err := parseResourceURI(req.Params.URI)
+	if err != nil {
+		return err
+	}
+	if r.kind != resourceGraphs {
+		if r.graph, err = m.cfg.resolveGraph(r.graph); err != nil {
+			return err
 		}
-
-		if strings.HasPrefix(line, "Task ID:") {
-			fmt.Sscanf(line, "Task ID: %d", &currentTask.ID)
-		} else if after, ok :=strings.CutPrefix(line, "UUID:"); ok  {
-			currentTask.UUID = strings.TrimSpace(after)
-		} else if after, ok :=strings.CutPrefix(line, "Title:"); ok  {
-			currentTask.Title = strings.TrimSpace(after)
-		} else if after, ok :=strings.CutPrefix(line, "Status:"); ok  {
-			currentTask.Status = strings.TrimSpace(after)
-		} else if after, ok :=strings.CutPrefix(line, "Priority:"); ok  {
-			currentTask.Priority = strings.TrimSpace(after)
+		if err := m.checkGraph(ctx, r.graph); err != nil {
+			return err
 		}
 	}
+	m.watcher.subscribe(ctx, req.Session, req.Params.URI, r)
+	return nil
+}
 
-	if currentTask != nil {
-		tasks = append(tasks, *currentTask)
+func (m *MCPServer) unsubscribe(ctx context.Context, req *mcp.UnsubscribeRequest) error {
+	if _, err := parseResourceURI(req.Params.URI); err != nil {
+		return err
 	}
-
-	m.tasks[graph] = tasks
+	m.watcher.unsubscribe(req.Session, req.Params.URI)
+	return nil
 }
 
+// notifyResourcesChanged runs after a write tool succeeds. It checks the
+// subscribed graphs now rather than at the next tick; the watcher notifies
+// whatever the write changed once it reaches db.sqlite.
 func (m *MCPServer) notifyResourcesChanged(ctx context.Context) {
-	// Notify clients about all task resources that may have changed
-	// This sends a notification for all graphs that have cached tasks
-	m.mu.RLock()
-	graphs := make([]string, 0, len(m.tasks))
-	for graph := range m.tasks {
-		graphs = append(graphs, graph)
-	}
-	m.mu.RUnlock()
-
-	// Send resource updated notifications
-	for _, graph := range graphs {
-		uri := fmt.Sprintf("logseq://tasks/%s", graph)
-		if err := m.server.ResourceUpdated(ctx, &mcp.ResourceUpdatedNotificationParams{
-			URI: uri,
-		}); err != nil {
-			log.Printf("Failed to send resource update notification for %s: %v", uri, err)
-		}
+	m.watcher.poke()
+}
+
+func (m *MCPServer) resourceUpdated(ctx context.Context, uri string) {
+	if err := m.server.ResourceUpdated(ctx, &mcp.ResourceUpdatedNotificationParams{URI: uri}); err != nil {
+		log.Printf("Failed to send resource update notification for %s: %v", uri, err)
 	}
 }
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"time"
+)
+
+// Task represents a Logseq task
+type Task struct {
+	ID        int        `json:"id"`
+	UUID      string     `json:"uuid"`
+	Title     string     `json:"title"`
+	Status    string     `json:"status"`
+	Priority  string     `json:"priority,omitempty"`
+	Page      string     `json:"page,omitempty" jsonschema:"title of the page the task is on"`
+	Deadline  *time.Time `json:"deadline,omitempty"`
+	Scheduled *time.Time `json:"scheduled,omitempty"`
+	Repeat    string     `json:"repeat,omitempty" jsonschema:"how the task repeats, e.g. every 2 weeks"`
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+	UpdatedAt *time.Time `json:"updatedAt,omitempty"`
+}
+
+// TaskFilter selects tasks for find_tasks. Empty fields match everything.
+type TaskFilter struct {
+	Statuses  []string  `json:"statuses,omitempty"`
+	Priority  string    `json:"priority,omitempty"`
+	Page      string    `json:"page,omitempty"`
+	Tag       string    `json:"tag,omitempty"`
+	Text      string    `json:"text,omitempty"`
+	Parent    string    `json:"parent,omitempty"`
+	Created   TimeRange `json:"created"`
+	Updated   TimeRange `json:"updated"`
+	Deadline  TimeRange `json:"deadline"`
+	Scheduled TimeRange `json:"scheduled"`
+}
+
+// TimeRange is a half-open range [After, Before) of millisecond
+// timestamps, the unit Logseq stores. Zero bounds are open.
+type TimeRange struct {
+	After  int64 `json:"after,omitempty"`
+	Before int64 `json:"before,omitempty"`
+}
+
+// IsZero reports whether the range is unbounded.
+func (r TimeRange) IsZero() bool {
+	return r.After == 0 && r.Before == 0
+}
+
+// Contains reports whether ms, a millisecond timestamp, is in the range.
+func (r TimeRange) Contains(ms int64) bool {
+	return (r.After == 0 || ms >= r.After) && (r.Before == 0 || ms < r.Before)
+}
+
+// Page is a page in a graph. Tags, properties and journal days are pages
+// too.
+type Page struct {
+	ID         int        `json:"id,omitempty"`
+	UUID       string     `json:"uuid"`
+	Title      string     `json:"title"`
+	Name       string     `json:"name,omitempty"`
+	Journal    bool       `json:"journal,omitempty"`
+	JournalDay int        `json:"journalDay,omitempty"`
+	CreatedAt  *time.Time `json:"createdAt,omitempty"`
+	UpdatedAt  *time.Time `json:"updatedAt,omitempty"`
+}
+
+// Block is a block on a page.
+type Block struct {
+	ID     int    `json:"id,omitempty"`
+	UUID   string `json:"uuid"`
+	Title  string `json:"title"`
+	Order  string `json:"order,omitempty"`
+	Parent string `json:"parent,omitempty" jsonschema:"UUID of the parent block, empty for top-level blocks"`
+}
+
+// PageContent is a page with its blocks in display order. Parent links
+// give the block tree.
+type PageContent struct {
+	Page   Page    `json:"page"`
+	Blocks []Block `json:"blocks,omitempty"`
+}
+
+// BlockNode is a block with its children in outline order. Properties
+// maps property titles to their values as text.
+type BlockNode struct {
+	ID         int               `json:"id"`
+	UUID       string            `json:"uuid"`
+	Title      string            `json:"title"`
+	Order      string            `json:"order,omitempty"`
+	Collapsed  bool              `json:"collapsed,omitempty"`
+	Properties map[string]string `json:"properties,omitempty"`
+	Children   []BlockNode       `json:"children,omitempty"`
+	// Truncated is set when a depth limit left out the block's children.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// BlockTree is the outline of a page, or of one block and its
+// descendants, in which case Blocks holds just that block.
+type BlockTree struct {
+	Page   Page        `json:"page"`
+	Blocks []BlockNode `json:"blocks,omitempty"`
+}
+
+// Reference is a block (or page) that refers to the target of
+// get_references. Path holds the titles of the blocks above it, from the
+// top of its page down.
+type Reference struct {
+	ID    int      `json:"id"`
+	UUID  string   `json:"uuid"`
+	Title string   `json:"title"`
+	Path  []string `json:"path,omitempty" jsonschema:"titles of the ancestor blocks, outermost first"`
+}
+
+// ReferenceGroup is the references on one page.
+type ReferenceGroup struct {
+	Page       string      `json:"page"`
+	PageUUID   string      `json:"pageUuid"`
+	References []Reference `json:"references"`
+}
+
+// References is the output of get_references. Linked holds blocks that
+// link to the target, Tagged blocks and pages tagged with it and Unlinked
+// blocks that mention a page's title as plain text.
+type References struct {
+	Title    string           `json:"title"`
+	UUID     string           `json:"uuid"`
+	Linked   []ReferenceGroup `json:"linked,omitempty"`
+	Tagged   []ReferenceGroup `json:"tagged,omitempty"`
+	Unlinked []ReferenceGroup `json:"unlinked,omitempty"`
+}
+
+// SearchResult is a page or block matching a search. Snippet is the
+// matching part of its title with the matched words in **bold**.
+type SearchResult struct {
+	Kind     string   `json:"kind" jsonschema:"page or block"`
+	ID       int      `json:"id"`
+	UUID     string   `json:"uuid"`
+	Title    string   `json:"title"`
+	Page     string   `json:"page,omitempty"`
+	PageUUID string   `json:"pageUuid,omitempty"`
+	Path     []string `json:"path,omitempty" jsonschema:"titles of the ancestor blocks, outermost first"`
+	Snippet  string   `json:"snippet"`
+	Score    float64  `json:"score"`
+}
+
+// SearchResults is the output of search: one page of the results, best
+// first, and the number of results in all.
+type SearchResults struct {
+	Query   string         `json:"query"`
+	Total   int            `json:"total"`
+	Offset  int            `json:"offset"`
+	Results []SearchResult `json:"results,omitempty"`
+}
+
+// Tag is a tag (class). Fields other than UUID and Title are only filled
+// in when expanded.
+type Tag struct {
+	UUID        string     `json:"uuid"`
+	Title       string     `json:"title"`
+	Ident       string     `json:"ident,omitempty"`
+	Extends     []string   `json:"extends,omitempty"`
+	Properties  []string   `json:"properties,omitempty"`
+	Description string     `json:"description,omitempty"`
+	CreatedAt   *time.Time `json:"createdAt,omitempty"`
+	UpdatedAt   *time.Time `json:"updatedAt,omitempty"`
+}
+
+// Property is a property definition. Fields other than UUID and Title are
+// only filled in when expanded.
+type Property struct {
+	UUID         string     `json:"uuid"`
+	Title        string     `json:"title"`
+	Ident        string     `json:"ident,omitempty"`
+	Type         string     `json:"type,omitempty"`
+	Cardinality  string     `json:"cardinality,omitempty"`
+	Classes      []string   `json:"classes,omitempty"`
+	Description  string     `json:"description,omitempty"`
+	Public       bool       `json:"public,omitempty"`
+	ClosedValues []string   `json:"closedValues,omitempty"`
+	CreatedAt    *time.Time `json:"createdAt,omitempty"`
+	UpdatedAt    *time.Time `json:"updatedAt,omitempty"`
+}
+
+// Graph is a graph the server can read. Size and ModifiedAt describe its
+// db.sqlite file.
+type Graph struct {
+	Name       string     `json:"name"`
+	Aliases    []string   `json:"aliases,omitempty"`
+	Size       int64      `json:"size,omitempty" jsonschema:"size of db.sqlite in bytes"`
+	ModifiedAt *time.Time `json:"modifiedAt,omitempty"`
+	Pages      int        `json:"pages"`
+	Blocks     int        `json:"blocks"`
+	Tasks      int        `json:"tasks"`
+	Current    bool       `json:"current" jsonschema:"whether the graph is open in the Logseq app that receives its writes"`
+	ReadOnly   bool       `json:"readOnly,omitempty"`
+	Error      string     `json:"error,omitempty" jsonschema:"why the graph could not be read"`
+}
+
+// Tool outputs. The SDK derives each tool's output schema from these and
+// requires an object, so lists are wrapped. Lists are omitted when empty
+// because error results carry the zero value, and a null list would not
+// validate.
+
+// TaskList is the output of list_all_tasks and find_tasks.
+type TaskList struct {
+	Tasks []Task `json:"tasks,omitempty"`
+}
+
+// UpcomingTasks is the open tasks list_upcoming_tasks found, by when
+// they are due, soonest first.
+type UpcomingTasks struct {
+	Today    string `json:"today" jsonschema:"today's date, YYYY-MM-DD"`
+	Days     int    `json:"days" jsonschema:"how many days after today upcoming covers"`
+	Overdue  []Task `json:"overdue,omitempty"`
+	DueToday []Task `json:"dueToday,omitempty"`
+	Upcoming []Task `json:"upcoming,omitempty"`
+}
+
+// TaskGroup is the tasks with one status, most urgent first.
+type TaskGroup struct {
+	Status string `json:"status"`
+	Tasks  []Task `json:"tasks"`
+}
+
+// TasksByStatus is the output of list_tasks_by_status.
+type TasksByStatus struct {
+	Total  int         `json:"total"`
+	Groups []TaskGroup `json:"groups,omitempty"`
+}
+
+// GraphList is the output of list_graphs and the logseq://graphs
+// resource.
+type GraphList struct {
+	Graphs []Graph `json:"graphs,omitempty"`
+}
+
+// PageList is the output of list_pages.
+type PageList struct {
+	Pages []Page `json:"pages,omitempty"`
+}
+
+// JournalList is the output of list_journals, most recent first.
+type JournalList struct {
+	Journals []Page `json:"journals,omitempty"`
+}
+
+// TagList is the output of list_tags.
+type TagList struct {
+	Tags []Tag `json:"tags,omitempty"`
+}
+
+// PropertyList is the output of list_properties.
+type PropertyList struct {
+	Properties []Property `json:"properties,omitempty"`
+}
+
+// CreatedBlock is the output of create_task and add_content.
+type CreatedBlock struct {
+	ID        int        `json:"id"`
+	UUID      string     `json:"uuid" jsonschema:"UUID of the new block, for use with update_task and complete_task"`
+	Content   string     `json:"content"`
+	Status    string     `json:"status,omitempty"`
+	Priority  string     `json:"priority,omitempty"`
+	Deadline  *time.Time `json:"deadline,omitempty"`
+	Scheduled *time.Time `json:"scheduled,omitempty"`
+	Repeat    string     `json:"repeat,omitempty"`
+	Parent    string     `json:"parent,omitempty" jsonschema:"UUID of the parent block, empty for top-level blocks"`
+}
+
+// JournalEntry is the output of append_to_journal.
+type JournalEntry struct {
+	ID          int    `json:"id"`
+	UUID        string `json:"uuid"`
+	Content     string `json:"content"`
+	Date        string `json:"date" jsonschema:"the journal's day, YYYY-MM-DD"`
+	Page        string `json:"page" jsonschema:"title of the journal page"`
+	PageCreated bool   `json:"pageCreated,omitempty" jsonschema:"whether the journal page was created for this entry"`
+}
+
+// TaskUpdate is the output of update_task and complete_task. Only the
+// fields that changed are set. Completing a repeating task sets Status
+// back to Todo and moves its deadline or scheduled date on.
+type TaskUpdate struct {
+	UUID      string     `json:"uuid"`
+	Status    string     `json:"status,omitempty"`
+	Content   string     `json:"content,omitempty"`
+	Deadline  *time.Time `json:"deadline,omitempty"`
+	Scheduled *time.Time `json:"scheduled,omitempty"`
+	Repeat    string     `json:"repeat,omitempty"`
+	Cleared   []string   `json:"cleared,omitempty" jsonschema:"deadline, scheduled or repeat when update_task removed them"`
+}
+
+// BlockChange is the output of move_block, delete_block, indent_block and
+// outdent_block.
+type BlockChange struct {
+	UUID      string `json:"uuid"`
+	Action    string `json:"action" jsonschema:"moved, deleted, indented or outdented"`
+	Target    string `json:"target,omitempty"`
+	Position  string `json:"position,omitempty"`
+	Recursive bool   `json:"recursive,omitempty" jsonschema:"whether the block's children were deleted with it"`
+}
+
+// PageChange is the output of create_page, rename_page, delete_page and
+// set_page_property.
+type PageChange struct {
+	UUID         string `json:"uuid,omitempty"`
+	Title        string `json:"title"`
+	Action       string `json:"action" jsonschema:"created, renamed, deleted, property-set, or confirm-delete when delete_page needs confirming"`
+	OldTitle     string `json:"oldTitle,omitempty"`
+	Property     string `json:"property,omitempty"`
+	Value        string `json:"value,omitempty"`
+	Blocks       int    `json:"blocks,omitempty" jsonschema:"blocks created, or blocks that deleting the page deletes"`
+	References   int    `json:"references,omitempty" jsonschema:"blocks elsewhere that link to the page"`
+	ConfirmToken string `json:"confirmToken,omitempty" jsonschema:"pass as confirm to delete_page to delete the page"`
+}
+
+// PropertyChange is the output of set_block_property and
+// remove_block_property.
+type PropertyChange struct {
+	UUID     string   `json:"uuid"`
+	Property string   `json:"property" jsonschema:"the property's :db/ident, or its name for a property set_block_property created"`
+	Title    string   `json:"title"`
+	Action   string   `json:"action" jsonschema:"set, removed or unchanged"`
+	Values   []string `json:"values,omitempty" jsonschema:"the values set, as Logseq shows them"`
+}
+
+// Error codes shared by the scripts' JSON error objects and the native
+// backends.
+const (
+	errCodeGraphNotFound   = "graph-not-found"
+	errCodePageNotFound    = "page-not-found"
+	errCodeBlockNotFound   = "block-not-found"
+	errCodeInvalidArgument = "invalid-argument"
+	// errCodeReadOnly refuses a write to a read-only graph. Only the Go
+	// side reports it.
+	errCodeReadOnly = "read-only"
+)
+
+// BackendError is an error a backend reports deliberately, as opposed to
+// a crash. Scripts print it as {"error": {"code": ..., "message": ...}}.
+type BackendError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *BackendError) Error() string {
+	return e.Message
+}
+
+// readOnlyError refuses a write to graph.
+func readOnlyError(graph string) error {
+	return &BackendError{Code: errCodeReadOnly, Message: "Graph " + graph + " is read-only"}
+}
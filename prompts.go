@@ -0,0 +1,262 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// Prompts gather what a daily or weekly ritual needs from a graph, the
+// journal and the tasks that are in progress, due or done, into one user
+// message, so that a client does not have to call the tools first. Tasks
+// are done when their status is Done; the day they were completed is the
+// day they were last updated.
+
+// staleDays is how long a task can stay Doing without an update before
+// weekly_review calls it stale, and how far back it looks for done tasks.
+const staleDays = 7
+
+func registerPrompts(mcpServer *MCPServer) {
+	mcpServer.server.AddPrompt(
+		&mcp.Prompt{
+			Name:        "daily_plan",
+			Title:       "Daily plan",
+			Description: "Plan a day from its journal page, the tasks in progress or to do and those overdue or due that day",
+			Arguments:   mcpServer.promptArguments("The day to plan"),
+		},
+		mcpServer.dailyPlan,
+	)
+	mcpServer.server.AddPrompt(
+		&mcp.Prompt{
+			Name:        "weekly_review",
+			Title:       "Weekly review",
+			Description: fmt.Sprintf("Review the %d days up to a day: the tasks done, by page, and the tasks still Doing that have not been updated since", staleDays),
+			Arguments:   mcpServer.promptArguments("The last day of the week to review"),
+		},
+		mcpServer.weeklyReview,
+	)
+	mcpServer.server.AddPrompt(
+		&mcp.Prompt{
+			Name:        "standup",
+			Title:       "Standup notes",
+			Description: "Write standup notes: the tasks done the day before, and the plan for the day from its journal and open tasks",
+			Arguments:   mcpServer.promptArguments("The day of the standup"),
+		},
+		mcpServer.standup,
+	)
+}
+
+// promptArguments are the arguments every prompt takes: the graph, required
+// unless a default graph is configured, and the day.
+func (m *MCPServer) promptArguments(date string) []*mcp.PromptArgument {
+	return []*mcp.PromptArgument{
+		{
+			Name:        "graph",
+			Description: m.graphDescription(),
+			Required:    m.cfg.DefaultGraph == "",
+		},
+		{
+			Name:        "date",
+			Description: date + " (default: today)" + journalDateHelp,
+		},
+	}
+}
+
+// promptContext is what every prompt starts from: the graph, the day and
+// its tasks.
+type promptContext struct {
+	graph string
+	day   time.Time
+	tasks []Task
+}
+
+// loadPromptContext resolves and checks the graph of a prompt request,
+// parses its date and loads the graph's tasks.
+func (m *MCPServer) loadPromptContext(ctx context.Context, req *mcp.GetPromptRequest) (*promptContext, error) {
+	args := req.Params.Arguments
+	graph, err := m.cfg.resolveGraph(args["graph"])
+	if err != nil {
+		return nil, err
+	}
+	if err := m.checkGraph(ctx, graph); err != nil {
+		return nil, err
+	}
+	day, err := parseJournalDate(args["date"], time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("date: %w", err)
+	}
+	tasks, err := m.backend.ListTasks(ctx, graph)
+	if err != nil {
+		return nil, err
+	}
+	return &promptContext{graph: graph, day: day, tasks: tasks}, nil
+}
+
+// promptResult returns text as the one user message of a prompt.
+func promptResult(description, text string) *mcp.GetPromptResult {
+	return &mcp.GetPromptResult{
+		Description: description,
+		Messages: []*mcp.PromptMessage{
+			{Role: "user", Content: &mcp.TextContent{Text: text}},
+		},
+	}
+}
+
+func (m *MCPServer) dailyPlan(ctx context.Context, req *mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+	p, err := m.loadPromptContext(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	journal, err := m.journalOutline(ctx, p.graph, p.day)
+	if err != nil {
+		return nil, err
+	}
+	due := upcomingTasks(p.tasks, p.day, 0)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Help me plan %s in my Logseq graph %q. ", p.day.Format("Monday, January 2, 2006"), p.graph)
+	sb.WriteString("Suggest what to focus on first and in what order, keeping the day realistic, and point out anything overdue that should be done, rescheduled or dropped. ")
+	sb.WriteString("Here is my journal for the day and my open tasks.\n")
+	writePromptSection(&sb, "Journal for "+p.day.Format(time.DateOnly), journal)
+	writeTaskSection(&sb, "Overdue", due.Overdue)
+	writeTaskSection(&sb, "Due today", due.DueToday)
+	listed := slices.Concat(due.Overdue, due.DueToday)
+	writeTaskSection(&sb, "Doing", tasksExcept(tasksWithStatus(p.tasks, "Doing"), listed))
+	writeTaskSection(&sb, "Todo", tasksExcept(tasksWithStatus(p.tasks, "Todo"), listed))
+	return promptResult("Daily plan for "+p.day.Format(time.DateOnly), sb.String()), nil
+}
+
+func (m *MCPServer) weeklyReview(ctx context.Context, req *mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+	p, err := m.loadPromptContext(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	start := p.day.AddDate(0, 0, 1-staleDays)
+	end := p.day.AddDate(0, 0, 1)
+	done := tasksUpdated(tasksWithStatus(p.tasks, "Done"), start, end)
+	var stale []Task
+	for _, t := range tasksWithStatus(p.tasks, "Doing") {
+		if t.UpdatedAt == nil || t.UpdatedAt.Before(start) {
+			stale = append(stale, t)
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Help me write my weekly review for %s to %s from my Logseq graph %q. ", start.Format(time.DateOnly), p.day.Format(time.DateOnly), p.graph)
+	sb.WriteString("Summarize what got done, by project, call out the tasks that have stalled and suggest whether to push on, break down or drop each, and propose priorities for next week.\n")
+	writePromptSection(&sb, fmt.Sprintf("Done (%d)", len(done)), markdownTasksByPage(done))
+	writeTaskSection(&sb, fmt.Sprintf("Doing, not updated since %s", start.Format(time.DateOnly)), stale)
+	return promptResult(fmt.Sprintf("Weekly review for %s to %s", start.Format(time.DateOnly), p.day.Format(time.DateOnly)), sb.String()), nil
+}
+
+func (m *MCPServer) standup(ctx context.Context, req *mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+	p, err := m.loadPromptContext(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	yesterday := p.day.AddDate(0, 0, -1)
+	done := tasksUpdated(tasksWithStatus(p.tasks, "Done"), yesterday, p.day)
+	journal, err := m.journalOutline(ctx, p.graph, p.day)
+	if err != nil {
+		return nil, err
+	}
+	due := upcomingTasks(p.tasks, p.day, 0)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Write my standup notes for %s from my Logseq graph %q, ", p.day.Format("Monday, January 2, 2006"), p.graph)
+	sb.WriteString("as three short bullet lists: what I did yesterday, what I am doing today, and anything blocking me. Keep each item to one line.\n")
+	writeTaskSection(&sb, "Done yesterday ("+yesterday.Format(time.DateOnly)+")", done)
+	writePromptSection(&sb, "Journal for today", journal)
+	writeTaskSection(&sb, "Doing", tasksWithStatus(p.tasks, "Doing"))
+	writeTaskSection(&sb, "Overdue or due today", slices.Concat(due.Overdue, due.DueToday))
+	return promptResult("Standup notes for "+p.day.Format(time.DateOnly), sb.String()), nil
+}
+
+// journalOutline returns the blocks of day's journal page as a markdown
+// outline, or "" if there is no journal page for day.
+func (m *MCPServer) journalOutline(ctx context.Context, graph string, day time.Time) (string, error) {
+	n := int(journalDay(day))
+	journals, err := m.backend.ListJournals(ctx, graph, n, n)
+	if err != nil || len(journals) == 0 {
+		return "", err
+	}
+	tree, err := m.backend.GetBlockTree(ctx, graph, journals[0].UUID)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	writeBlockNodes(&sb, tree.Blocks, 0)
+	return sb.String(), nil
+}
+
+// tasksWithStatus returns the tasks with status, most urgent first.
+func tasksWithStatus(tasks []Task, status string) []Task {
+	_, grouped := groupTasksByStatus(tasks)
+	return grouped[status]
+}
+
+// tasksExcept returns the tasks that are not in exclude.
+func tasksExcept(tasks, exclude []Task) []Task {
+	return slices.DeleteFunc(slices.Clone(tasks), func(t Task) bool {
+		return slices.ContainsFunc(exclude, func(e Task) bool { return e.UUID == t.UUID })
+	})
+}
+
+// tasksUpdated returns the tasks last updated in [start, end).
+func tasksUpdated(tasks []Task, start, end time.Time) []Task {
+	var out []Task
+	for _, t := range tasks {
+		if t.UpdatedAt != nil && !t.UpdatedAt.Before(start) && t.UpdatedAt.Before(end) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// markdownTasksByPage renders tasks as a list under a heading per page,
+// pages in alphabetical order.
+func markdownTasksByPage(tasks []Task) string {
+	byPage := make(map[string][]Task)
+	for _, t := range tasks {
+		byPage[t.Page] = append(byPage[t.Page], t)
+	}
+	pages := make([]string, 0, len(byPage))
+	for page := range byPage {
+		pages = append(pages, page)
+	}
+	slices.SortFunc(pages, func(a, b string) int {
+		return cmp.Compare(strings.ToLower(a), strings.ToLower(b))
+	})
+	var sb strings.Builder
+	for _, page := range pages {
+		fmt.Fprintf(&sb, "### [[%s]]\n\n", cmp.Or(page, "No page"))
+		for _, t := range byPage[page] {
+			fmt.Fprintf(&sb, "- %s\n", t.Title)
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// writePromptSection adds a section to a prompt, saying so when it is
+// empty.
+func writePromptSection(sb *strings.Builder, heading, body string) {
+	fmt.Fprintf(sb, "\n## %s\n\n", heading)
+	if body = strings.TrimSpace(body); body == "" {
+		body = "None."
+	}
+	sb.WriteString(body + "\n")
+}
+
+func writeTaskSection(sb *strings.Builder, heading string, tasks []Task) {
+	var lines strings.Builder
+	for _, t := range tasks {
+		fmt.Fprintf(&lines, "- %s\n", taskLine(t))
+	}
+	writePromptSection(sb, heading, lines.String())
+}
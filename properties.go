@@ -0,0 +1,307 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/slimslenderslacks/mcp-logseq/graphdb"
+)
+
+// Property values are checked against the property's schema, the type,
+// cardinality, closed values and classes list_properties reports, before
+// anything is written. References to pages, blocks and journal days are
+// resolved to entity ids here so that every backend stores what Logseq
+// would.
+
+// settableTypes are the property types a value can be given for. The
+// others (entity, class, map, ...) only hold what Logseq itself writes.
+var settableTypes = []string{"default", "string", "number", "url", "checkbox", "date", "datetime", "node"}
+
+// propertyUpdate is a value checked against a property. Values holds what
+// to store: text, numbers and booleans as is, datetimes as millisecond
+// timestamps and references as entity ids. Text holds the values as
+// Logseq shows them.
+type propertyUpdate struct {
+	// prop is nil for a property the graph does not have yet; writing the
+	// value creates it as a text property named key.
+	prop   *graphdb.Entity
+	key    string
+	title  string
+	many   bool
+	ref    bool
+	values []any
+	text   []string
+}
+
+// value is what to pass the HTTP API: the single value of a
+// cardinality-one property or the list of a cardinality-many one.
+func (u *propertyUpdate) value() any {
+	if u.many {
+		return u.values
+	}
+	return u.values[0]
+}
+
+// change describes setting u on the block with the given UUID.
+func (u *propertyUpdate) change(uuid string) *PropertyChange {
+	return &PropertyChange{UUID: uuid, Property: u.key, Title: u.title, Action: "set", Values: u.text}
+}
+
+// findProperty looks a property up by :db/ident or title.
+func findProperty(db *graphdb.DB, key string) *graphdb.Entity {
+	for _, p := range db.Properties() {
+		if p.Ident() == key || strings.EqualFold(p.Title(), key) {
+			return p
+		}
+	}
+	return nil
+}
+
+// settableProperty looks up the property named key and checks that a
+// value may be given for it. Built-in properties must be ones Logseq
+// shows. A key no property has returns nil, for a new user property.
+func settableProperty(db *graphdb.DB, key string) (*graphdb.Entity, error) {
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return nil, &BackendError{Code: errCodeInvalidArgument, Message: "property name is required"}
+	}
+	prop := findProperty(db, key)
+	if prop == nil {
+		return nil, nil
+	}
+	if strings.HasPrefix(prop.Ident(), "logseq.") && !prop.Bool("logseq.property/public?") {
+		return nil, &BackendError{Code: errCodeInvalidArgument, Message: fmt.Sprintf("%s is an internal Logseq property and cannot be set", prop.Ident())}
+	}
+	if typ := propertyType(prop); !slices.Contains(settableTypes, typ) {
+		return nil, &BackendError{Code: errCodeInvalidArgument, Message: fmt.Sprintf("%s has type %s, which cannot be set (settable types: %s)", prop.Ident(), typ, strings.Join(settableTypes, ", "))}
+	}
+	return prop, nil
+}
+
+// removableProperty looks up the property named key to remove it from a
+// block.
+func removableProperty(db *graphdb.DB, key string) (*graphdb.Entity, error) {
+	prop, err := settableProperty(db, key)
+	if err != nil {
+		return nil, err
+	}
+	if prop == nil {
+		return nil, &BackendError{Code: errCodeInvalidArgument, Message: "Unknown property " + key}
+	}
+	return prop, nil
+}
+
+// resolvePropertyValue checks value, a string, number, boolean or list of
+// them as decoded from JSON, against the property named key.
+func resolvePropertyValue(db *graphdb.DB, key string, value any) (*propertyUpdate, error) {
+	prop, err := settableProperty(db, key)
+	if err != nil {
+		return nil, err
+	}
+	inputs, err := propertyInputs(value)
+	if err != nil {
+		return nil, err
+	}
+
+	if prop == nil {
+		if len(inputs) > 1 {
+			return nil, &BackendError{Code: errCodeInvalidArgument, Message: fmt.Sprintf("%s is a new property and takes a single value; create it in Logseq to give it several", key)}
+		}
+		text := fmt.Sprint(inputs[0])
+		key = strings.TrimSpace(key)
+		return &propertyUpdate{key: key, title: key, values: []any{text}, text: []string{text}}, nil
+	}
+
+	u := &propertyUpdate{
+		prop:  prop,
+		key:   prop.Ident(),
+		title: prop.Title(),
+		many:  prop.String("db/cardinality") == "db.cardinality/many",
+	}
+	if !u.many && len(inputs) > 1 {
+		return nil, &BackendError{Code: errCodeInvalidArgument, Message: fmt.Sprintf("%s takes a single value, got %d", u.key, len(inputs))}
+	}
+	typ := propertyType(prop)
+	u.ref = typ == "date" || typ == "node" || len(closedValues(prop)) > 0
+	for _, in := range inputs {
+		v, text, err := convertPropertyValue(db, prop, typ, in)
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(u.values, v) {
+			u.values = append(u.values, v)
+			u.text = append(u.text, text)
+		}
+	}
+	return u, nil
+}
+
+// propertyInputs flattens a JSON value into the values it gives.
+func propertyInputs(value any) ([]any, error) {
+	values, ok := value.([]any)
+	if !ok {
+		values = []any{value}
+	}
+	for _, v := range values {
+		switch v := v.(type) {
+		case string:
+			if strings.TrimSpace(v) == "" {
+				return nil, &BackendError{Code: errCodeInvalidArgument, Message: "property values must not be empty"}
+			}
+		case float64, bool:
+		default:
+			return nil, &BackendError{Code: errCodeInvalidArgument, Message: fmt.Sprintf("property values must be strings, numbers or booleans, got %v", v)}
+		}
+	}
+	if len(values) == 0 {
+		return nil, &BackendError{Code: errCodeInvalidArgument, Message: "value is required"}
+	}
+	return values, nil
+}
+
+// convertPropertyValue converts one input for prop, of type typ, to the
+// value to store and its text.
+func convertPropertyValue(db *graphdb.DB, prop *graphdb.Entity, typ string, in any) (any, string, error) {
+	invalid := func(format string, args ...any) (any, string, error) {
+		return nil, "", &BackendError{Code: errCodeInvalidArgument, Message: fmt.Sprintf("Invalid value %v for %s: ", in, prop.Ident()) + fmt.Sprintf(format, args...)}
+	}
+	s := strings.TrimSpace(fmt.Sprint(in))
+
+	if choices := closedValues(prop); len(choices) > 0 {
+		var titles []string
+		for _, c := range choices {
+			if strings.EqualFold(c.Title(), s) {
+				return c.ID, c.Title(), nil
+			}
+			titles = append(titles, c.Title())
+		}
+		return invalid("expected one of %s", strings.Join(titles, ", "))
+	}
+
+	switch typ {
+	case "number":
+		n, ok := in.(float64)
+		if !ok {
+			var err error
+			if n, err = strconv.ParseFloat(s, 64); err != nil {
+				return invalid("expected a number")
+			}
+		}
+		return n, strconv.FormatFloat(n, 'f', -1, 64), nil
+	case "checkbox":
+		b, ok := in.(bool)
+		if !ok {
+			var err error
+			if b, err = strconv.ParseBool(s); err != nil {
+				return invalid("expected true or false")
+			}
+		}
+		return b, strconv.FormatBool(b), nil
+	case "url":
+		u, err := url.Parse(s)
+		if err != nil || u.Scheme == "" || (u.Host == "" && u.Opaque == "") {
+			return invalid("expected an absolute URL")
+		}
+		return s, s, nil
+	case "datetime":
+		t, err := parsePropertyTime(in)
+		if err != nil {
+			return invalid("expected an RFC 3339 time or a YYYY-MM-DD date")
+		}
+		return t.UnixMilli(), formatTime(&t), nil
+	case "date":
+		day, err := time.ParseInLocation("2006-01-02", s, time.Local)
+		if err != nil {
+			return invalid("expected a YYYY-MM-DD date")
+		}
+		journal := findJournal(db, day)
+		if journal == nil {
+			return invalid("there is no journal page for %s", s)
+		}
+		return journal.ID, journal.Title(), nil
+	case "node":
+		node, err := resolveNode(db, prop, s)
+		if err != nil {
+			return invalid("%v", err)
+		}
+		return node.ID, node.Title(), nil
+	}
+	return s, s, nil
+}
+
+// parsePropertyTime reads a datetime given as RFC 3339, as a local date
+// and time without seconds or zone, as a local date, or as a millisecond
+// timestamp.
+func parsePropertyTime(in any) (time.Time, error) {
+	if ms, ok := in.(float64); ok {
+		return time.UnixMilli(int64(ms)), nil
+	}
+	s := strings.TrimSpace(fmt.Sprint(in))
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("cannot parse time %q", s)
+}
+
+// resolveNode finds the page named or identified by s, or the block with
+// UUID s, for a node property. A property limited to classes only takes
+// nodes tagged with one of them or a class extending one.
+func resolveNode(db *graphdb.DB, prop *graphdb.Entity, s string) (*graphdb.Entity, error) {
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "[["), "]]")
+	node := db.FindPage(s)
+	if node == nil && isUUID(s) {
+		node = db.ByUUID(s)
+	}
+	if node == nil {
+		if isUUID(s) {
+			return nil, fmt.Errorf("block not found")
+		}
+		return nil, fmt.Errorf("page not found")
+	}
+
+	classes := prop.Refs("logseq.property/classes")
+	if len(classes) == 0 {
+		return node, nil
+	}
+	for _, tag := range node.Refs("block/tags") {
+		for _, class := range classes {
+			if extendsClass(tag, class, nil) {
+				return node, nil
+			}
+		}
+	}
+	var titles []string
+	for _, class := range classes {
+		titles = append(titles, class.Title())
+	}
+	return nil, fmt.Errorf("%s is not tagged with %s", node.Title(), strings.Join(titles, " or "))
+}
+
+// extendsClass reports whether tag is class or extends it.
+func extendsClass(tag, class *graphdb.Entity, seen map[int64]bool) bool {
+	if tag.ID == class.ID {
+		return true
+	}
+	if seen == nil {
+		seen = make(map[int64]bool)
+	}
+	if seen[tag.ID] {
+		return false
+	}
+	seen[tag.ID] = true
+	for _, parent := range tag.Refs("logseq.property.class/extends") {
+		if extendsClass(parent, class, seen) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,449 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The functions in this file render backend results as the text the tools
+// return. They follow the layout the scripts print without --json.
+
+func formatTime(t *time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+func writeTask(sb *strings.Builder, t Task) {
+	fmt.Fprintf(sb, "Task ID: %d\n", t.ID)
+	fmt.Fprintf(sb, "  UUID: %s\n", t.UUID)
+	fmt.Fprintf(sb, "  Title: %s\n", t.Title)
+	fmt.Fprintf(sb, "  Status: %s\n", t.Status)
+	fmt.Fprintf(sb, "  Priority: %s\n", t.Priority)
+	if t.Page != "" {
+		fmt.Fprintf(sb, "  Page: %s\n", t.Page)
+	}
+	if t.Deadline != nil {
+		fmt.Fprintf(sb, "  Deadline: %s\n", formatTime(t.Deadline))
+	}
+	if t.Scheduled != nil {
+		fmt.Fprintf(sb, "  Scheduled: %s\n", formatTime(t.Scheduled))
+	}
+	if t.Repeat != "" {
+		fmt.Fprintf(sb, "  Repeat: %s\n", t.Repeat)
+	}
+	sb.WriteString("\n")
+}
+
+func formatTasks(tasks []Task) string {
+	var sb strings.Builder
+	sb.WriteString("\n=== All Tasks ===\n\n")
+	for _, t := range tasks {
+		writeTask(&sb, t)
+	}
+	return sb.String()
+}
+
+func formatUpcomingTasks(upcoming *UpcomingTasks) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "\n=== Upcoming Tasks ===\nToday: %s\n", upcoming.Today)
+	for _, section := range []struct {
+		title string
+		tasks []Task
+	}{
+		{"Overdue", upcoming.Overdue},
+		{"Due Today", upcoming.DueToday},
+		{fmt.Sprintf("Due in the Next %d Days", upcoming.Days), upcoming.Upcoming},
+	} {
+		fmt.Fprintf(&sb, "\n--- %s (%d) ---\n\n", section.title, len(section.tasks))
+		for _, t := range section.tasks {
+			writeTask(&sb, t)
+		}
+	}
+	return sb.String()
+}
+
+var priorityRank = map[string]int{"Urgent": 4, "High": 3, "Medium": 2, "Low": 1}
+
+// groupTasksByStatus returns the statuses in tasks in alphabetical order and
+// the tasks with each one, most urgent first.
+func groupTasksByStatus(tasks []Task) ([]string, map[string][]Task) {
+	grouped := make(map[string][]Task)
+	var statuses []string
+	for _, t := range tasks {
+		if _, ok := grouped[t.Status]; !ok {
+			statuses = append(statuses, t.Status)
+		}
+		grouped[t.Status] = append(grouped[t.Status], t)
+	}
+	sort.Strings(statuses)
+	for _, list := range grouped {
+		sort.SliceStable(list, func(i, j int) bool {
+			return priorityRank[list[i].Priority] > priorityRank[list[j].Priority]
+		})
+	}
+	return statuses, grouped
+}
+
+func tasksByStatus(tasks []Task) *TasksByStatus {
+	statuses, grouped := groupTasksByStatus(tasks)
+	out := &TasksByStatus{Total: len(tasks)}
+	for _, status := range statuses {
+		out.Groups = append(out.Groups, TaskGroup{Status: status, Tasks: grouped[status]})
+	}
+	return out
+}
+
+func formatTasksByStatus(tasks []Task) string {
+	statuses, grouped := groupTasksByStatus(tasks)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "\n=== Task Summary ===\nTotal tasks: %d\n\n", len(tasks))
+	for _, status := range statuses {
+		list := grouped[status]
+		fmt.Fprintf(&sb, "%s: %d\n", status, len(list))
+		for _, t := range list {
+			if t.Priority != "" {
+				fmt.Fprintf(&sb, "  [ %s ] %s\n", t.Priority, t.Title)
+			} else {
+				fmt.Fprintf(&sb, "   %s\n", t.Title)
+			}
+		}
+	}
+	return sb.String()
+}
+
+func formatFoundTasks(tasks []Task) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "\n=== Found Tasks ===\nTotal tasks: %d\n\n", len(tasks))
+	if len(tasks) == 0 {
+		sb.WriteString("No tasks match the given criteria.\n")
+	}
+	for _, t := range tasks {
+		writeTask(&sb, t)
+	}
+	return sb.String()
+}
+
+// taskSortFields are the values find_tasks accepts for sort.
+var taskSortFields = []string{"id", "title", "status", "priority", "page", "created", "updated", "deadline", "scheduled"}
+
+// sortTasks sorts tasks by field, keeping tasks without a value for it at
+// the end in either direction.
+func sortTasks(tasks []Task, field string, descending bool) {
+	slices.SortStableFunc(tasks, func(a, b Task) int {
+		aText, aNum, aok := taskSortKey(a, field)
+		bText, bNum, bok := taskSortKey(b, field)
+		if !aok || !bok {
+			return cmp.Compare(missingRank(aok), missingRank(bok))
+		}
+		c := cmp.Or(cmp.Compare(aNum, bNum), cmp.Compare(aText, bText))
+		if descending {
+			return -c
+		}
+		return c
+	})
+}
+
+// taskSortKey returns the text or number to sort t by, and false if t has
+// no value for field.
+func taskSortKey(t Task, field string) (string, int64, bool) {
+	timeKey := func(t *time.Time) (string, int64, bool) {
+		if t == nil {
+			return "", 0, false
+		}
+		return "", t.UnixMilli(), true
+	}
+	switch field {
+	case "title":
+		return strings.ToLower(t.Title), 0, true
+	case "status":
+		return t.Status, 0, t.Status != ""
+	case "priority":
+		return "", int64(priorityRank[t.Priority]), t.Priority != ""
+	case "page":
+		return strings.ToLower(t.Page), 0, t.Page != ""
+	case "created":
+		return timeKey(t.CreatedAt)
+	case "updated":
+		return timeKey(t.UpdatedAt)
+	case "deadline":
+		return timeKey(t.Deadline)
+	case "scheduled":
+		return timeKey(t.Scheduled)
+	}
+	return "", int64(t.ID), true
+}
+
+func missingRank(ok bool) int {
+	if ok {
+		return 0
+	}
+	return 1
+}
+
+func formatGraphs(graphs []Graph) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "\n=== All Graphs ===\nTotal graphs: %d\n\n", len(graphs))
+	for _, g := range graphs {
+		fmt.Fprintf(&sb, "Name: %s\n", g.Name)
+		if len(g.Aliases) > 0 {
+			fmt.Fprintf(&sb, "  Aliases: %s\n", strings.Join(g.Aliases, ", "))
+		}
+		if g.Error != "" {
+			fmt.Fprintf(&sb, "  Error: %s\n\n", g.Error)
+			continue
+		}
+		if g.ModifiedAt != nil {
+			fmt.Fprintf(&sb, "  Size: %d bytes\n", g.Size)
+			fmt.Fprintf(&sb, "  Modified At: %s\n", formatTime(g.ModifiedAt))
+		}
+		fmt.Fprintf(&sb, "  Pages: %d\n", g.Pages)
+		fmt.Fprintf(&sb, "  Blocks: %d\n", g.Blocks)
+		fmt.Fprintf(&sb, "  Tasks: %d\n", g.Tasks)
+		if g.Current {
+			sb.WriteString("  Current?: true\n")
+		}
+		if g.ReadOnly {
+			sb.WriteString("  Read-only?: true\n")
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+func formatPages(pages []Page, expand bool) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "\n=== All Pages ===\nTotal pages: %d\n\n", len(pages))
+	for _, page := range pages {
+		fmt.Fprintf(&sb, "Title: %s\n", page.Title)
+		fmt.Fprintf(&sb, "  UUID: %s\n", page.UUID)
+		if expand {
+			if page.CreatedAt != nil {
+				fmt.Fprintf(&sb, "  Created At: %s\n", formatTime(page.CreatedAt))
+			}
+			if page.UpdatedAt != nil {
+				fmt.Fprintf(&sb, "  Updated At: %s\n", formatTime(page.UpdatedAt))
+			}
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+func formatJournals(journals []Page) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "\n=== Journal Pages ===\nTotal journals: %d\n\n", len(journals))
+	if len(journals) == 0 {
+		sb.WriteString("No journal pages in this range.\n")
+	}
+	for _, j := range journals {
+		fmt.Fprintf(&sb, "Journal: %s\n", j.Title)
+		fmt.Fprintf(&sb, "  Date: %s\n", dayOfJournal(j.JournalDay).Format(time.DateOnly))
+		fmt.Fprintf(&sb, "  UUID: %s\n", j.UUID)
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+func formatPage(content *PageContent) string {
+	page := content.Page
+
+	var sb strings.Builder
+	sb.WriteString("\n=== Page Information ===\n")
+	fmt.Fprintf(&sb, "Title: %s\n", page.Title)
+	fmt.Fprintf(&sb, "Name: %s\n", page.Name)
+	fmt.Fprintf(&sb, "UUID: %s\n", page.UUID)
+	if page.CreatedAt != nil {
+		fmt.Fprintf(&sb, "Created At: %s\n", formatTime(page.CreatedAt))
+	}
+	if page.UpdatedAt != nil {
+		fmt.Fprintf(&sb, "Updated At: %s\n", formatTime(page.UpdatedAt))
+	}
+	if page.Journal {
+		sb.WriteString("Journal?: true\n")
+		if page.JournalDay != 0 {
+			fmt.Fprintf(&sb, "Journal Day: %d\n", page.JournalDay)
+		}
+	}
+	sb.WriteString("\n")
+
+	fmt.Fprintf(&sb, "=== Page Blocks ===\nTotal blocks: %d\n\n", len(content.Blocks))
+	for _, block := range content.Blocks {
+		fmt.Fprintf(&sb, "Block UUID: %s\n", block.UUID)
+		fmt.Fprintf(&sb, "  Title: %s\n", block.Title)
+		if block.Order != "" {
+			fmt.Fprintf(&sb, "  Order: %s\n", block.Order)
+		}
+		if block.Parent != "" {
+			fmt.Fprintf(&sb, "  Parent: %s\n", block.Parent)
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+func formatTags(tags []Tag, expand bool) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "\n=== All Tags ===\nTotal tags: %d\n\n", len(tags))
+	for _, tag := range tags {
+		fmt.Fprintf(&sb, "Title: %s\n", tag.Title)
+		fmt.Fprintf(&sb, "  UUID: %s\n", tag.UUID)
+		if expand {
+			if len(tag.Extends) > 0 {
+				fmt.Fprintf(&sb, "  Extends: %v\n", tag.Extends)
+			}
+			if len(tag.Properties) > 0 {
+				fmt.Fprintf(&sb, "  Tag Properties: %v\n", tag.Properties)
+			}
+			if tag.Description != "" {
+				fmt.Fprintf(&sb, "  Description: %s\n", tag.Description)
+			}
+			if tag.CreatedAt != nil {
+				fmt.Fprintf(&sb, "  Created At: %s\n", formatTime(tag.CreatedAt))
+			}
+			if tag.UpdatedAt != nil {
+				fmt.Fprintf(&sb, "  Updated At: %s\n", formatTime(tag.UpdatedAt))
+			}
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+func formatProperties(props []Property, expand bool) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "\n=== All Properties ===\nTotal properties: %d\n\n", len(props))
+	for _, prop := range props {
+		fmt.Fprintf(&sb, "Title: %s\n", prop.Title)
+		fmt.Fprintf(&sb, "  UUID: %s\n", prop.UUID)
+		if expand {
+			if prop.Type != "" {
+				fmt.Fprintf(&sb, "  Property Type: %s\n", prop.Type)
+			}
+			if len(prop.Classes) > 0 {
+				fmt.Fprintf(&sb, "  Classes: %v\n", prop.Classes)
+			}
+			if prop.Cardinality != "" {
+				fmt.Fprintf(&sb, "  Cardinality: %s\n", prop.Cardinality)
+			}
+			if prop.Description != "" {
+				fmt.Fprintf(&sb, "  Description: %s\n", prop.Description)
+			}
+			if prop.Public {
+				sb.WriteString("  Public?: true\n")
+			}
+			if len(prop.ClosedValues) > 0 {
+				fmt.Fprintf(&sb, "  Closed Values: %v\n", prop.ClosedValues)
+			}
+			if prop.CreatedAt != nil {
+				fmt.Fprintf(&sb, "  Created At: %s\n", formatTime(prop.CreatedAt))
+			}
+			if prop.UpdatedAt != nil {
+				fmt.Fprintf(&sb, "  Updated At: %s\n", formatTime(prop.UpdatedAt))
+			}
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// blockTreeFormats are the renderings get_block_tree offers.
+var blockTreeFormats = []string{"markdown", "json"}
+
+// formatBlockTree renders a block tree as a Logseq-style markdown outline,
+// properties as key:: value lines under their block, or as indented JSON.
+func formatBlockTree(tree *BlockTree, format string) string {
+	if format == "json" {
+		data, err := json.MarshalIndent(tree, "", "  ")
+		if err != nil {
+			return "Error: " + err.Error()
+		}
+		return string(data)
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# %s\n\n", tree.Page.Title)
+	writeBlockNodes(&sb, tree.Blocks, 0)
+	return sb.String()
+}
+
+func writeBlockNodes(sb *strings.Builder, blocks []BlockNode, level int) {
+	indent := strings.Repeat("  ", level)
+	for _, b := range blocks {
+		lines := strings.Split(b.Title, "\n")
+		fmt.Fprintf(sb, "%s- %s\n", indent, lines[0])
+		for _, line := range lines[1:] {
+			fmt.Fprintf(sb, "%s  %s\n", indent, line)
+		}
+		keys := slices.Sorted(maps.Keys(b.Properties))
+		for _, k := range keys {
+			fmt.Fprintf(sb, "%s  %s:: %s\n", indent, k, b.Properties[k])
+		}
+		if b.Collapsed {
+			fmt.Fprintf(sb, "%s  collapsed:: true\n", indent)
+		}
+		if b.Truncated {
+			fmt.Fprintf(sb, "%s  - …\n", indent)
+		}
+		writeBlockNodes(sb, b.Children, level+1)
+	}
+}
+
+func formatReferences(refs *References) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "\n=== References to %s ===\n", refs.Title)
+	fmt.Fprintf(&sb, "UUID: %s\n", refs.UUID)
+	writeReferenceGroups(&sb, "Linked References", refs.Linked)
+	writeReferenceGroups(&sb, "Tagged", refs.Tagged)
+	writeReferenceGroups(&sb, "Unlinked Mentions", refs.Unlinked)
+	return sb.String()
+}
+
+func writeReferenceGroups(sb *strings.Builder, heading string, groups []ReferenceGroup) {
+	total := 0
+	for _, g := range groups {
+		total += len(g.References)
+	}
+	fmt.Fprintf(sb, "\n=== %s ===\nTotal: %d\n", heading, total)
+	for _, g := range groups {
+		fmt.Fprintf(sb, "\nPage: %s\n", g.Page)
+		for _, r := range g.References {
+			fmt.Fprintf(sb, "  Block UUID: %s\n", r.UUID)
+			if len(r.Path) > 0 {
+				fmt.Fprintf(sb, "    Path: %s\n", strings.Join(r.Path, " > "))
+			}
+			fmt.Fprintf(sb, "    Title: %s\n", r.Title)
+		}
+	}
+}
+
+func formatSearchResults(results *SearchResults) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "\n=== Search Results for %q ===\n", results.Query)
+	if len(results.Results) == 0 {
+		fmt.Fprintf(&sb, "Total results: %d\n\nNo results.\n", results.Total)
+		return sb.String()
+	}
+	fmt.Fprintf(&sb, "Showing %d-%d of %d results\n\n", results.Offset+1, results.Offset+len(results.Results), results.Total)
+	for _, r := range results.Results {
+		if r.Kind == "page" {
+			fmt.Fprintf(&sb, "Page: %s\n", r.Title)
+		} else {
+			fmt.Fprintf(&sb, "Block on %s\n", r.Page)
+		}
+		fmt.Fprintf(&sb, "  UUID: %s\n", r.UUID)
+		if len(r.Path) > 0 {
+			fmt.Fprintf(&sb, "  Path: %s\n", strings.Join(r.Path, " > "))
+		}
+		fmt.Fprintf(&sb, "  Snippet: %s\n", r.Snippet)
+		fmt.Fprintf(&sb, "  Score: %.3f\n\n", r.Score)
+	}
+	if next := results.Offset + len(results.Results); next < results.Total {
+		fmt.Fprintf(&sb, "More results: use offset %d\n", next)
+	}
+	return sb.String()
+}
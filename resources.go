@@ -0,0 +1,422 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/jsonrpc"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// Resources are read through URI templates, one per kind, and each read
+// returns the resource as markdown and as JSON. resources/list adds every
+// graph's tasks, pages and journals to the registered resources, so clients
+// can offer them without knowing the templates.
+
+const (
+	resourceScheme = "logseq://"
+	graphsURI      = resourceScheme + "graphs"
+)
+
+// Resource kinds, by URI:
+//
+//	logseq://graphs                  the graphs
+//	logseq://{graph}/tasks           a graph's tasks
+//	logseq://{graph}/page/{name}     a page, by name or UUID, and its blocks
+//	logseq://{graph}/block/{uuid}    a block and its descendants
+//	logseq://{graph}/journal/{date}  the journal page of a day
+//	logseq://{graph}/tag/{name}      the blocks and pages tagged with a tag
+//
+// The graph, name and date are percent-encoded, "/" included.
+const (
+	resourceGraphs  = "graphs"
+	resourceTasks   = "tasks"
+	resourcePage    = "page"
+	resourceBlock   = "block"
+	resourceJournal = "journal"
+	resourceTag     = "tag"
+)
+
+// tagResourceTemplate is the URI template of tags, whose name argument
+// completes to tags rather than pages.
+const tagResourceTemplate = resourceScheme + "{graph}/tag/{name}"
+
+// keyedResources are the kinds whose URI ends in a key.
+var keyedResources = []string{resourcePage, resourceBlock, resourceJournal, resourceTag}
+
+var resourceTemplates = []*mcp.ResourceTemplate{
+	{
+		URITemplate: resourceScheme + "{graph}/tasks",
+		Name:        "Logseq Tasks",
+		Description: "All tasks in a graph, grouped by status",
+		MIMEType:    "text/markdown",
+	},
+	{
+		URITemplate: resourceScheme + "{graph}/page/{name}",
+		Name:        "Logseq Page",
+		Description: "A page, by lower-case name or UUID, as an outline of its blocks. A property and a tag are pages.",
+		MIMEType:    "text/markdown",
+	},
+	{
+		URITemplate: resourceScheme + "{graph}/block/{uuid}",
+		Name:        "Logseq Block",
+		Description: "A block and its descendants, by UUID",
+		MIMEType:    "text/markdown",
+	},
+	{
+		URITemplate: resourceScheme + "{graph}/journal/{date}",
+		Name:        "Logseq Journal",
+		Description: `The journal page of a day, as YYYY-MM-DD or a word like "today" or "yesterday"`,
+		MIMEType:    "text/markdown",
+	},
+	{
+		URITemplate: tagResourceTemplate,
+		Name:        "Logseq Tag",
+		Description: "The blocks and pages tagged with a tag, grouped by page",
+		MIMEType:    "text/markdown",
+	},
+}
+
+// resourcePageSize is how many resources a resources/list page holds.
+const resourcePageSize = 500
+
+// resourceRef is a parsed resource URI. Key is the page name, block UUID,
+// journal date or tag name.
+type resourceRef struct {
+	kind  string
+	graph string
+	key   string
+}
+
+// resourceURI returns the URI of a resource of graph. key is ignored for
+// the tasks.
+func resourceURI(graph, kind, key string) string {
+	uri := resourceScheme + escapeURIComponent(graph) + "/" + kind
+	if kind != resourceTasks {
+		uri += "/" + escapeURIComponent(key)
+	}
+	return uri
+}
+
+// escapeURIComponent percent-encodes everything but the unreserved
+// characters of RFC 3986, which is what URI template variables match.
+func escapeURIComponent(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("-._~", c) >= 0 {
+			sb.WriteByte(c)
+		} else {
+			fmt.Fprintf(&sb, "%%%02X", c)
+		}
+	}
+	return sb.String()
+}
+
+// parseResourceURI parses the URI of a resource the server can read.
+func parseResourceURI(uri string) (resourceRef, error) {
+	if uri == graphsURI {
+		return resourceRef{kind: resourceGraphs}, nil
+	}
+	rest, ok := strings.CutPrefix(uri, resourceScheme)
+	parts := strings.Split(rest, "/")
+	if !ok || len(parts) < 2 || parts[0] == "" {
+		return resourceRef{}, fmt.Errorf("unknown resource URI %q", uri)
+	}
+	kind := parts[1]
+	switch {
+	case kind == resourceTasks && len(parts) == 2:
+		parts = append(parts, "")
+	case slices.Contains(keyedResources, kind) && len(parts) == 3 && parts[2] != "":
+	default:
+		return resourceRef{}, fmt.Errorf("unknown resource URI %q", uri)
+	}
+	graph, err := url.PathUnescape(parts[0])
+	if err != nil {
+		return resourceRef{}, fmt.Errorf("invalid resource URI %q: %w", uri, err)
+	}
+	key, err := url.PathUnescape(parts[2])
+	if err != nil {
+		return resourceRef{}, fmt.Errorf("invalid resource URI %q: %w", uri, err)
+	}
+	return resourceRef{kind: kind, graph: graph, key: key}, nil
+}
+
+func registerResources(mcpServer *MCPServer) {
+	mcpServer.server.AddResource(
+		&mcp.Resource{
+			URI:         graphsURI,
+			Name:        "Logseq Graphs",
+			Description: "The graphs this server can read, with their size, last-modified time, page/block/task counts and whether each is open in the Logseq app",
+			MIMEType:    "application/json",
+		},
+		func(ctx context.Context, request *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+			graphs, err := mcpServer.listGraphs(ctx)
+			if err != nil {
+				return nil, err
+			}
+			jsonData, err := json.Marshal(GraphList{Graphs: graphs})
+			if err != nil {
+				return nil, err
+			}
+			return &mcp.ReadResourceResult{
+				Contents: []*mcp.ResourceContents{
+					{
+						URI:      graphsURI,
+						MIMEType: "application/json",
+						Text:     string(jsonData),
+					},
+				},
+			}, nil
+		},
+	)
+
+	for _, t := range resourceTemplates {
+		mcpServer.server.AddResourceTemplate(t, mcpServer.readResource)
+	}
+	mcpServer.server.AddReceivingMiddleware(mcpServer.listResources)
+}
+
+// readResource reads a resource of any of the templates.
+func (m *MCPServer) readResource(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+	uri := req.Params.URI
+	r, err := parseResourceURI(uri)
+	if err != nil {
+		return nil, mcp.ResourceNotFoundError(uri)
+	}
+	if r.graph, err = m.cfg.resolveGraph(r.graph); err != nil {
+		return nil, err
+	}
+	if err := m.checkGraph(ctx, r.graph); err != nil {
+		return nil, resourceError(uri, err)
+	}
+	markdown, value, err := m.resourceContent(ctx, r)
+	if err != nil {
+		return nil, resourceError(uri, err)
+	}
+	jsonData, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return &mcp.ReadResourceResult{
+		Contents: []*mcp.ResourceContents{
+			{URI: uri, MIMEType: "text/markdown", Text: markdown},
+			{URI: uri, MIMEType: "application/json", Text: string(jsonData)},
+		},
+	}, nil
+}
+
+// resourceContent reads the resource r of a resolved graph, rendered as
+// markdown and as the value its JSON holds.
+func (m *MCPServer) resourceContent(ctx context.Context, r resourceRef) (string, any, error) {
+	switch r.kind {
+	case resourceTasks:
+		tasks, err := m.backend.ListTasks(ctx, r.graph)
+		if err != nil {
+			return "", nil, err
+		}
+		return markdownTasks(tasks), &TaskList{Tasks: tasks}, nil
+	case resourceJournal:
+		day, err := parseJournalDate(r.key, time.Now())
+		if err != nil {
+			return "", nil, &BackendError{Code: errCodePageNotFound, Message: "Invalid journal date: " + r.key}
+		}
+		n := int(journalDay(day))
+		journals, err := m.backend.ListJournals(ctx, r.graph, n, n)
+		if err != nil {
+			return "", nil, err
+		}
+		if len(journals) == 0 {
+			return "", nil, &BackendError{Code: errCodePageNotFound, Message: "No journal page for " + day.Format(time.DateOnly)}
+		}
+		r.key = journals[0].UUID
+		fallthrough
+	case resourcePage, resourceBlock:
+		tree, err := m.backend.GetBlockTree(ctx, r.graph, r.key)
+		if err != nil {
+			return "", nil, err
+		}
+		return formatBlockTree(tree, "markdown"), tree, nil
+	case resourceTag:
+		refs, err := m.backend.GetReferences(ctx, r.graph, strings.TrimPrefix(r.key, "#"))
+		if err != nil {
+			return "", nil, err
+		}
+		refs.Linked, refs.Unlinked = nil, nil
+		return markdownTagged(refs), refs, nil
+	}
+	return "", nil, fmt.Errorf("unknown resource kind %q", r.kind)
+}
+
+// resourceError reports a missing graph, page or block as the resource not
+// being found.
+func resourceError(uri string, err error) error {
+	var backendErr *BackendError
+	if errors.As(err, &backendErr) {
+		switch backendErr.Code {
+		case errCodeGraphNotFound, errCodePageNotFound, errCodeBlockNotFound:
+			return mcp.ResourceNotFoundError(uri)
+		}
+	}
+	return err
+}
+
+// listResources answers resources/list with the registered resources
+// followed by the resources of every graph, resourcePageSize at a time.
+// The cursor is the offset of the next page.
+func (m *MCPServer) listResources(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		list, ok := req.(*mcp.ListResourcesRequest)
+		if !ok {
+			return next(ctx, method, req)
+		}
+		offset := 0
+		if list.Params != nil && list.Params.Cursor != "" {
+			n, err := strconv.Atoi(list.Params.Cursor)
+			if err != nil || n < 0 {
+				return nil, &jsonrpc.Error{Code: jsonrpc.CodeInvalidParams, Message: "invalid cursor"}
+			}
+			offset = n
+		}
+		res, err := next(ctx, method, &mcp.ListResourcesRequest{Session: list.Session, Params: &mcp.ListResourcesParams{}})
+		if err != nil {
+			return nil, err
+		}
+		resources := slices.Concat(res.(*mcp.ListResourcesResult).Resources, m.graphResources(ctx))
+		offset = min(offset, len(resources))
+		out := &mcp.ListResourcesResult{Resources: resources[offset:]}
+		if len(out.Resources) > resourcePageSize {
+			out.Resources = out.Resources[:resourcePageSize]
+			out.NextCursor = strconv.Itoa(offset + resourcePageSize)
+		}
+		return out, nil
+	}
+}
+
+// graphResources lists the tasks, journals and other pages of every graph.
+// A graph that cannot be read is left out.
+func (m *MCPServer) graphResources(ctx context.Context) []*mcp.Resource {
+	names, err := m.backend.ListGraphs(ctx)
+	if err != nil {
+		log.Printf("Listing resources: %v", err)
+		return nil
+	}
+	var resources []*mcp.Resource
+	for _, graph := range names {
+		pages, err := m.backend.ListPages(ctx, graph, true)
+		if err != nil {
+			log.Printf("Listing resources of %s: %v", graph, err)
+			continue
+		}
+		journals, err := m.backend.ListJournals(ctx, graph, 0, 0)
+		if err != nil {
+			log.Printf("Listing resources of %s: %v", graph, err)
+			continue
+		}
+		resources = append(resources, &mcp.Resource{
+			URI:         resourceURI(graph, resourceTasks, ""),
+			Name:        graph + " tasks",
+			Title:       "Tasks in " + graph,
+			Description: fmt.Sprintf("All tasks in the %s graph", graph),
+			MIMEType:    "text/markdown",
+		})
+		isJournal := make(map[string]bool, len(journals))
+		for _, j := range journals {
+			isJournal[j.UUID] = true
+			date := dayOfJournal(j.JournalDay).Format(time.DateOnly)
+			resources = append(resources, &mcp.Resource{
+				URI:         resourceURI(graph, resourceJournal, date),
+				Name:        date,
+				Title:       j.Title,
+				Description: fmt.Sprintf("Journal in the %s graph", graph),
+				MIMEType:    "text/markdown",
+				Annotations: lastModified(j.UpdatedAt),
+			})
+		}
+		for _, p := range pages {
+			if isJournal[p.UUID] {
+				continue
+			}
+			name := cmp.Or(p.Name, strings.ToLower(p.Title))
+			resources = append(resources, &mcp.Resource{
+				URI:         resourceURI(graph, resourcePage, name),
+				Name:        name,
+				Title:       p.Title,
+				Description: fmt.Sprintf("Page in the %s graph", graph),
+				MIMEType:    "text/markdown",
+				Annotations: lastModified(p.UpdatedAt),
+			})
+		}
+	}
+	return resources
+}
+
+func lastModified(t *time.Time) *mcp.Annotations {
+	if t == nil {
+		return nil
+	}
+	return &mcp.Annotations{LastModified: formatTime(t)}
+}
+
+// markdownTasks renders tasks as a list under a heading per status.
+func markdownTasks(tasks []Task) string {
+	statuses, grouped := groupTasksByStatus(tasks)
+	var sb strings.Builder
+	sb.WriteString("# Tasks\n")
+	for _, status := range statuses {
+		fmt.Fprintf(&sb, "\n## %s\n\n", status)
+		for _, t := range grouped[status] {
+			fmt.Fprintf(&sb, "- %s\n", taskLine(t))
+		}
+	}
+	return sb.String()
+}
+
+// taskLine renders a task as one line of markdown: its title, priority,
+// dates, recurrence and page.
+func taskLine(t Task) string {
+	details := []string{t.Title}
+	if t.Priority != "" {
+		details = append(details, "priority "+t.Priority)
+	}
+	if t.Deadline != nil {
+		details = append(details, "deadline "+t.Deadline.Format(time.DateOnly))
+	}
+	if t.Scheduled != nil {
+		details = append(details, "scheduled "+t.Scheduled.Format(time.DateOnly))
+	}
+	if t.Repeat != "" {
+		details = append(details, "repeats "+t.Repeat)
+	}
+	if t.Page != "" {
+		details = append(details, "[["+t.Page+"]]")
+	}
+	return strings.Join(details, " · ")
+}
+
+// markdownTagged renders what is tagged with a tag as a list under a
+// heading per page.
+func markdownTagged(refs *References) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# #%s\n", refs.Title)
+	for _, g := range refs.Tagged {
+		fmt.Fprintf(&sb, "\n## [[%s]]\n\n", g.Page)
+		for _, r := range g.References {
+			if len(r.Path) > 0 {
+				fmt.Fprintf(&sb, "- %s (under %s)\n", r.Title, strings.Join(r.Path, " > "))
+			} else {
+				fmt.Fprintf(&sb, "- %s\n", r.Title)
+			}
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestParseResourceURI(t *testing.T) {
+	tests := []struct {
+		uri  string
+		want resourceRef
+	}{
+		{"logseq://graphs", resourceRef{kind: resourceGraphs}},
+		{"logseq://mcp/tasks", resourceRef{kind: resourceTasks, graph: "mcp"}},
+		{"logseq://mcp/page/projects", resourceRef{kind: resourcePage, graph: "mcp", key: "projects"}},
+		{"logseq://mcp/page/a%2Fb%20c", resourceRef{kind: resourcePage, graph: "mcp", key: "a/b c"}},
+		{"logseq://my%20graph/journal/today", resourceRef{kind: resourceJournal, graph: "my graph", key: "today"}},
+		{"logseq://mcp/block/6790c2a4-1c2b-4f3e-9d2a-0123456789ab", resourceRef{kind: resourceBlock, graph: "mcp", key: "6790c2a4-1c2b-4f3e-9d2a-0123456789ab"}},
+		{"logseq://mcp/tag/work", resourceRef{kind: resourceTag, graph: "mcp", key: "work"}},
+	}
+	for _, tt := range tests {
+		got, err := parseResourceURI(tt.uri)
+		if err != nil {
+			t.Errorf("parseResourceURI(%q): %v", tt.uri, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseResourceURI(%q) = %+v, want %+v", tt.uri, got, tt.want)
+		}
+	}
+
+	for _, uri := range []string{
+		"file:///mcp/tasks",
+		"logseq://",
+		"logseq://mcp",
+		"logseq:///tasks",
+		"logseq://mcp/tasks/extra",
+		"logseq://mcp/page",
+		"logseq://mcp/page/",
+		"logseq://mcp/page/a/b",
+		"logseq://mcp/unknown/x",
+		"logseq://mcp/page/%zz",
+	} {
+		if got, err := parseResourceURI(uri); err == nil {
+			t.Errorf("parseResourceURI(%q) = %+v, want an error", uri, got)
+		}
+	}
+}
+
+func TestResourceURIRoundTrip(t *testing.T) {
+	refs := []resourceRef{
+		{kind: resourceTasks, graph: "my graph"},
+		{kind: resourcePage, graph: "mcp", key: "a/b?c#d"},
+		{kind: resourceJournal, graph: "mcp", key: "2025-01-31"},
+		{kind: resourceTag, graph: "mcp", key: "100%"},
+	}
+	for _, r := range refs {
+		uri := resourceURI(r.graph, r.kind, r.key)
+		got, err := parseResourceURI(uri)
+		if err != nil || got != r {
+			t.Errorf("parseResourceURI(%q) = %+v, %v, want %+v", uri, got, err, r)
+		}
+	}
+}
+
+func TestReadResource(t *testing.T) {
+	session := newMemoryServer(t, &Config{DefaultGraph: "mcp"}, "mcp")
+	uuid := createdUUID(t, callTool(t, session, "create_task", map[string]any{"pageOrBlockId": "Work", "content": "Write report", "priority": "High"}))
+
+	ctx := context.Background()
+	read, err := session.ReadResource(ctx, &mcp.ReadResourceParams{URI: resourceURI("mcp", resourceTasks, "")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read.Contents) == 0 || !strings.Contains(read.Contents[0].Text, "Write report") {
+		t.Errorf("tasks resource = %+v, want the task", read.Contents)
+	}
+
+	read, err = session.ReadResource(ctx, &mcp.ReadResourceParams{URI: resourceURI("mcp", resourceBlock, uuid)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read.Contents) == 0 || !strings.Contains(read.Contents[0].Text, "Write report") {
+		t.Errorf("block resource = %+v, want the task", read.Contents)
+	}
+
+	if _, err := session.ReadResource(ctx, &mcp.ReadResourceParams{URI: "logseq://mcp/page/no%20such%20page"}); err == nil {
+		t.Error("reading a missing page succeeded")
+	}
+	if _, err := session.ReadResource(ctx, &mcp.ReadResourceParams{URI: "logseq://mcp/nothing"}); err == nil {
+		t.Error("reading an unknown URI succeeded")
+	}
+}
@@ -35,7 +35,8 @@ CLASSPATH="$CLASSPATH:$LOGSEQ_DEPS/db/src"
 CLASSPATH="$CLASSPATH:$LOGSEQ_DEPS/graph-parser/src"
 CLASSPATH="$CLASSPATH:$LOGSEQ_DEPS/outliner/src"
 
-# Run using Logseq's nbb-logseq (has feat-db-v31 features)
+# Run using Logseq's nbb-logseq (has feat-db-v31 features). exec, so that
+# killing this script kills nbb too.
 cd "$GRAPH_PARSER_DIR"
-./node_modules/.bin/nbb-logseq -cp "$CLASSPATH" \
+exec ./node_modules/.bin/nbb-logseq -cp "$CLASSPATH" \
     "$SCRIPT_DIR/scripts/$SCRIPT_NAME" "$@"
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/slimslenderslacks/mcp-logseq/graphdb"
+)
+
+// Tasks have a deadline and a scheduled date, the datetime properties
+// logseq.property/deadline and logseq.property/scheduled, and can repeat.
+// Completing a repeating task puts it back to Todo with its date moved on,
+// as checking one off in the Logseq app does.
+
+// clearValue removes a deadline, scheduled date or recurrence in
+// update_task.
+const clearValue = "none"
+
+// recurUnits are the units a task can repeat in, titles of the closed
+// values of logseq.property.repeat/recur-unit.
+var recurUnits = []string{"Minute", "Hour", "Day", "Week", "Month", "Year"}
+
+// recurrence is a repeat interval, e.g. every 2 weeks.
+type recurrence struct {
+	frequency int
+	unit      string
+}
+
+func (r recurrence) String() string {
+	unit := strings.ToLower(r.unit)
+	if r.frequency == 1 {
+		return "every " + unit
+	}
+	return fmt.Sprintf("every %d %ss", r.frequency, unit)
+}
+
+// add moves t on by n intervals of r.
+func (r recurrence) add(t time.Time, n int) time.Time {
+	n *= r.frequency
+	switch r.unit {
+	case "Minute":
+		return t.Add(time.Duration(n) * time.Minute)
+	case "Hour":
+		return t.Add(time.Duration(n) * time.Hour)
+	case "Week":
+		return t.AddDate(0, 0, 7*n)
+	case "Month":
+		return t.AddDate(0, n, 0)
+	case "Year":
+		return t.AddDate(n, 0, 0)
+	}
+	return t.AddDate(0, 0, n)
+}
+
+// next moves t on by r at least once and until it is after now, so that a
+// task completed late does not come back already overdue.
+func (r recurrence) next(t, now time.Time) time.Time {
+	for n := 1; ; n++ {
+		if next := r.add(t, n); next.After(now) {
+			return next
+		}
+	}
+}
+
+var recurrencePattern = regexp.MustCompile(`^(?:every\s+)?(\d+)?\s*([a-z]+)$`)
+
+// recurWords maps the unit words parseRecurrence accepts to recurUnits.
+var recurWords = map[string]string{
+	"min": "Minute", "minute": "Minute", "minutes": "Minute",
+	"h": "Hour", "hour": "Hour", "hours": "Hour", "hourly": "Hour",
+	"d": "Day", "day": "Day", "days": "Day", "daily": "Day",
+	"w": "Week", "week": "Week", "weeks": "Week", "weekly": "Week",
+	"m": "Month", "month": "Month", "months": "Month", "monthly": "Month",
+	"y": "Year", "year": "Year", "years": "Year", "yearly": "Year", "annually": "Year",
+}
+
+// parseRecurrence reads "daily", "every week", "every 2 weeks", "3 days"
+// or "2w".
+func parseRecurrence(s string) (recurrence, error) {
+	m := recurrencePattern.FindStringSubmatch(strings.ToLower(strings.TrimSpace(s)))
+	if m == nil || recurWords[m[2]] == "" {
+		return recurrence{}, fmt.Errorf("expected a recurrence such as daily, every 2 weeks or 3d, got %q", s)
+	}
+	r := recurrence{frequency: 1, unit: recurWords[m[2]]}
+	if m[1] != "" {
+		n, err := strconv.Atoi(m[1])
+		if err != nil || n < 1 {
+			return recurrence{}, fmt.Errorf("recurrence %q must repeat at least every 1 %s", s, strings.ToLower(r.unit))
+		}
+		r.frequency = n
+	}
+	return r, nil
+}
+
+// recurrenceOf returns how task repeats, if it does. Logseq stores the
+// frequency as a number value block and defaults it to 1.
+func recurrenceOf(task *graphdb.Entity) (recurrence, bool) {
+	if !task.Bool(graphdb.PropertyRepeated) {
+		return recurrence{}, false
+	}
+	unit := task.RefTitle(graphdb.PropertyRecurUnit)
+	if !slices.Contains(recurUnits, unit) {
+		return recurrence{}, false
+	}
+	r := recurrence{frequency: 1, unit: unit}
+	if ref := task.Ref(graphdb.PropertyRecurFrequency); ref != nil {
+		r.frequency = int(ref.Int("logseq.property/value"))
+	}
+	if r.frequency < 1 {
+		return recurrence{}, false
+	}
+	return r, true
+}
+
+var (
+	relativePattern = regexp.MustCompile(`^in\s+(\d+|a|an|one)\s+(minute|hour|day|week|month|year)s?$`)
+	atPattern       = regexp.MustCompile(`^(.*?)\s+at\s+(\d{1,2})(?::(\d{2}))?\s*(am|pm)?$`)
+)
+
+// parseWhen reads a date given as YYYY-MM-DD, YYYY-MM-DD HH:MM or RFC 3339,
+// or in words relative to now: today, tomorrow, yesterday, a weekday (the
+// next one, today included), next Monday (after today), next week (its
+// Monday), next month, next year, in 3 days, in 2 weeks. Any of the words
+// may end in "at 15:00" or "at 3pm". Dates without a time are the start of
+// the day in local time.
+func parseWhen(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if t, err := parsePropertyTime(s); err == nil {
+		return t, nil
+	}
+	words := strings.Join(strings.Fields(strings.ToLower(s)), " ")
+
+	hour, minute, timed := 0, 0, false
+	if m := atPattern.FindStringSubmatch(words); m != nil {
+		words = m[1]
+		hour, _ = strconv.Atoi(m[2])
+		minute, _ = strconv.Atoi(m[3])
+		switch {
+		case m[4] == "pm" && hour < 12:
+			hour += 12
+		case m[4] == "am" && hour == 12:
+			hour = 0
+		}
+		if hour > 23 || minute > 59 {
+			return time.Time{}, fmt.Errorf("invalid time of day in %q", s)
+		}
+		timed = true
+	}
+
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	var day time.Time
+	switch words {
+	case "today", "now":
+		day = today
+	case "tomorrow":
+		day = today.AddDate(0, 0, 1)
+	case "yesterday":
+		day = today.AddDate(0, 0, -1)
+	case "next week":
+		day = today.AddDate(0, 0, 7-(int(today.Weekday())+6)%7)
+	case "next month":
+		day = time.Date(today.Year(), today.Month()+1, 1, 0, 0, 0, 0, today.Location())
+	case "next year":
+		day = time.Date(today.Year()+1, 1, 1, 0, 0, 0, 0, today.Location())
+	default:
+		if m := relativePattern.FindStringSubmatch(words); m != nil {
+			n, err := strconv.Atoi(m[1])
+			if err != nil {
+				n = 1
+			}
+			switch m[2] {
+			case "minute":
+				return now.Add(time.Duration(n) * time.Minute), nil
+			case "hour":
+				return now.Add(time.Duration(n) * time.Hour), nil
+			}
+			unit := strings.ToUpper(m[2][:1]) + m[2][1:]
+			day = recurrence{frequency: n, unit: unit}.add(today, 1)
+			break
+		}
+		next := strings.HasPrefix(words, "next ")
+		weekday, ok := weekdays[strings.TrimPrefix(words, "next ")]
+		if !ok {
+			return time.Time{}, fmt.Errorf("expected a date such as 2026-03-01, tomorrow, friday or in 3 days, got %q", s)
+		}
+		days := (int(weekday) - int(today.Weekday()) + 7) % 7
+		if days == 0 && next {
+			days = 7
+		}
+		day = today.AddDate(0, 0, days)
+	}
+	if timed {
+		day = time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, day.Location())
+	}
+	return day, nil
+}
+
+var weekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "monday": time.Monday, "tuesday": time.Tuesday, "wednesday": time.Wednesday,
+	"thursday": time.Thursday, "friday": time.Friday, "saturday": time.Saturday,
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// normalizeWhen resolves a deadline or scheduled argument against now to
+// RFC 3339, so backends read the same time the handler saw. "" and
+// clearValue are kept as they are.
+func normalizeWhen(name, value string, now time.Time) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || strings.EqualFold(value, clearValue) {
+		return strings.ToLower(value), nil
+	}
+	t, err := parseWhen(value, now)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", name, err)
+	}
+	return t.Format(time.RFC3339), nil
+}
+
+// normalizeRepeat checks a repeat argument and spells it the way
+// recurrence.String does.
+func normalizeRepeat(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || strings.EqualFold(value, clearValue) {
+		return strings.ToLower(value), nil
+	}
+	r, err := parseRecurrence(value)
+	if err != nil {
+		return "", fmt.Errorf("repeat: %w", err)
+	}
+	return r.String(), nil
+}
+
+// scheduleChange is what create_task or update_task changes about a
+// task's dates and recurrence: property values to set, as the HTTP API
+// takes them, and properties to remove.
+type scheduleChange struct {
+	set    map[string]any
+	remove []string
+}
+
+// taskSchedule turns normalized deadline, scheduled and repeat arguments
+// into property changes. Datetimes are millisecond timestamps and the
+// recurrence unit the title of its closed value.
+func taskSchedule(deadline, scheduled, repeat string) (*scheduleChange, error) {
+	c := &scheduleChange{set: make(map[string]any)}
+	for _, d := range []struct{ property, value string }{
+		{graphdb.PropertyDeadline, deadline},
+		{graphdb.PropertyScheduled, scheduled},
+	} {
+		switch d.value {
+		case "":
+		case clearValue:
+			c.remove = append(c.remove, d.property)
+		default:
+			t, err := time.Parse(time.RFC3339, d.value)
+			if err != nil {
+				return nil, err
+			}
+			c.set[d.property] = t.UnixMilli()
+		}
+	}
+	switch repeat {
+	case "":
+	case clearValue:
+		c.remove = append(c.remove, graphdb.PropertyRepeated, graphdb.PropertyRecurFrequency, graphdb.PropertyRecurUnit)
+	default:
+		r, err := parseRecurrence(repeat)
+		if err != nil {
+			return nil, err
+		}
+		c.set[graphdb.PropertyRepeated] = true
+		c.set[graphdb.PropertyRecurFrequency] = int64(r.frequency)
+		c.set[graphdb.PropertyRecurUnit] = r.unit
+	}
+	return c, nil
+}
+
+// completion returns what completing task does. A repeating task with a
+// deadline, or else a scheduled date, goes back to Todo with that date
+// moved on past now; any other task is marked Done.
+func completion(task *graphdb.Entity, now time.Time) *TaskUpdate {
+	update := &TaskUpdate{UUID: task.UUID(), Status: "Done"}
+	r, ok := recurrenceOf(task)
+	if !ok {
+		return update
+	}
+	for _, property := range []string{graphdb.PropertyDeadline, graphdb.PropertyScheduled} {
+		if !task.Has(property) {
+			continue
+		}
+		next := r.next(task.Time(property), now)
+		update.Status = "Todo"
+		update.Repeat = r.String()
+		if property == graphdb.PropertyDeadline {
+			update.Deadline = &next
+		} else {
+			update.Scheduled = &next
+		}
+		break
+	}
+	return update
+}
+
+// closedStatuses are the statuses of tasks that are no longer due.
+var closedStatuses = []string{"Done", "Canceled"}
+
+// dueDate returns when t is due: its deadline, or its scheduled date.
+func dueDate(t Task) *time.Time {
+	if t.Deadline != nil {
+		return t.Deadline
+	}
+	return t.Scheduled
+}
+
+// upcomingTasks picks the open tasks due before the end of the day days
+// after now and splits them into overdue (due before today), due today
+// and upcoming, each soonest first.
+func upcomingTasks(tasks []Task, now time.Time, days int) *UpcomingTasks {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	tomorrow := today.AddDate(0, 0, 1)
+	end := tomorrow.AddDate(0, 0, days)
+
+	var due []Task
+	for _, t := range tasks {
+		if dueDate(t) != nil && !slices.Contains(closedStatuses, t.Status) {
+			due = append(due, t)
+		}
+	}
+	slices.SortFunc(due, func(a, b Task) int {
+		if c := dueDate(a).Compare(*dueDate(b)); c != 0 {
+			return c
+		}
+		return a.ID - b.ID
+	})
+
+	upcoming := &UpcomingTasks{Today: today.Format(time.DateOnly), Days: days}
+	for _, t := range due {
+		due := dueDate(t)
+		switch {
+		case due.Before(today):
+			upcoming.Overdue = append(upcoming.Overdue, t)
+		case due.Before(tomorrow):
+			upcoming.DueToday = append(upcoming.DueToday, t)
+		case due.Before(end):
+			upcoming.Upcoming = append(upcoming.Upcoming, t)
+		}
+	}
+	return upcoming
+}
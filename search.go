@@ -0,0 +1,393 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/slimslenderslacks/mcp-logseq/graphdb"
+)
+
+// Full-text search runs in-process over an inverted index of a graph's
+// page titles and block titles, whichever backend serves the graph. Each
+// graph's index is built on first use and rebuilt when the graph changes.
+
+// SearchQuery is a search request. Query holds words, "quoted phrases"
+// and prefixes ending in *; a result must match all of them.
+type SearchQuery struct {
+	Query  string `json:"query"`
+	Limit  int    `json:"limit"`
+	Offset int    `json:"offset"`
+}
+
+// searchIndexes caches a search index per graph, keyed by the version of
+// the graph it was built from.
+type searchIndexes struct {
+	mu      sync.Mutex
+	byGraph map[string]*searchIndex
+}
+
+func newSearchIndexes() *searchIndexes {
+	return &searchIndexes{byGraph: make(map[string]*searchIndex)}
+}
+
+// search runs q against graph's index, first rebuilding it from load if
+// it was built from a version other than version.
+func (c *searchIndexes) search(ctx context.Context, graph, version string, load func(ctx context.Context, graph string) (*graphdb.DB, error), q SearchQuery) (*SearchResults, error) {
+	clauses, err := parseSearchQuery(q.Query)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	ix := c.byGraph[graph]
+	c.mu.Unlock()
+	if ix == nil || ix.version != version {
+		db, err := load(ctx, graph)
+		if err != nil {
+			return nil, err
+		}
+		ix = buildSearchIndex(db, version)
+		c.mu.Lock()
+		c.byGraph[graph] = ix
+		c.mu.Unlock()
+	}
+	return ix.search(q, clauses), nil
+}
+
+// searchDoc is a page or block in a search index.
+type searchDoc struct {
+	kind     string
+	id       int64
+	uuid     string
+	text     string
+	page     string
+	pageUUID string
+	path     []string
+	length   int
+}
+
+type posting struct {
+	doc       int
+	positions []int
+}
+
+type searchIndex struct {
+	version  string
+	docs     []searchDoc
+	postings map[string][]posting
+	terms    []string // sorted keys of postings, for prefix queries
+	avgLen   float64
+}
+
+// refPattern matches a page or block reference stored by UUID in a block
+// title.
+var refPattern = regexp.MustCompile(`\[\[([0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12})\]\]`)
+
+// displayTitle returns e's title with references replaced by the titles
+// they point at, as Logseq displays it.
+func displayTitle(db *graphdb.DB, e *graphdb.Entity) string {
+	return refPattern.ReplaceAllStringFunc(e.Title(), func(ref string) string {
+		if target := db.ByUUID(ref[2 : len(ref)-2]); target != nil {
+			return "[[" + target.Title() + "]]"
+		}
+		return ref
+	})
+}
+
+// buildSearchIndex indexes the pages and blocks of db, leaving out
+// built-in pages and property value blocks.
+func buildSearchIndex(db *graphdb.DB, version string) *searchIndex {
+	ix := &searchIndex{version: version, postings: make(map[string][]posting)}
+	add := func(doc searchDoc) {
+		tokens := tokenize(doc.text)
+		if len(tokens) == 0 {
+			return
+		}
+		n := len(ix.docs)
+		doc.length = len(tokens)
+		ix.docs = append(ix.docs, doc)
+		positions := make(map[string][]int)
+		for i, t := range tokens {
+			positions[t.text] = append(positions[t.text], i)
+		}
+		for term, pos := range positions {
+			ix.postings[term] = append(ix.postings[term], posting{doc: n, positions: pos})
+		}
+	}
+
+	for _, e := range db.With("block/name") {
+		if e.Bool("logseq.property/built-in?") {
+			continue
+		}
+		add(searchDoc{kind: "page", id: e.ID, uuid: e.UUID(), text: e.Title(), page: e.Title(), pageUUID: e.UUID()})
+	}
+	for _, e := range db.With("block/page") {
+		if !e.Has("block/title") || e.Has("logseq.property/created-from-property") {
+			continue
+		}
+		doc := searchDoc{kind: "block", id: e.ID, uuid: e.UUID(), text: displayTitle(db, e), path: breadcrumb(e)}
+		if page := e.Page(); page != nil {
+			doc.page, doc.pageUUID = page.Title(), page.UUID()
+		}
+		add(doc)
+	}
+
+	total := 0
+	for _, d := range ix.docs {
+		total += d.length
+	}
+	if len(ix.docs) > 0 {
+		ix.avgLen = float64(total) / float64(len(ix.docs))
+	}
+	for term := range ix.postings {
+		ix.terms = append(ix.terms, term)
+	}
+	sort.Strings(ix.terms)
+	return ix
+}
+
+// token is a lowercased word and its byte range in the text.
+type token struct {
+	text       string
+	start, end int
+}
+
+// tokenize splits s into runs of letters and digits.
+func tokenize(s string) []token {
+	var tokens []token
+	start := -1
+	for i, r := range s {
+		word := unicode.IsLetter(r) || unicode.IsDigit(r)
+		switch {
+		case word && start < 0:
+			start = i
+		case !word && start >= 0:
+			tokens = append(tokens, token{strings.ToLower(s[start:i]), start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, token{strings.ToLower(s[start:]), start, len(s)})
+	}
+	return tokens
+}
+
+// searchClause is one word, phrase or prefix of a query. A clause with
+// several terms matches them at consecutive positions. With prefix set
+// the last term matches any word starting with it.
+type searchClause struct {
+	terms  []string
+	prefix bool
+}
+
+// parseSearchQuery splits a query into clauses. Punctuation inside a word
+// makes it a phrase, so "e-mail" matches "e mail" but not "mail e".
+func parseSearchQuery(query string) ([]searchClause, error) {
+	var clauses []searchClause
+	add := func(text string) {
+		prefix := strings.HasSuffix(text, "*")
+		var terms []string
+		for _, t := range tokenize(text) {
+			terms = append(terms, t.text)
+		}
+		if len(terms) > 0 {
+			clauses = append(clauses, searchClause{terms: terms, prefix: prefix})
+		}
+	}
+	rest := strings.TrimSpace(query)
+	for rest != "" {
+		if rest[0] == '"' {
+			// An unterminated quote runs to the end of the query.
+			phrase, after, _ := strings.Cut(rest[1:], `"`)
+			if strings.HasPrefix(after, "*") {
+				phrase += "*"
+				after = after[1:]
+			}
+			add(phrase)
+			rest = strings.TrimSpace(after)
+			continue
+		}
+		word, after, _ := strings.Cut(rest, " ")
+		add(word)
+		rest = strings.TrimSpace(after)
+	}
+	if len(clauses) == 0 {
+		return nil, &BackendError{Code: errCodeInvalidArgument, Message: fmt.Sprintf("query %q has no words to search for", query)}
+	}
+	return clauses, nil
+}
+
+// termPositions returns the positions of term in each document that has
+// it, or of every indexed word starting with term.
+func (ix *searchIndex) termPositions(term string, prefix bool) map[int][]int {
+	matches := make(map[int][]int)
+	add := func(term string) {
+		for _, p := range ix.postings[term] {
+			matches[p.doc] = append(matches[p.doc], p.positions...)
+		}
+	}
+	if !prefix {
+		add(term)
+		return matches
+	}
+	for i := sort.SearchStrings(ix.terms, term); i < len(ix.terms) && strings.HasPrefix(ix.terms[i], term); i++ {
+		add(ix.terms[i])
+	}
+	for doc := range matches {
+		slices.Sort(matches[doc])
+	}
+	return matches
+}
+
+// match returns the positions at which c starts in each document it
+// matches.
+func (ix *searchIndex) match(c searchClause) map[int][]int {
+	last := len(c.terms) - 1
+	starts := ix.termPositions(c.terms[0], c.prefix && last == 0)
+	for i := 1; i <= last && len(starts) > 0; i++ {
+		next := ix.termPositions(c.terms[i], c.prefix && i == last)
+		for doc, positions := range starts {
+			var kept []int
+			for _, p := range positions {
+				if _, ok := slices.BinarySearch(next[doc], p+i); ok {
+					kept = append(kept, p)
+				}
+			}
+			if kept == nil {
+				delete(starts, doc)
+			} else {
+				starts[doc] = kept
+			}
+		}
+	}
+	return starts
+}
+
+// BM25 parameters.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+
+	// pageBoost favours a page whose title matches over the blocks that
+	// mention it.
+	pageBoost = 1.5
+
+	snippetBefore = 6
+	snippetWords  = 24
+)
+
+func (ix *searchIndex) search(q SearchQuery, clauses []searchClause) *SearchResults {
+	type hit struct {
+		doc   int
+		score float64
+		// spans are the matched [start, end) token ranges.
+		spans [][2]int
+	}
+	var hits map[int]*hit
+	for i, c := range clauses {
+		matches := ix.match(c)
+		idf := math.Log(1 + (float64(len(ix.docs))-float64(len(matches))+0.5)/(float64(len(matches))+0.5))
+		next := make(map[int]*hit)
+		for doc, starts := range matches {
+			h := &hit{doc: doc}
+			if i > 0 {
+				if h = hits[doc]; h == nil {
+					continue
+				}
+			}
+			tf := float64(len(starts))
+			norm := 1 - bm25B + bm25B*float64(ix.docs[doc].length)/ix.avgLen
+			h.score += idf * tf * (bm25K1 + 1) / (tf + bm25K1*norm) * float64(len(c.terms))
+			for _, p := range starts {
+				h.spans = append(h.spans, [2]int{p, p + len(c.terms)})
+			}
+			next[doc] = h
+		}
+		hits = next
+	}
+
+	ranked := make([]*hit, 0, len(hits))
+	for _, h := range hits {
+		if ix.docs[h.doc].kind == "page" {
+			h.score *= pageBoost
+		}
+		ranked = append(ranked, h)
+	}
+	slices.SortFunc(ranked, func(a, b *hit) int {
+		return cmp.Or(cmp.Compare(b.score, a.score), cmp.Compare(ix.docs[a.doc].id, ix.docs[b.doc].id))
+	})
+
+	results := &SearchResults{Query: q.Query, Total: len(ranked), Offset: q.Offset}
+	if q.Offset < len(ranked) {
+		ranked = ranked[q.Offset:]
+	} else {
+		ranked = nil
+	}
+	if q.Limit > 0 && len(ranked) > q.Limit {
+		ranked = ranked[:q.Limit]
+	}
+	for _, h := range ranked {
+		d := ix.docs[h.doc]
+		results.Results = append(results.Results, SearchResult{
+			Kind:     d.kind,
+			ID:       int(d.id),
+			UUID:     d.uuid,
+			Title:    d.text,
+			Page:     d.page,
+			PageUUID: d.pageUUID,
+			Path:     d.path,
+			Snippet:  snippet(d.text, h.spans),
+			Score:    math.Round(h.score*1000) / 1000,
+		})
+	}
+	return results
+}
+
+// snippet returns the part of text around the first match with every
+// matched word in it set in **bold**.
+func snippet(text string, spans [][2]int) string {
+	tokens := tokenize(text)
+	matched := make([]bool, len(tokens))
+	first := len(tokens)
+	for _, s := range spans {
+		first = min(first, s[0])
+		for i := s[0]; i < s[1] && i < len(tokens); i++ {
+			matched[i] = true
+		}
+	}
+	from := max(0, first-snippetBefore)
+	to := min(len(tokens), from+snippetWords)
+
+	var sb strings.Builder
+	start := 0
+	if from > 0 {
+		sb.WriteString("…")
+		start = tokens[from].start
+	}
+	end := len(text)
+	if to < len(tokens) {
+		end = tokens[to-1].end
+	}
+	pos := start
+	for i := from; i < to; i++ {
+		if !matched[i] {
+			continue
+		}
+		t := tokens[i]
+		sb.WriteString(text[pos:t.start])
+		sb.WriteString("**" + text[t.start:t.end] + "**")
+		pos = t.end
+	}
+	sb.WriteString(text[pos:end])
+	if end < len(text) {
+		sb.WriteString("…")
+	}
+	return strings.Join(strings.Fields(sb.String()), " ")
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// Transports accepted by --transport.
+const (
+	transportStdio = "stdio"
+	transportHTTP  = "http"
+)
+
+// defaultHTTPAddr only accepts connections from this machine, as the HTTP
+// endpoint has no authentication and offers the write tools.
+const defaultHTTPAddr = "127.0.0.1:8080"
+
+// shutdownTimeout bounds how long in-flight HTTP requests may take to
+// finish once the server is asked to stop.
+const shutdownTimeout = 10 * time.Second
+
+// serve runs the MCP server on the named transport until ctx is cancelled
+// or the client disconnects.
+func (m *MCPServer) serve(ctx context.Context, transport, addr string) error {
+	go m.watcher.run(ctx)
+	switch transport {
+	case transportStdio:
+		log.Println("Ready to accept MCP protocol messages on stdio")
+		return m.server.Run(ctx, &mcp.StdioTransport{})
+	case transportHTTP:
+		return m.serveHTTP(ctx, addr)
+	}
+	return fmt.Errorf("unknown transport %q (expected %s or %s)", transport, transportStdio, transportHTTP)
+}
+
+// serveHTTP serves the streamable HTTP transport on addr. Every client gets
+// its own session on the one shared server, so they see the same graphs
+// but subscribe to resources independently.
+func (m *MCPServer) serveHTTP(ctx context.Context, addr string) error {
+	handler := mcp.NewStreamableHTTPHandler(func(*http.Request) *mcp.Server {
+		return m.server
+	}, nil)
+
+	mux := http.NewServeMux()
+	mux.Handle("/mcp", handler)
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	httpServer := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		// Cancelling ctx ends long-lived event streams too, which
+		// Shutdown would otherwise wait on.
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		log.Printf("Ready to accept MCP protocol messages on http://%s/mcp", addr)
+		errc <- httpServer.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Println("Shutting down HTTP server...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutting down: %w", err)
+	}
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
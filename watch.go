@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"log"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/slimslenderslacks/mcp-logseq/graphdb"
+)
+
+// Resources change when their graph does, through a write tool or in the
+// Logseq app. The watcher polls the version of every graph a session has
+// subscribed to a resource of, and when it moves diffs the graph's old and
+// new snapshots so that only the resources whose content changed are
+// notified.
+
+// graphChanges is what differs between two snapshots of a graph.
+type graphChanges struct {
+	tasks bool
+	// pages holds the names and UUIDs of the pages with a change to
+	// themselves or any of their blocks.
+	pages map[string]bool
+	// blocks holds the UUIDs of the changed blocks and their ancestors.
+	blocks map[string]bool
+	// journals holds the days of the journal pages in pages.
+	journals map[int64]bool
+	// tags holds the names and UUIDs of the tags of the changed blocks
+	// and pages, and of the changed tags.
+	tags map[string]bool
+}
+
+// diffGraph compares two snapshots of a graph. An entity counts in the
+// state it has in either, so that moving a block changes its old page
+// and parents as well as its new ones.
+func diffGraph(old, new *graphdb.DB) *graphChanges {
+	c := &graphChanges{
+		pages:    make(map[string]bool),
+		blocks:   make(map[string]bool),
+		journals: make(map[int64]bool),
+		tags:     make(map[string]bool),
+	}
+	for _, id := range graphdb.Changed(old, new) {
+		for _, db := range []*graphdb.DB{old, new} {
+			if e := db.Entity(id); e != nil {
+				c.add(e)
+			}
+		}
+	}
+	return c
+}
+
+func (c *graphChanges) add(e *graphdb.Entity) {
+	if e.HasTag(graphdb.ClassTask) {
+		c.tasks = true
+	}
+	for _, tag := range e.Tags() {
+		c.addTag(tag)
+	}
+	if e.HasTag(graphdb.ClassTag) {
+		c.addTag(e)
+	}
+	if e.Has("block/name") {
+		c.addPage(e)
+		return
+	}
+	if page := e.Page(); page != nil {
+		c.addPage(page)
+	}
+	for b := e; b != nil && !b.Has("block/name"); b = b.Parent() {
+		if c.blocks[b.UUID()] {
+			break
+		}
+		c.blocks[b.UUID()] = true
+	}
+}
+
+func (c *graphChanges) addPage(page *graphdb.Entity) {
+	c.pages[page.Name()] = true
+	c.pages[page.UUID()] = true
+	if day := page.Int("block/journal-day"); day != 0 {
+		c.journals[day] = true
+	}
+}
+
+func (c *graphChanges) addTag(tag *graphdb.Entity) {
+	c.tags[tag.Name()] = true
+	c.tags[tag.UUID()] = true
+}
+
+// affects reports whether the resource r shows any of the changes.
+func (c *graphChanges) affects(r resourceRef) bool {
+	switch r.kind {
+	case resourceTasks:
+		return c.tasks
+	case resourcePage:
+		return c.pages[strings.ToLower(r.key)] || c.pages[r.key]
+	case resourceBlock:
+		return c.blocks[r.key]
+	case resourceJournal:
+		day, err := parseJournalDate(r.key, time.Now())
+		return err == nil && c.journals[journalDay(day)]
+	case resourceTag:
+		key := strings.TrimPrefix(r.key, "#")
+		return c.tags[strings.ToLower(key)] || c.tags[key]
+	}
+	return false
+}
+
+// graphState is the last state of a graph the watcher saw.
+type graphState struct {
+	version string
+	db      *graphdb.DB
+}
+
+// graphWatcher tracks each session's resource subscriptions and notifies
+// the resources that change.
+type graphWatcher struct {
+	backend  Backend
+	interval time.Duration
+	notify   func(ctx context.Context, uri string)
+	pokes    chan struct{}
+
+	mu sync.Mutex
+	// subs maps each session to the URIs it subscribed to, with the
+	// graph resolved from an alias.
+	subs map[*mcp.ServerSession]map[string]resourceRef
+
+	// checking serializes checks; the fields below are only used under it.
+	checking sync.Mutex
+	graphs   map[string]*graphState
+	versions map[string]string // graph -> version, for logseq://graphs
+}
+
+func newGraphWatcher(backend Backend, interval time.Duration, notify func(ctx context.Context, uri string)) *graphWatcher {
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+	return &graphWatcher{
+		backend:  backend,
+		interval: interval,
+		notify:   notify,
+		pokes:    make(chan struct{}, 1),
+		subs:     make(map[*mcp.ServerSession]map[string]resourceRef),
+		graphs:   make(map[string]*graphState),
+	}
+}
+
+// run checks for changes every interval, and when poked, until ctx is
+// done.
+func (w *graphWatcher) run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-w.pokes:
+		}
+		w.check(ctx)
+	}
+}
+
+// poke asks for a check now rather than at the next tick, after a write.
+func (w *graphWatcher) poke() {
+	select {
+	case w.pokes <- struct{}{}:
+	default:
+	}
+}
+
+// subscribe records that session wants updates to uri, and forgets the
+// session's subscriptions when it ends. The graph's state is recorded
+// before it returns, so that a change made right after subscribing is
+// notified rather than taken as the state the next check starts from.
+func (w *graphWatcher) subscribe(ctx context.Context, session *mcp.ServerSession, uri string, r resourceRef) {
+	w.mu.Lock()
+	uris, ok := w.subs[session]
+	if !ok {
+		uris = make(map[string]resourceRef)
+		w.subs[session] = uris
+		if session != nil {
+			go func() {
+				session.Wait()
+				w.mu.Lock()
+				delete(w.subs, session)
+				w.mu.Unlock()
+			}()
+		}
+	}
+	uris[uri] = r
+	w.mu.Unlock()
+	if err := w.record(ctx, r); err != nil {
+		// The next check records it instead.
+		log.Printf("Watching %s: %v", r.graph, err)
+		w.poke()
+	}
+}
+
+// record records the state of r's graph if it is not watched already.
+func (w *graphWatcher) record(ctx context.Context, r resourceRef) error {
+	w.checking.Lock()
+	defer w.checking.Unlock()
+	if r.kind == resourceGraphs {
+		if w.versions == nil {
+			w.checkGraphs(ctx)
+		}
+		return nil
+	}
+	if w.graphs[r.graph] != nil {
+		return nil
+	}
+	_, err := w.checkGraph(ctx, r.graph)
+	return err
+}
+
+func (w *graphWatcher) unsubscribe(session *mcp.ServerSession, uri string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.subs[session], uri)
+}
+
+// subscribed returns every subscribed URI, whichever sessions hold it.
+func (w *graphWatcher) subscribed() map[string]resourceRef {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	all := make(map[string]resourceRef)
+	for _, uris := range w.subs {
+		maps.Copy(all, uris)
+	}
+	return all
+}
+
+// check compares every subscribed graph with the state last seen and
+// notifies the subscribed resources that changed. A graph's first check
+// only records its state.
+func (w *graphWatcher) check(ctx context.Context) {
+	w.checking.Lock()
+	defer w.checking.Unlock()
+
+	subs := w.subscribed()
+	byGraph := make(map[string]map[string]resourceRef)
+	graphsSubscribed := false
+	for uri, r := range subs {
+		if r.kind == resourceGraphs {
+			graphsSubscribed = true
+			continue
+		}
+		if byGraph[r.graph] == nil {
+			byGraph[r.graph] = make(map[string]resourceRef)
+		}
+		byGraph[r.graph][uri] = r
+	}
+
+	if graphsSubscribed {
+		w.checkGraphs(ctx)
+	} else {
+		w.versions = nil
+	}
+	for graph := range w.graphs {
+		if byGraph[graph] == nil {
+			delete(w.graphs, graph)
+		}
+	}
+	for _, graph := range slices.Sorted(maps.Keys(byGraph)) {
+		changes, err := w.checkGraph(ctx, graph)
+		if err != nil {
+			log.Printf("Watching %s: %v", graph, err)
+			continue
+		}
+		if changes == nil {
+			continue
+		}
+		for _, uri := range slices.Sorted(maps.Keys(byGraph[graph])) {
+			if changes.affects(byGraph[graph][uri]) {
+				w.notify(ctx, uri)
+			}
+		}
+	}
+}
+
+// checkGraph returns what changed in graph since the last check, or nil
+// if it has not changed or was not checked before.
+func (w *graphWatcher) checkGraph(ctx context.Context, graph string) (*graphChanges, error) {
+	version, err := w.backend.Version(ctx, graph)
+	if err != nil {
+		return nil, err
+	}
+	state := w.graphs[graph]
+	if state != nil && state.version == version {
+		return nil, nil
+	}
+	db, err := w.backend.Snapshot(ctx, graph)
+	if err != nil {
+		return nil, err
+	}
+	w.graphs[graph] = &graphState{version: version, db: db}
+	if state == nil {
+		return nil, nil
+	}
+	return diffGraph(state.db, db), nil
+}
+
+// checkGraphs notifies logseq://graphs when a graph is added, removed or
+// changed, which changes its size, counts or modification time.
+func (w *graphWatcher) checkGraphs(ctx context.Context) {
+	names, err := w.backend.ListGraphs(ctx)
+	if err != nil {
+		log.Printf("Watching graphs: %v", err)
+		return
+	}
+	versions := make(map[string]string, len(names))
+	for _, name := range names {
+		if versions[name], err = w.backend.Version(ctx, name); err != nil {
+			log.Printf("Watching %s: %v", name, err)
+		}
+	}
+	if w.versions != nil && !maps.Equal(w.versions, versions) {
+		w.notify(ctx, graphsURI)
+	}
+	w.versions = versions
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestWatcherNotifiesChangeAfterSubscribe(t *testing.T) {
+	ctx := context.Background()
+	backend := newMemoryBackend()
+	var notified []string
+	w := newGraphWatcher(backend, time.Hour, func(ctx context.Context, uri string) {
+		notified = append(notified, uri)
+	})
+
+	const uri = "logseq://mcp/page/projects"
+	r, err := parseResourceURI(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.subscribe(ctx, nil, uri, r)
+	// The page is created before the watcher's first check.
+	if _, _, err := backend.CreatePage(ctx, CreatePageArgs{Graph: "mcp", Name: "Projects"}); err != nil {
+		t.Fatal(err)
+	}
+	w.check(ctx)
+	if !slices.Equal(notified, []string{uri}) {
+		t.Errorf("notified %q, want %q", notified, uri)
+	}
+
+	notified = nil
+	w.check(ctx)
+	if len(notified) != 0 {
+		t.Errorf("notified %q without a change", notified)
+	}
+}
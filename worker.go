@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// workerScript is the script a worker process runs. See its namespace
+// docstring for the protocol.
+const workerScript = "worker.cljs"
+
+// workerRequest asks a worker to run script against the database at
+// DBPath. Args are the script's command-line arguments, starting with the
+// graph name.
+type workerRequest struct {
+	ID     int64    `json:"id"`
+	Script string   `json:"script"`
+	DBPath string   `json:"dbPath"`
+	Args   []string `json:"args"`
+}
+
+type workerResponse struct {
+	ID int64 `json:"id"`
+	scriptResult
+}
+
+// workerPool runs scripts in long-lived worker.cljs processes, which keep
+// the Logseq code loaded and each graph open between calls. A worker
+// answers one request at a time, so the pool size bounds concurrency.
+// Workers start on first use; one that crashes or overruns the timeout is
+// killed and replaced on the next call.
+type workerPool struct {
+	runScript string
+	timeout   time.Duration
+	slots     chan *worker // idle slots, nil until their worker is started
+}
+
+func newWorkerPool(runScript string, size int, timeout time.Duration) *workerPool {
+	p := &workerPool{
+		runScript: runScript,
+		timeout:   timeout,
+		slots:     make(chan *worker, size),
+	}
+	for range size {
+		p.slots <- nil
+	}
+	return p
+}
+
+// call sends req to an idle worker and waits for its response.
+func (p *workerPool) call(ctx context.Context, req workerRequest) (*scriptResult, error) {
+	var w *worker
+	select {
+	case w = <-p.slots:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { p.slots <- w }()
+
+	if w == nil || w.exited() {
+		var err error
+		if w, err = startWorker(p.runScript); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	resp, err := w.call(ctx, req)
+	if err != nil {
+		// The worker may still be busy with the request or be wedged, so
+		// it cannot be reused.
+		w.kill()
+		w = nil
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = fmt.Errorf("%s timed out after %s", req.Script, p.timeout)
+		}
+		return nil, err
+	}
+	return resp, nil
+}
+
+// worker is one worker.cljs process.
+type worker struct {
+	cmd       *exec.Cmd
+	stdin     io.WriteCloser
+	responses chan workerResponse
+	done      chan struct{} // closed when the process has exited
+	nextID    int64
+}
+
+func startWorker(runScript string) (*worker, error) {
+	cmd := exec.Command(runScript, workerScript)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("starting script worker: %w", err)
+	}
+	w := &worker{
+		cmd:       cmd,
+		stdin:     stdin,
+		responses: make(chan workerResponse, 1),
+		done:      make(chan struct{}),
+	}
+	go w.read(stdout)
+	return w, nil
+}
+
+// read delivers the responses the worker prints until it exits. Other
+// output, such as library warnings, is logged.
+func (w *worker) read(stdout io.Reader) {
+	defer close(w.done)
+	r := bufio.NewReader(stdout)
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(line) > 0 {
+			var resp workerResponse
+			if json.Unmarshal(line, &resp) == nil && resp.ID != 0 {
+				select {
+				case w.responses <- resp:
+				default: // a response nobody is waiting for
+				}
+			} else {
+				log.Printf("script worker: %s", line)
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	if err := w.cmd.Wait(); err != nil {
+		log.Printf("script worker exited: %v", err)
+	}
+}
+
+func (w *worker) exited() bool {
+	select {
+	case <-w.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (w *worker) call(ctx context.Context, req workerRequest) (*scriptResult, error) {
+	w.nextID++
+	req.ID = w.nextID
+	line, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	// A worker that stops reading stdin blocks the write, so it is waited
+	// for like the response. Killing the worker ends the write.
+	written := make(chan error, 1)
+	go func() {
+		_, err := w.stdin.Write(append(line, '\n'))
+		written <- err
+	}()
+	select {
+	case err := <-written:
+		if err != nil {
+			return nil, fmt.Errorf("sending request to script worker: %w", err)
+		}
+	case <-w.done:
+		return nil, errors.New("script worker exited")
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	for {
+		select {
+		case resp := <-w.responses:
+			if resp.ID == req.ID {
+				return &resp.scriptResult, nil
+			}
+		case <-w.done:
+			// The response may have arrived just before the exit.
+			select {
+			case resp := <-w.responses:
+				if resp.ID == req.ID {
+					return &resp.scriptResult, nil
+				}
+			default:
+			}
+			return nil, errors.New("script worker exited")
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// kill stops the worker. Closing stdin also ends nbb if the kill only
+// reaches a wrapper shell.
+func (w *worker) kill() {
+	w.stdin.Close()
+	w.cmd.Process.Kill()
+}